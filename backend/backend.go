@@ -0,0 +1,54 @@
+package backend
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/viert/xc/config"
+	"github.com/viert/xc/store"
+)
+
+// Constructor creates a backend instance configured with xc config
+type Constructor func(cfg *config.XCConfig) (store.Backend, error)
+
+var (
+	registry     = make(map[string]Constructor)
+	registryLock sync.Mutex
+)
+
+// Register makes a backend available by its type name, i.e.
+// the value of "type" option in [backend] config section.
+// It's intended to be called from backend packages' init functions
+func Register(name string, constructor Constructor) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	if _, found := registry[name]; found {
+		panic(fmt.Sprintf("backend type %s is already registered", name))
+	}
+	registry[name] = constructor
+}
+
+// Types returns the sorted list of registered backend types
+func Types() []string {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	types := make([]string, 0, len(registry))
+	for name := range registry {
+		types = append(types, name)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// New creates a backend of the type configured in [backend] section
+func New(cfg *config.XCConfig) (store.Backend, error) {
+	registryLock.Lock()
+	constructor, found := registry[cfg.BackendCfg.Type]
+	registryLock.Unlock()
+	if !found {
+		return nil, fmt.Errorf("unknown backend type, available types are %s", strings.Join(Types(), ", "))
+	}
+	return constructor(cfg)
+}
@@ -4,23 +4,34 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"net/http"
 	"os"
 	"path"
 	"regexp"
 	"strings"
 	"time"
 
+	"github.com/viert/xc/backend"
+	"github.com/viert/xc/backend/httpclient"
 	"github.com/viert/xc/config"
+	"github.com/viert/xc/log"
 	"github.com/viert/xc/store"
 	"github.com/viert/xc/term"
 )
 
+func init() {
+	backend.Register("conductor", func(cfg *config.XCConfig) (store.Backend, error) {
+		return New(cfg)
+	})
+}
+
 // New creates a new instance of Conductor backend
 func New(cfg *config.XCConfig) (*Conductor, error) {
+	var err error
+
 	c := &Conductor{
 		cacheTTL:    cfg.CacheTTL,
 		cacheDir:    cfg.CacheDir,
+		offline:     cfg.Offline,
 		hosts:       make([]*store.Host, 0),
 		groups:      make([]*store.Group, 0),
 		workgroups:  make([]*store.WorkGroup, 0),
@@ -44,32 +55,49 @@ func New(cfg *config.XCConfig) (*Conductor, error) {
 	}
 
 	c.url = url
+
+	c.client, err = httpclient.New(options)
+	if err != nil {
+		return nil, err
+	}
 	return c, nil
 
 }
 
 // Hosts exported backend method
 func (c *Conductor) Hosts() []*store.Host {
+	c.lock.Lock()
+	defer c.lock.Unlock()
 	return c.hosts
 }
 
 // Groups exported backend method
 func (c *Conductor) Groups() []*store.Group {
+	c.lock.Lock()
+	defer c.lock.Unlock()
 	return c.groups
 }
 
 // WorkGroups exported backend method
 func (c *Conductor) WorkGroups() []*store.WorkGroup {
+	c.lock.Lock()
+	defer c.lock.Unlock()
 	return c.workgroups
 }
 
 // Datacenters exported backend method
 func (c *Conductor) Datacenters() []*store.Datacenter {
+	c.lock.Lock()
+	defer c.lock.Unlock()
 	return c.datacenters
 }
 
 // Reload forces reloading data from HTTP(S)
 func (c *Conductor) Reload() error {
+	if c.offline {
+		term.Warnf("Offline mode, reloading data from cache\n")
+		return c.loadLocal()
+	}
 	err := c.loadRemote()
 	if err != nil {
 		// trying to use cache
@@ -78,22 +106,58 @@ func (c *Conductor) Reload() error {
 	return nil
 }
 
-// Load tries to load data from cache unless it's expired
-// In case of cache expiration or absense it triggers Reload()
+// OnUpdate sets a handler called when data is refreshed in background
+func (c *Conductor) OnUpdate(handler func()) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.onUpdate = handler
+}
+
+// Load loads data from cache, even if it's expired, so xc could
+// start immediately. Expired cache is then refreshed in background.
+// In case of cache absense it triggers Reload()
 func (c *Conductor) Load() error {
-	var err error
-	if c.cacheExpired() {
+	err := c.loadLocal()
+	if err != nil {
+		if c.offline {
+			return fmt.Errorf("Offline mode, can't load cache %s: %s", c.cacheFilename(), err)
+		}
+		// no usable cache, the data must be loaded from remote
 		return c.Reload()
 	}
-	// trying to use cache
-	err = c.loadLocal()
-	if err != nil {
-		// if it failed, trying to get data from remote
-		return c.loadRemote()
+	if c.cacheExpired() && !c.offline {
+		term.Warnf("Cache is expired, refreshing in background\n")
+		go c.refresh()
 	}
 	return nil
 }
 
+// refresh loads data from HTTP(S) in background and notifies
+// the store if the data has been updated. If the API is not available
+// the stale cache remains in use.
+func (c *Conductor) refresh() {
+	log.Debugf("Cache %s is expired, refreshing in background", c.cacheFilename())
+	lc, err := c.fetchRemote()
+	if err != nil {
+		term.Warnf("\nError refreshing data from %s: %s\n", c.url, err)
+		term.Warnf("Stale cache is still in use, you may try to reload it manually\n")
+		return
+	}
+
+	err = c.saveCache(lc)
+	if err != nil {
+		log.Debugf("Error saving cache: %s", err)
+	}
+	c.extractCache(lc)
+	log.Debug("Background refresh finished")
+	c.lock.Lock()
+	handler := c.onUpdate
+	c.lock.Unlock()
+	if handler != nil {
+		handler()
+	}
+}
+
 func (c *Conductor) loadLocal() error {
 	data, err := ioutil.ReadFile(c.cacheFilename())
 	if err != nil {
@@ -109,13 +173,44 @@ func (c *Conductor) loadLocal() error {
 	return nil
 }
 
+// SetOffline sets offline mode, i.e. using cache only
+func (c *Conductor) SetOffline(offline bool) {
+	c.offline = offline
+}
+
+// Offline returns true if the backend is in offline mode
+func (c *Conductor) Offline() bool {
+	return c.offline
+}
+
+// CacheInfo returns the cache file information
+func (c *Conductor) CacheInfo() *store.CacheInfo {
+	ci := &store.CacheInfo{
+		Filename: c.cacheFilename(),
+		TTL:      c.cacheTTL,
+	}
+	st, err := os.Stat(ci.Filename)
+	if err == nil {
+		ci.Exists = true
+		ci.ModTime = st.ModTime()
+	}
+	return ci
+}
+
+// PurgeCache removes the cache file
+func (c *Conductor) PurgeCache() error {
+	err := os.Remove(c.cacheFilename())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
 func (c *Conductor) cacheExpired() bool {
 	st, err := os.Stat(c.cacheFilename())
 	if err != nil {
-		if os.IsNotExist(err) {
-			// no cache in general means that it's been expired
-			return true
-		}
+		// no cache in general means that it's been expired
+		return true
 	}
 	modifiedAt := st.ModTime()
 	return modifiedAt.Add(c.cacheTTL).Before(time.Now())
@@ -134,7 +229,7 @@ func (c *Conductor) cacheFilename() string {
 
 func (c *Conductor) saveCache(lc *cache) error {
 	_, err := os.Stat(c.cacheDir)
-	if err != nil && os.IsNotExist(err) {
+	if os.IsNotExist(err) {
 		err = os.MkdirAll(c.cacheDir, 0755)
 		if err != nil {
 			return fmt.Errorf("Error creating cache dir: %s", err)
@@ -154,6 +249,9 @@ func (c *Conductor) saveCache(lc *cache) error {
 }
 
 func (c *Conductor) extractCache(lc *cache) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
 	c.datacenters = make([]*store.Datacenter, 0)
 	c.workgroups = make([]*store.WorkGroup, 0)
 	c.groups = make([]*store.Group, 0)
@@ -203,46 +301,38 @@ func (c *Conductor) extractCache(lc *cache) {
 }
 
 func (c *Conductor) httpGet(path string) ([]byte, error) {
-	client := &http.Client{}
-
-	url := fmt.Sprintf("%s%s", c.url, path)
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, err
-	}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("Status code %d while fetching %s", resp.StatusCode, url)
-	}
-
-	return ioutil.ReadAll(resp.Body)
+	return c.client.Get(c.url + path)
 }
 
-func (c *Conductor) loadRemote() error {
-	var data []byte
-	var err error
-
-	term.Warnf("Loading executer data...\n")
+func (c *Conductor) fetchRemote() (*cache, error) {
 	path := "/api/v1/open/executer_data"
 	if len(c.workgroupNames) > 0 {
 		wglist := strings.Join(c.workgroupNames, ",")
 		path += fmt.Sprintf("?work_groups=%s", wglist)
 	}
-	data, err = c.httpGet(path)
+	data, err := c.httpGet(path)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	apiResponse := new(api)
 	err = json.Unmarshal(data, apiResponse)
+	if err != nil {
+		return nil, err
+	}
+	if apiResponse.Data == nil {
+		return nil, fmt.Errorf("Empty executer data received from %s", c.url)
+	}
+	return apiResponse.Data, nil
+}
+
+func (c *Conductor) loadRemote() error {
+	term.Warnf("Loading executer data...\n")
+	lc, err := c.fetchRemote()
 	if err != nil {
 		return err
 	}
 
-	lc := apiResponse.Data
 	err = c.saveCache(lc)
 	if err != nil {
 		term.Errorf("Error saving cacne: %s\n", err)
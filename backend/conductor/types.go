@@ -1,8 +1,10 @@
 package conductor
 
 import (
+	"sync"
 	"time"
 
+	"github.com/viert/xc/backend/httpclient"
 	"github.com/viert/xc/store"
 )
 
@@ -12,10 +14,14 @@ type Conductor struct {
 	cacheTTL       time.Duration
 	cacheDir       string
 	url            string
+	client         *httpclient.Client
 	hosts          []*store.Host
 	groups         []*store.Group
 	workgroups     []*store.WorkGroup
 	datacenters    []*store.Datacenter
+	offline        bool
+	lock           sync.Mutex
+	onUpdate       func()
 }
 
 type datacenter struct {
@@ -0,0 +1,313 @@
+package consul
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/viert/xc/backend"
+	"github.com/viert/xc/backend/httpclient"
+	"github.com/viert/xc/config"
+	"github.com/viert/xc/store"
+	"github.com/viert/xc/stringslice"
+	"github.com/viert/xc/term"
+)
+
+const (
+	defaultWorkGroup  = "consul"
+	defaultAuthHeader = "X-Consul-Token"
+)
+
+var (
+	splitExpr           = regexp.MustCompile(`\s*,\s*`)
+	defaultSkipServices = []string{"consul"}
+)
+
+func init() {
+	backend.Register("consul", func(cfg *config.XCConfig) (store.Backend, error) {
+		return New(cfg)
+	})
+}
+
+// New creates a new instance of Consul backend
+func New(cfg *config.XCConfig) (*Consul, error) {
+	c := &Consul{
+		workgroupName: defaultWorkGroup,
+		skipServices:  defaultSkipServices,
+	}
+
+	options := cfg.BackendCfg.Options
+
+	if value, found := options["filename"]; found && value != "" {
+		for _, fn := range splitExpr.Split(value, -1) {
+			c.filenames = append(c.filenames, config.ExpandPath(fn))
+		}
+	}
+	c.url = strings.TrimRight(options["url"], "/")
+
+	if len(c.filenames) == 0 && c.url == "" {
+		return nil, fmt.Errorf("consul backend requires either filename or url option")
+	}
+
+	if c.url != "" {
+		httpOptions := make(map[string]string)
+		for key, value := range options {
+			httpOptions[key] = value
+		}
+		if httpOptions["auth_header"] == "" {
+			httpOptions["auth_header"] = defaultAuthHeader
+		}
+		var err error
+		c.client, err = httpclient.New(httpOptions)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if value, found := options["datacenters"]; found && value != "" {
+		c.dcNames = splitExpr.Split(value, -1)
+	}
+	if value, found := options["workgroup"]; found && value != "" {
+		c.workgroupName = value
+	}
+	if value, found := options["skip_services"]; found {
+		c.skipServices = make([]string, 0)
+		if value != "" {
+			c.skipServices = splitExpr.Split(value, -1)
+		}
+	}
+	if value, found := options["domain"]; found && value != "" {
+		c.domain = "." + strings.TrimLeft(value, ".")
+	}
+
+	return c, nil
+}
+
+// Hosts exported backend method
+func (c *Consul) Hosts() []*store.Host {
+	return c.hosts
+}
+
+// Groups exported backend method
+func (c *Consul) Groups() []*store.Group {
+	return c.groups
+}
+
+// WorkGroups exported backend method
+func (c *Consul) WorkGroups() []*store.WorkGroup {
+	return c.workgroups
+}
+
+// Datacenters exported backend method
+func (c *Consul) Datacenters() []*store.Datacenter {
+	return c.datacenters
+}
+
+// Load loads catalog data from files and/or the consul agent
+func (c *Consul) Load() error {
+	ct := new(catalog)
+
+	for _, filename := range c.filenames {
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+		fc := new(catalog)
+		err = json.Unmarshal(data, fc)
+		if err != nil {
+			return fmt.Errorf("Error parsing %s: %s", filename, err)
+		}
+		ct.Nodes = append(ct.Nodes, fc.Nodes...)
+		ct.Services = append(ct.Services, fc.Services...)
+	}
+
+	if c.url != "" {
+		term.Warnf("Loading consul catalog...")
+		rc, err := c.loadRemote()
+		if err != nil {
+			term.Errorf("\n")
+			return err
+		}
+		term.Warnf("%d nodes loaded\n", len(rc.Nodes))
+		ct.Nodes = append(ct.Nodes, rc.Nodes...)
+		ct.Services = append(ct.Services, rc.Services...)
+	}
+
+	c.extract(ct)
+	return nil
+}
+
+// Reload forces reloading data from files and/or the consul agent
+func (c *Consul) Reload() error {
+	return c.Load()
+}
+
+func (c *Consul) get(path string, dc string, v interface{}) error {
+	data, err := c.client.Get(fmt.Sprintf("%s%s?dc=%s", c.url, path, url.QueryEscape(dc)))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func (c *Consul) loadRemote() (*catalog, error) {
+	ct := new(catalog)
+
+	dcNames := c.dcNames
+	if len(dcNames) == 0 {
+		data, err := c.client.Get(c.url + "/v1/catalog/datacenters")
+		if err != nil {
+			return nil, err
+		}
+		err = json.Unmarshal(data, &dcNames)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, dc := range dcNames {
+		var nodes []*node
+		err := c.get("/v1/catalog/nodes", dc, &nodes)
+		if err != nil {
+			return nil, err
+		}
+		ct.Nodes = append(ct.Nodes, nodes...)
+
+		var serviceNames map[string][]string
+		err = c.get("/v1/catalog/services", dc, &serviceNames)
+		if err != nil {
+			return nil, err
+		}
+
+		for name := range serviceNames {
+			if stringslice.Contains(c.skipServices, name) {
+				continue
+			}
+			var services []*service
+			err = c.get("/v1/catalog/service/"+url.PathEscape(name), dc, &services)
+			if err != nil {
+				return nil, err
+			}
+			ct.Services = append(ct.Services, services...)
+		}
+	}
+
+	return ct, nil
+}
+
+// nodeKey identifies a node, node names are unique only within a datacenter
+func nodeKey(dc string, name string) string {
+	return dc + "/" + name
+}
+
+func metaTags(meta map[string]string) []string {
+	tags := make([]string, 0, len(meta))
+	for key, value := range meta {
+		tags = append(tags, key+"="+value)
+	}
+	return tags
+}
+
+func (c *Consul) extract(ct *catalog) {
+	c.datacenters = make([]*store.Datacenter, 0)
+	c.workgroups = make([]*store.WorkGroup, 0)
+	c.groups = make([]*store.Group, 0)
+	c.hosts = make([]*store.Host, 0)
+
+	dcs := make(map[string]*store.Datacenter)
+	groups := make(map[string]*store.Group)
+	hosts := make(map[string]*store.Host)
+	// node key -> names of the services it provides
+	nodeServices := make(map[string][]string)
+
+	c.workgroups = append(c.workgroups, &store.WorkGroup{
+		ID:   c.workgroupName,
+		Name: c.workgroupName,
+	})
+
+	addHost := func(dc string, name string, id string, address string, meta map[string]string) *store.Host {
+		key := nodeKey(dc, name)
+		host, found := hosts[key]
+		if found {
+			return host
+		}
+		if id == "" {
+			id = key
+		}
+		host = &store.Host{
+			ID:           id,
+			FQDN:         name + c.domain,
+			Address:      address,
+			DatacenterID: dc,
+			Aliases:      make([]string, 0),
+			Tags:         metaTags(meta),
+		}
+		if c.domain != "" {
+			host.Aliases = append(host.Aliases, name)
+		}
+		if dc != "" {
+			if _, found := dcs[dc]; !found {
+				dcs[dc] = &store.Datacenter{ID: dc, Name: dc}
+			}
+		}
+		hosts[key] = host
+		c.hosts = append(c.hosts, host)
+		return host
+	}
+
+	for _, n := range ct.Nodes {
+		addHost(n.Datacenter, n.Node, n.ID, n.Address, n.Meta)
+	}
+
+	for _, svc := range ct.Services {
+		if svc.ServiceName == "" || stringslice.Contains(c.skipServices, svc.ServiceName) {
+			continue
+		}
+		// nodes are normally loaded already, this is just in case the dump has no nodes list
+		addHost(svc.Datacenter, svc.Node, svc.ID, svc.Address, svc.NodeMeta)
+
+		group, found := groups[svc.ServiceName]
+		if !found {
+			group = &store.Group{
+				ID:          svc.ServiceName,
+				Name:        svc.ServiceName,
+				WorkGroupID: c.workgroupName,
+				Tags:        make([]string, 0),
+			}
+			groups[svc.ServiceName] = group
+			c.groups = append(c.groups, group)
+		}
+		for _, tag := range svc.ServiceTags {
+			if !stringslice.Contains(group.Tags, tag) {
+				group.Tags = append(group.Tags, tag)
+			}
+		}
+
+		key := nodeKey(svc.Datacenter, svc.Node)
+		if !stringslice.Contains(nodeServices[key], svc.ServiceName) {
+			nodeServices[key] = append(nodeServices[key], svc.ServiceName)
+		}
+	}
+
+	// A host may belong to one group only, so the first service (in alphabetical order)
+	// becomes its group while all the services are reflected in "service=<name>" tags
+	for key, services := range nodeServices {
+		host := hosts[key]
+		sort.Strings(services)
+		host.GroupID = services[0]
+		for _, name := range services {
+			host.Tags = append(host.Tags, "service="+name)
+		}
+	}
+
+	for _, host := range c.hosts {
+		sort.Strings(host.Tags)
+	}
+	for _, dc := range dcs {
+		c.datacenters = append(c.datacenters, dc)
+	}
+}
@@ -0,0 +1,131 @@
+package consul
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/viert/xc/config"
+	"github.com/viert/xc/store"
+	"github.com/viert/xc/stringslice"
+)
+
+var testResponses = map[string]string{
+	"/v1/catalog/datacenters": `["dc1"]`,
+	"/v1/catalog/nodes": `[
+		{"ID": "n1", "Node": "web1", "Address": "10.0.0.1", "Datacenter": "dc1", "Meta": {"env": "prod"}},
+		{"ID": "n2", "Node": "web2", "Address": "10.0.0.2", "Datacenter": "dc1", "Meta": {}},
+		{"ID": "n3", "Node": "bare", "Address": "10.0.0.3", "Datacenter": "dc1"}
+	]`,
+	"/v1/catalog/services": `{"consul": [], "web": ["http"], "metrics": []}`,
+	"/v1/catalog/service/web": `[
+		{"Node": "web1", "Datacenter": "dc1", "ServiceName": "web", "ServiceTags": ["http"]},
+		{"Node": "web2", "Datacenter": "dc1", "ServiceName": "web", "ServiceTags": ["http", "canary"]}
+	]`,
+	"/v1/catalog/service/metrics": `[
+		{"Node": "web1", "Datacenter": "dc1", "ServiceName": "metrics"}
+	]`,
+}
+
+func newConsul(t *testing.T, options map[string]string) *Consul {
+	cfg := &config.XCConfig{BackendCfg: &config.BackendConfig{Options: options}}
+	c, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func findHost(hosts []*store.Host, fqdn string) *store.Host {
+	for _, host := range hosts {
+		if host.FQDN == fqdn {
+			return host
+		}
+	}
+	return nil
+}
+
+func TestLoadRemote(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/catalog/datacenters" && r.URL.Query().Get("dc") != "dc1" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if r.Header.Get("X-Consul-Token") != "secret" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		resp, found := testResponses[r.URL.Path]
+		if !found {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, resp)
+	}))
+	defer srv.Close()
+
+	c := newConsul(t, map[string]string{"url": srv.URL, "auth_token": "secret", "domain": "example.com"})
+	err := c.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(c.Hosts()) != 3 || len(c.Groups()) != 2 || len(c.Datacenters()) != 1 {
+		t.Fatalf("unexpected number of objects: %d hosts, %d groups, %d datacenters",
+			len(c.Hosts()), len(c.Groups()), len(c.Datacenters()))
+	}
+
+	web1 := findHost(c.Hosts(), "web1.example.com")
+	if web1 == nil {
+		t.Fatal("web1.example.com not found")
+	}
+	// metrics < web, so metrics is the main group
+	if web1.GroupID != "metrics" || web1.DatacenterID != "dc1" {
+		t.Errorf("unexpected web1 group %s and datacenter %s", web1.GroupID, web1.DatacenterID)
+	}
+	for _, tag := range []string{"env=prod", "service=metrics", "service=web"} {
+		if !stringslice.Contains(web1.Tags, tag) {
+			t.Errorf("web1 is expected to have tag %s, got %v", tag, web1.Tags)
+		}
+	}
+	if !stringslice.Contains(web1.Aliases, "web1") {
+		t.Errorf("short node name is expected to be an alias, got %v", web1.Aliases)
+	}
+
+	bare := findHost(c.Hosts(), "bare.example.com")
+	if bare == nil || bare.GroupID != "" {
+		t.Errorf("node without services is expected to have no group")
+	}
+
+	for _, group := range c.Groups() {
+		if group.Name == "web" && len(group.Tags) != 2 {
+			t.Errorf("web group is expected to have service tags http and canary, got %v", group.Tags)
+		}
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "xc-consul")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	fmt.Fprintf(f, `{"nodes": %s, "services": %s}`, testResponses["/v1/catalog/nodes"], testResponses["/v1/catalog/service/web"])
+	f.Close()
+
+	c := newConsul(t, map[string]string{"filename": f.Name()})
+	err = c.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(c.Hosts()) != 3 || len(c.Groups()) != 1 {
+		t.Fatalf("unexpected number of objects: %d hosts, %d groups", len(c.Hosts()), len(c.Groups()))
+	}
+	if findHost(c.Hosts(), "web2").GroupID != "web" {
+		t.Errorf("web2 is expected to be in web group")
+	}
+}
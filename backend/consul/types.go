@@ -0,0 +1,47 @@
+package consul
+
+import (
+	"github.com/viert/xc/backend/httpclient"
+	"github.com/viert/xc/store"
+)
+
+// Consul is a backend based on Consul catalog data
+type Consul struct {
+	filenames     []string
+	url           string
+	client        *httpclient.Client
+	dcNames       []string
+	workgroupName string
+	domain        string
+	skipServices  []string
+	hosts         []*store.Host
+	groups        []*store.Group
+	workgroups    []*store.WorkGroup
+	datacenters   []*store.Datacenter
+}
+
+type node struct {
+	ID         string            `json:"ID"`
+	Node       string            `json:"Node"`
+	Address    string            `json:"Address"`
+	Datacenter string            `json:"Datacenter"`
+	Meta       map[string]string `json:"Meta"`
+}
+
+type service struct {
+	ID          string            `json:"ID"`
+	Node        string            `json:"Node"`
+	Address     string            `json:"Address"`
+	Datacenter  string            `json:"Datacenter"`
+	NodeMeta    map[string]string `json:"NodeMeta"`
+	ServiceID   string            `json:"ServiceID"`
+	ServiceName string            `json:"ServiceName"`
+	ServiceTags []string          `json:"ServiceTags"`
+}
+
+// catalog is the format of dump files, i.e. the output of
+// /v1/catalog/nodes and all the /v1/catalog/service/<name> combined
+type catalog struct {
+	Nodes    []*node    `json:"nodes"`
+	Services []*service `json:"services"`
+}
@@ -0,0 +1,330 @@
+package ec2
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/viert/xc/backend"
+	"github.com/viert/xc/backend/httpclient"
+	"github.com/viert/xc/config"
+	"github.com/viert/xc/store"
+	"github.com/viert/xc/term"
+)
+
+const (
+	defaultGroupTag  = "Name"
+	defaultParentTag = "role"
+	defaultWorkGroup = "devops"
+	defaultHostField = "PublicDnsName"
+)
+
+var (
+	groupNameExpr = regexp.MustCompile(`[\s-]+`)
+	hostFields    = []string{"PublicDnsName", "PrivateDnsName", "PublicIpAddress", "PrivateIpAddress"}
+)
+
+func init() {
+	backend.Register("ec2", func(cfg *config.XCConfig) (store.Backend, error) {
+		return New(cfg)
+	})
+}
+
+// New creates a new instance of EC2 backend
+func New(cfg *config.XCConfig) (*EC2, error) {
+	e := &EC2{
+		groupTag:      defaultGroupTag,
+		parentTag:     defaultParentTag,
+		workgroupName: defaultWorkGroup,
+		hostField:     defaultHostField,
+	}
+
+	options := cfg.BackendCfg.Options
+
+	fnString, found := options["filename"]
+	if found && fnString != "" {
+		splitExpr := regexp.MustCompile(`\s*,\s*`)
+		for _, fn := range splitExpr.Split(fnString, -1) {
+			e.filenames = append(e.filenames, config.ExpandPath(fn))
+		}
+	}
+	e.url = options["url"]
+
+	if len(e.filenames) == 0 && e.url == "" {
+		return nil, fmt.Errorf("ec2 backend requires either filename or url option")
+	}
+
+	if e.url != "" {
+		var err error
+		e.client, err = httpclient.New(options)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if value, found := options["group_tag"]; found && value != "" {
+		e.groupTag = value
+	}
+	if value, found := options["parent_tag"]; found {
+		e.parentTag = value
+	}
+	if value, found := options["workgroup"]; found && value != "" {
+		e.workgroupName = value
+	}
+
+	if value, found := options["host_field"]; found && value != "" {
+		valid := false
+		for _, hf := range hostFields {
+			if value == hf {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return nil, fmt.Errorf("invalid host_field \"%s\", expected one of %s", value, strings.Join(hostFields, ", "))
+		}
+		e.hostField = value
+	}
+
+	value := options["include_stopped"]
+	e.includeStopped = value == "true" || value == "yes" || value == "1"
+
+	return e, nil
+}
+
+// Hosts exported backend method
+func (e *EC2) Hosts() []*store.Host {
+	return e.hosts
+}
+
+// Groups exported backend method
+func (e *EC2) Groups() []*store.Group {
+	return e.groups
+}
+
+// WorkGroups exported backend method
+func (e *EC2) WorkGroups() []*store.WorkGroup {
+	return e.workgroups
+}
+
+// Datacenters exported backend method
+func (e *EC2) Datacenters() []*store.Datacenter {
+	return e.datacenters
+}
+
+// Load loads instances data from files and/or the endpoint
+func (e *EC2) Load() error {
+	instances := make([]*instance, 0)
+
+	for _, filename := range e.filenames {
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+		di := new(describeInstances)
+		err = json.Unmarshal(data, di)
+		if err != nil {
+			return fmt.Errorf("Error parsing %s: %s", filename, err)
+		}
+		instances = append(instances, di.instances()...)
+	}
+
+	if e.url != "" {
+		term.Warnf("Loading instances...")
+		remote, err := e.loadRemote()
+		if err != nil {
+			term.Errorf("\n")
+			return err
+		}
+		term.Warnf("%d loaded\n", len(remote))
+		instances = append(instances, remote...)
+	}
+
+	e.extract(instances)
+	return nil
+}
+
+// Reload forces reloading data from files and/or the endpoint
+func (e *EC2) Reload() error {
+	return e.Load()
+}
+
+func (di *describeInstances) instances() []*instance {
+	instances := make([]*instance, 0)
+	for _, rsv := range di.Reservations {
+		instances = append(instances, rsv.Instances...)
+	}
+	return instances
+}
+
+func (e *EC2) loadRemote() ([]*instance, error) {
+	instances := make([]*instance, 0)
+	nextToken := ""
+
+	for {
+		u, err := url.Parse(e.url)
+		if err != nil {
+			return nil, err
+		}
+		if nextToken != "" {
+			q := u.Query()
+			q.Set("NextToken", nextToken)
+			u.RawQuery = q.Encode()
+		}
+
+		data, err := e.client.Get(u.String())
+		if err != nil {
+			return nil, err
+		}
+
+		di := new(describeInstances)
+		err = json.Unmarshal(data, di)
+		if err != nil {
+			return nil, err
+		}
+		instances = append(instances, di.instances()...)
+
+		if di.NextToken == "" || di.NextToken == nextToken {
+			break
+		}
+		nextToken = di.NextToken
+	}
+	return instances, nil
+}
+
+func (e *EC2) hostname(inst *instance) string {
+	switch e.hostField {
+	case "PrivateDnsName":
+		return inst.PrivateDNSName
+	case "PublicIpAddress":
+		return inst.PublicIPAddress
+	case "PrivateIpAddress":
+		return inst.PrivateIPAddress
+	default:
+		return inst.PublicDNSName
+	}
+}
+
+// tagName makes a group or tag name out of an EC2 tag the same way
+// the former xcAwsInventory.py script did, i.e. Name=web-1 becomes tag_Name_web_1
+func tagName(t tag) string {
+	return groupNameExpr.ReplaceAllString("tag_"+t.Key+"_"+t.Value, "_")
+}
+
+// regionName returns the region of a given availability zone
+func regionName(az string) string {
+	if len(az) > 0 && az[len(az)-1] >= 'a' && az[len(az)-1] <= 'z' {
+		return az[:len(az)-1]
+	}
+	return az
+}
+
+func (e *EC2) extract(instances []*instance) {
+	e.datacenters = make([]*store.Datacenter, 0)
+	e.workgroups = make([]*store.WorkGroup, 0)
+	e.groups = make([]*store.Group, 0)
+	e.hosts = make([]*store.Host, 0)
+
+	dcs := make(map[string]*store.Datacenter)
+	groups := make(map[string]*store.Group)
+	hosts := make(map[string]bool)
+
+	e.workgroups = append(e.workgroups, &store.WorkGroup{
+		ID:   e.workgroupName,
+		Name: e.workgroupName,
+	})
+
+	addGroup := func(name string) *store.Group {
+		group, found := groups[name]
+		if !found {
+			group = &store.Group{
+				ID:          name,
+				Name:        name,
+				WorkGroupID: e.workgroupName,
+				Tags:        make([]string, 0),
+			}
+			groups[name] = group
+		}
+		return group
+	}
+
+	for _, inst := range instances {
+		if !e.includeStopped && inst.State.Name != "running" {
+			continue
+		}
+
+		hostname := e.hostname(inst)
+		if hostname == "" {
+			term.Warnf("Instance %s has no %s, skipping\n", inst.InstanceID, e.hostField)
+			continue
+		}
+		if hosts[hostname] {
+			continue
+		}
+		hosts[hostname] = true
+
+		host := &store.Host{
+			ID:          inst.InstanceID,
+			FQDN:        hostname,
+			Description: inst.InstanceType,
+			Aliases:     make([]string, 0),
+			Tags:        make([]string, 0),
+		}
+		if host.ID == "" {
+			host.ID = hostname
+		} else {
+			host.Aliases = append(host.Aliases, inst.InstanceID)
+		}
+
+		az := inst.Placement.AvailabilityZone
+		if az != "" {
+			region := regionName(az)
+			if _, found := dcs[region]; !found && region != az {
+				dcs[region] = &store.Datacenter{ID: region, Name: region}
+			}
+			if _, found := dcs[az]; !found {
+				dc := &store.Datacenter{ID: az, Name: az}
+				if region != az {
+					dc.ParentID = region
+				}
+				dcs[az] = dc
+			}
+			host.DatacenterID = az
+		}
+
+		var group, parent *store.Group
+		for _, t := range inst.Tags {
+			switch t.Key {
+			case e.groupTag:
+				group = addGroup(tagName(t))
+			case e.parentTag:
+				parent = addGroup(tagName(t))
+			default:
+				host.Tags = append(host.Tags, tagName(t))
+			}
+		}
+
+		if group != nil {
+			if parent != nil && parent != group {
+				group.ParentID = parent.ID
+			}
+			host.GroupID = group.ID
+		} else if parent != nil {
+			host.GroupID = parent.ID
+		}
+
+		sort.Strings(host.Tags)
+		e.hosts = append(e.hosts, host)
+	}
+
+	for _, dc := range dcs {
+		e.datacenters = append(e.datacenters, dc)
+	}
+	for _, group := range groups {
+		e.groups = append(e.groups, group)
+	}
+}
@@ -0,0 +1,96 @@
+package ec2
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/viert/xc/config"
+)
+
+const testPage1 = `{
+	"Reservations": [{
+		"Instances": [{
+			"InstanceId": "i-1",
+			"PublicDnsName": "web1.example.com",
+			"Placement": {"AvailabilityZone": "us-east-1a"},
+			"State": {"Name": "running"},
+			"Tags": [{"Key": "Name", "Value": "web"}, {"Key": "role", "Value": "front-end"}, {"Key": "env", "Value": "prod"}]
+		}, {
+			"InstanceId": "i-2",
+			"PublicDnsName": "web2.example.com",
+			"Placement": {"AvailabilityZone": "us-east-1b"},
+			"State": {"Name": "stopped"},
+			"Tags": [{"Key": "Name", "Value": "web"}]
+		}]
+	}],
+	"NextToken": "page2"
+}`
+
+const testPage2 = `{
+	"Reservations": [{
+		"Instances": [{
+			"InstanceId": "i-3",
+			"PublicDnsName": "db1.example.com",
+			"Placement": {"AvailabilityZone": "eu-west-1c"},
+			"State": {"Name": "running"},
+			"Tags": [{"Key": "Name", "Value": "db"}]
+		}]
+	}]
+}`
+
+func TestLoadRemote(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("NextToken") == "page2" {
+			fmt.Fprint(w, testPage2)
+			return
+		}
+		fmt.Fprint(w, testPage1)
+	}))
+	defer srv.Close()
+
+	cfg := &config.XCConfig{
+		BackendCfg: &config.BackendConfig{
+			Options: map[string]string{"url": srv.URL},
+		},
+	}
+
+	e, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = e.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(e.Hosts()) != 2 {
+		t.Fatalf("expected 2 running hosts, got %d", len(e.Hosts()))
+	}
+
+	web := e.Hosts()[0]
+	if web.FQDN != "web1.example.com" || web.GroupID != "tag_Name_web" || web.DatacenterID != "us-east-1a" {
+		t.Errorf("unexpected host data %+v", web)
+	}
+	if len(web.Tags) != 1 || web.Tags[0] != "tag_env_prod" {
+		t.Errorf("expected host tags [tag_env_prod], got %v", web.Tags)
+	}
+
+	groups := make(map[string]string)
+	for _, g := range e.Groups() {
+		groups[g.Name] = g.ParentID
+	}
+	if parent, found := groups["tag_Name_web"]; !found || parent != "tag_role_front_end" {
+		t.Errorf("tag_Name_web group is expected to have parent tag_role_front_end, got %v", groups)
+	}
+
+	dcs := make(map[string]string)
+	for _, dc := range e.Datacenters() {
+		dcs[dc.Name] = dc.ParentID
+	}
+	if len(dcs) != 4 || dcs["us-east-1a"] != "us-east-1" || dcs["eu-west-1c"] != "eu-west-1" {
+		t.Errorf("unexpected datacenters %v", dcs)
+	}
+}
@@ -0,0 +1,56 @@
+package ec2
+
+import (
+	"github.com/viert/xc/backend/httpclient"
+	"github.com/viert/xc/store"
+)
+
+// EC2 is a backend based on EC2 DescribeInstances data
+type EC2 struct {
+	filenames      []string
+	url            string
+	client         *httpclient.Client
+	groupTag       string
+	parentTag      string
+	workgroupName  string
+	hostField      string
+	includeStopped bool
+	hosts          []*store.Host
+	groups         []*store.Group
+	workgroups     []*store.WorkGroup
+	datacenters    []*store.Datacenter
+}
+
+type tag struct {
+	Key   string `json:"Key"`
+	Value string `json:"Value"`
+}
+
+type placement struct {
+	AvailabilityZone string `json:"AvailabilityZone"`
+}
+
+type state struct {
+	Name string `json:"Name"`
+}
+
+type instance struct {
+	InstanceID       string    `json:"InstanceId"`
+	InstanceType     string    `json:"InstanceType"`
+	PrivateDNSName   string    `json:"PrivateDnsName"`
+	PublicDNSName    string    `json:"PublicDnsName"`
+	PrivateIPAddress string    `json:"PrivateIpAddress"`
+	PublicIPAddress  string    `json:"PublicIpAddress"`
+	Placement        placement `json:"Placement"`
+	State            state     `json:"State"`
+	Tags             []tag     `json:"Tags"`
+}
+
+type reservation struct {
+	Instances []*instance `json:"Instances"`
+}
+
+type describeInstances struct {
+	Reservations []*reservation `json:"Reservations"`
+	NextToken    string         `json:"NextToken"`
+}
@@ -0,0 +1,228 @@
+package external
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/viert/xc/backend"
+	"github.com/viert/xc/config"
+	"github.com/viert/xc/store"
+	"github.com/viert/xc/term"
+)
+
+const (
+	defaultTimeout = 60 * time.Second
+)
+
+func init() {
+	backend.Register("external", func(cfg *config.XCConfig) (store.Backend, error) {
+		return New(cfg)
+	})
+}
+
+// New creates a new instance of external backend
+func New(cfg *config.XCConfig) (*External, error) {
+	options := cfg.BackendCfg.Options
+
+	command, found := options["command"]
+	if !found || command == "" {
+		return nil, fmt.Errorf("external backend command option is missing")
+	}
+
+	e := &External{
+		command: command,
+		timeout: defaultTimeout,
+		env:     make([]string, 0),
+	}
+
+	for key, value := range options {
+		switch key {
+		case "command":
+		case "timeout":
+			secs, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || secs <= 0 {
+				return nil, fmt.Errorf("Invalid timeout value \"%s\"", value)
+			}
+			e.timeout = time.Duration(secs) * time.Second
+		default:
+			// the rest of the options are passed to the command via environment
+			e.env = append(e.env, fmt.Sprintf("XC_BACKEND_%s=%s", strings.ToUpper(key), value))
+		}
+	}
+
+	return e, nil
+}
+
+// Hosts exported backend method
+func (e *External) Hosts() []*store.Host {
+	return e.hosts
+}
+
+// Groups exported backend method
+func (e *External) Groups() []*store.Group {
+	return e.groups
+}
+
+// WorkGroups exported backend method
+func (e *External) WorkGroups() []*store.WorkGroup {
+	return e.workgroups
+}
+
+// Datacenters exported backend method
+func (e *External) Datacenters() []*store.Datacenter {
+	return e.datacenters
+}
+
+// Load runs the command and loads the data it prints
+func (e *External) Load() error {
+	return e.run("load")
+}
+
+// Reload runs the command with XC_ACTION=reload so it can
+// bypass its own caches if there are any
+func (e *External) Reload() error {
+	return e.run("reload")
+}
+
+func (e *External) run(action string) error {
+	term.Warnf("Loading data from %s...", e.command)
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("sh", "-c", e.command)
+	cmd.Env = append(os.Environ(), "XC_ACTION="+action)
+	cmd.Env = append(cmd.Env, e.env...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	// the command runs in its own process group so the processes
+	// it spawns can be killed on timeout along with it
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	err := cmd.Start()
+	if err == nil {
+		done := make(chan error, 1)
+		go func() {
+			done <- cmd.Wait()
+		}()
+
+		select {
+		case err = <-done:
+		case <-time.After(e.timeout):
+			// killing sh only would leave its children holding
+			// stdout open so Wait would block until they exit
+			syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+			<-done
+			term.Errorf("\n")
+			return fmt.Errorf("external backend command timed out after %s", e.timeout)
+		}
+	}
+	if err != nil {
+		term.Errorf("\n")
+		return fmt.Errorf("external backend command failed: %s: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	inv := new(inventory)
+	err = json.Unmarshal(stdout.Bytes(), inv)
+	if err != nil {
+		term.Errorf("\n")
+		return fmt.Errorf("Error parsing external backend output: %s", err)
+	}
+
+	err = e.extract(inv)
+	if err != nil {
+		term.Errorf("\n")
+		return err
+	}
+	term.Warnf("%d hosts loaded\n", len(e.hosts))
+	return nil
+}
+
+func (e *External) extract(inv *inventory) error {
+	datacenters := make([]*store.Datacenter, 0, len(inv.Datacenters))
+	workgroups := make([]*store.WorkGroup, 0, len(inv.WorkGroups))
+	groups := make([]*store.Group, 0, len(inv.Groups))
+	hosts := make([]*store.Host, 0, len(inv.Hosts))
+
+	for _, dc := range inv.Datacenters {
+		if dc.Name == "" {
+			return fmt.Errorf("external backend: datacenter %s has no name", dc.ID)
+		}
+		datacenters = append(datacenters, &store.Datacenter{
+			ID:          idOrName(dc.ID, dc.Name),
+			Name:        dc.Name,
+			Description: dc.Description,
+			ParentID:    dc.ParentID,
+		})
+	}
+
+	for _, wg := range inv.WorkGroups {
+		if wg.Name == "" {
+			return fmt.Errorf("external backend: workgroup %s has no name", wg.ID)
+		}
+		workgroups = append(workgroups, &store.WorkGroup{
+			ID:          idOrName(wg.ID, wg.Name),
+			Name:        wg.Name,
+			Description: wg.Description,
+		})
+	}
+
+	for _, g := range inv.Groups {
+		if g.Name == "" {
+			return fmt.Errorf("external backend: group %s has no name", g.ID)
+		}
+		groups = append(groups, &store.Group{
+			ID:          idOrName(g.ID, g.Name),
+			Name:        g.Name,
+			Description: g.Description,
+			Tags:        nonNil(g.Tags),
+			WorkGroupID: g.WorkGroupID,
+			ParentID:    g.ParentID,
+		})
+	}
+
+	for _, h := range inv.Hosts {
+		if h.FQDN == "" {
+			return fmt.Errorf("external backend: host %s has no fqdn", h.ID)
+		}
+		hosts = append(hosts, &store.Host{
+			ID:           idOrName(h.ID, h.FQDN),
+			FQDN:         h.FQDN,
+			Description:  h.Description,
+			Tags:         nonNil(h.Tags),
+			Aliases:      nonNil(h.Aliases),
+			GroupID:      h.GroupID,
+			DatacenterID: h.DatacenterID,
+			Address:      h.Address,
+			Port:         h.Port,
+			User:         h.User,
+			JumpHost:     h.JumpHost,
+		})
+	}
+
+	e.datacenters = datacenters
+	e.workgroups = workgroups
+	e.groups = groups
+	e.hosts = hosts
+	return nil
+}
+
+// idOrName allows objects to be referenced by name if no id is given
+func idOrName(id string, name string) string {
+	if id == "" {
+		return name
+	}
+	return id
+}
+
+func nonNil(list []string) []string {
+	if list == nil {
+		return make([]string, 0)
+	}
+	return list
+}
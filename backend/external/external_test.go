@@ -0,0 +1,86 @@
+package external
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/viert/xc/config"
+)
+
+const inventoryJSON = `{
+  "datacenters": [{"name": "dc1"}, {"name": "dc1.1", "parent_id": "dc1"}],
+  "workgroups": [{"name": "wg"}],
+  "groups": [{"name": "web", "workgroup_id": "wg", "tags": ["nginx"]}],
+  "hosts": [
+    {"fqdn": "web1.example.com", "group_id": "web", "datacenter_id": "dc1.1", "aliases": ["web1"]},
+    {"id": "h2", "fqdn": "web2.example.com", "group_id": "web", "tags": ["new"]}
+  ]
+}`
+
+func newExternal(t *testing.T, options map[string]string) *External {
+	cfg := &config.XCConfig{BackendCfg: &config.BackendConfig{Type: "external", Options: options}}
+	e, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestLoad(t *testing.T) {
+	e := newExternal(t, map[string]string{
+		"command": "echo \"$XC_BACKEND_INVENTORY\"",
+		// passed to the command via environment
+		"inventory": inventoryJSON,
+	})
+
+	err := e.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(e.Datacenters()) != 2 || len(e.WorkGroups()) != 1 || len(e.Groups()) != 1 || len(e.Hosts()) != 2 {
+		t.Fatalf("unexpected number of objects loaded: %d datacenters, %d workgroups, %d groups, %d hosts",
+			len(e.Datacenters()), len(e.WorkGroups()), len(e.Groups()), len(e.Hosts()))
+	}
+
+	h := e.Hosts()[0]
+	if h.ID != "web1.example.com" || h.GroupID != "web" || h.DatacenterID != "dc1.1" {
+		t.Errorf("host without id must be identified by fqdn, got %+v", h)
+	}
+	if e.Hosts()[1].ID != "h2" {
+		t.Errorf("expected host id h2, got %s", e.Hosts()[1].ID)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	e := newExternal(t, map[string]string{"command": "echo boom >&2; exit 1"})
+	if err := e.Load(); err == nil {
+		t.Error("error expected on command failure")
+	}
+
+	e = newExternal(t, map[string]string{"command": "echo '{\"hosts\": [{\"id\": \"h1\"}]}'"})
+	if err := e.Load(); err == nil {
+		t.Error("error expected for host without fqdn")
+	}
+
+	e = newExternal(t, map[string]string{"command": "echo not json"})
+	if err := e.Load(); err == nil {
+		t.Error("error expected on invalid output")
+	}
+}
+
+func TestLoadTimeout(t *testing.T) {
+	// the background sleep keeps stdout open after sh is killed
+	e := newExternal(t, map[string]string{"command": "sleep 10 & wait"})
+	e.timeout = 500 * time.Millisecond
+
+	start := time.Now()
+	err := e.Load()
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("timeout error expected, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Load returned in %s, the command's children are not killed", elapsed)
+	}
+}
@@ -0,0 +1,62 @@
+package external
+
+import (
+	"time"
+
+	"github.com/viert/xc/store"
+)
+
+// External is a backend running an external executable
+// which prints the inventory data as JSON to stdout
+type External struct {
+	command     string
+	timeout     time.Duration
+	env         []string
+	hosts       []*store.Host
+	groups      []*store.Group
+	workgroups  []*store.WorkGroup
+	datacenters []*store.Datacenter
+}
+
+type datacenter struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	ParentID    string `json:"parent_id"`
+}
+
+type workgroup struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type group struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Tags        []string `json:"tags"`
+	WorkGroupID string   `json:"workgroup_id"`
+	ParentID    string   `json:"parent_id"`
+}
+
+type host struct {
+	ID           string   `json:"id"`
+	FQDN         string   `json:"fqdn"`
+	Description  string   `json:"description"`
+	Tags         []string `json:"tags"`
+	Aliases      []string `json:"aliases"`
+	GroupID      string   `json:"group_id"`
+	DatacenterID string   `json:"datacenter_id"`
+	Address      string   `json:"address"`
+	Port         int      `json:"port"`
+	User         string   `json:"user"`
+	JumpHost     string   `json:"jump_host"`
+}
+
+type inventory struct {
+	Datacenters []*datacenter `json:"datacenters"`
+	WorkGroups  []*workgroup  `json:"workgroups"`
+	Groups      []*group      `json:"groups"`
+	Hosts       []*host       `json:"hosts"`
+}
@@ -0,0 +1,226 @@
+package httpclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/viert/xc/config"
+	"github.com/viert/xc/log"
+	"github.com/viert/xc/term"
+)
+
+const (
+	defaultTimeout    = 30 * time.Second
+	defaultRetries    = 2
+	defaultRetryDelay = time.Second
+	defaultAuthHeader = "X-Api-Auth-Token"
+)
+
+// Client is an HTTP client shared by the API-based backends.
+// It supports timeouts, retries with exponential backoff,
+// client certificates, custom CA bundles and various ways
+// to provide an auth token
+type Client struct {
+	client     *http.Client
+	retries    int
+	retryDelay time.Duration
+	authHeader string
+	authToken  string
+}
+
+// New creates a Client configured with backend options, i.e. timeout,
+// retries, retry_delay, insecure, ca_bundle, client_cert, client_key,
+// auth_header and one of auth_token, auth_token_file or auth_token_command
+func New(options map[string]string) (*Client, error) {
+	var err error
+
+	c := &Client{
+		retries:    defaultRetries,
+		retryDelay: defaultRetryDelay,
+		authHeader: defaultAuthHeader,
+	}
+
+	timeout := defaultTimeout
+	if value, found := options["timeout"]; found && value != "" {
+		timeout, err = parseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid timeout value \"%s\": %s", value, err)
+		}
+	}
+
+	if value, found := options["retries"]; found && value != "" {
+		retries, err := strconv.ParseInt(value, 10, 32)
+		if err != nil || retries < 0 {
+			return nil, fmt.Errorf("Invalid retries value \"%s\"", value)
+		}
+		c.retries = int(retries)
+	}
+
+	if value, found := options["retry_delay"]; found && value != "" {
+		c.retryDelay, err = parseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid retry_delay value \"%s\": %s", value, err)
+		}
+	}
+
+	tlsconf, err := tlsConfig(options)
+	if err != nil {
+		return nil, err
+	}
+
+	c.client = &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: tlsconf,
+		},
+	}
+
+	if value, found := options["auth_header"]; found && value != "" {
+		c.authHeader = value
+	}
+
+	c.authToken, err = authToken(options)
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// parseDuration parses either a number of seconds or a go duration string
+func parseDuration(value string) (time.Duration, error) {
+	secs, err := strconv.ParseFloat(value, 64)
+	if err == nil {
+		return time.Duration(secs * float64(time.Second)), nil
+	}
+	return time.ParseDuration(value)
+}
+
+func isTrue(value string) bool {
+	return value == "true" || value == "yes" || value == "1"
+}
+
+func tlsConfig(options map[string]string) (*tls.Config, error) {
+	rootCAs, _ := x509.SystemCertPool()
+	if rootCAs == nil {
+		rootCAs = x509.NewCertPool()
+	}
+
+	tlsconf := &tls.Config{RootCAs: rootCAs}
+
+	if isTrue(options["insecure"]) {
+		tlsconf.InsecureSkipVerify = true
+		term.Warnf("WARNING: Inventory backend will be accessed in insecure mode\n")
+	}
+
+	if bundle := options["ca_bundle"]; bundle != "" {
+		data, err := ioutil.ReadFile(config.ExpandPath(bundle))
+		if err != nil {
+			return nil, fmt.Errorf("Error reading CA bundle: %s", err)
+		}
+		if !rootCAs.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("No certificates found in CA bundle %s", bundle)
+		}
+	}
+
+	certFile := options["client_cert"]
+	keyFile := options["client_key"]
+	if certFile != "" || keyFile != "" {
+		if keyFile == "" {
+			// the key may be stored in the same PEM file
+			keyFile = certFile
+		}
+		cert, err := tls.LoadX509KeyPair(config.ExpandPath(certFile), config.ExpandPath(keyFile))
+		if err != nil {
+			return nil, fmt.Errorf("Error loading client certificate: %s", err)
+		}
+		tlsconf.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsconf, nil
+}
+
+func authToken(options map[string]string) (string, error) {
+	if token := options["auth_token"]; token != "" {
+		return token, nil
+	}
+
+	if filename := options["auth_token_file"]; filename != "" {
+		data, err := ioutil.ReadFile(config.ExpandPath(filename))
+		if err != nil {
+			return "", fmt.Errorf("Error reading auth token file: %s", err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+
+	if command := options["auth_token_command"]; command != "" {
+		out, err := exec.Command("sh", "-c", command).Output()
+		if err != nil {
+			return "", fmt.Errorf("Error running auth token command: %s", err)
+		}
+		return strings.TrimSpace(string(out)), nil
+	}
+
+	return "", nil
+}
+
+// HasAuthToken returns true if the client has an auth token configured
+func (c *Client) HasAuthToken() bool {
+	return c.authToken != ""
+}
+
+// Get performs a GET request retrying it on network errors and 5xx
+// responses and returns the response body
+func (c *Client) Get(url string) ([]byte, error) {
+	var (
+		data []byte
+		err  error
+	)
+
+	delay := c.retryDelay
+	for attempt := 0; ; attempt++ {
+		var retryable bool
+		data, retryable, err = c.get(url)
+		if err == nil || !retryable || attempt >= c.retries {
+			break
+		}
+		log.Debugf("Error fetching %s: %s, retrying in %s", url, err, delay)
+		time.Sleep(delay)
+		delay *= 2
+	}
+	return data, err
+}
+
+func (c *Client) get(url string) ([]byte, bool, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	if c.authToken != "" {
+		req.Header.Add(c.authHeader, c.authToken)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, resp.StatusCode >= 500, fmt.Errorf("Status code %d while fetching %s", resp.StatusCode, url)
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, true, err
+	}
+	return data, false, nil
+}
@@ -0,0 +1,86 @@
+package httpclient
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestRetries(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		fmt.Fprint(w, "ok")
+	}))
+	defer srv.Close()
+
+	c, err := New(map[string]string{"retries": "2", "retry_delay": "1ms"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := c.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "ok" || requests != 3 {
+		t.Errorf("expected success on the 3rd request, got %q after %d requests", string(data), requests)
+	}
+}
+
+func TestNoRetryOnClientError(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	c, err := New(map[string]string{"retries": "5", "retry_delay": "1ms"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = c.Get(srv.URL)
+	if err == nil {
+		t.Error("error expected on 403 response")
+	}
+	if requests != 1 {
+		t.Errorf("4xx responses must not be retried, got %d requests", requests)
+	}
+}
+
+func TestAuthTokenFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "xc-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("s3cr3t\n")
+	f.Close()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.Header.Get("X-Auth"))
+	}))
+	defer srv.Close()
+
+	c, err := New(map[string]string{"auth_token_file": f.Name(), "auth_header": "X-Auth"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := c.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "s3cr3t" {
+		t.Errorf("expected token to be passed in X-Auth header, got %q", string(data))
+	}
+}
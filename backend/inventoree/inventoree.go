@@ -1,23 +1,44 @@
 package inventoree
 
 import (
-	"crypto/tls"
-	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"net/http"
+	"net/url"
 	"os"
 	"path"
 	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/viert/xc/backend"
+	"github.com/viert/xc/backend/httpclient"
 	"github.com/viert/xc/config"
+	"github.com/viert/xc/log"
 	"github.com/viert/xc/store"
 	"github.com/viert/xc/term"
 )
 
+const (
+	defaultFetchThreads = 8
+)
+
+var (
+	timestampLayouts = []string{
+		time.RFC3339Nano,
+		"2006-01-02T15:04:05.999999999",
+		"2006-01-02 15:04:05.999999999",
+	}
+)
+
+func init() {
+	backend.Register("inventoree", func(cfg *config.XCConfig) (store.Backend, error) {
+		return New(cfg)
+	})
+}
+
 // New creates and cofigures inventoree-based backend
 func New(cfg *config.XCConfig) (*Inventoree, error) {
 	var workgroupNames []string
@@ -38,18 +59,6 @@ func New(cfg *config.XCConfig) (*Inventoree, error) {
 		return nil, fmt.Errorf("Inventoree backend URL is not configured")
 	}
 
-	// insecure configuration
-	insec, found := options["insecure"]
-	if !found {
-		insec = "false"
-	}
-
-	insecure := false
-	if insec == "true" || insec == "yes" || insec == "1" {
-		insecure = true
-		term.Warnf("WARNING: Inventory backend will be accessed in insecure mode\n")
-	}
-
 	// host key field
 	hostKey, found := options["host_key_field"]
 	if !found {
@@ -62,10 +71,28 @@ func New(cfg *config.XCConfig) (*Inventoree, error) {
 		hostKey = "fqdn"
 	}
 
-	// auth configuration
-	authToken, found := options["auth_token"]
-	if !found {
-		return nil, fmt.Errorf("Inventoree auth_token option is missing")
+	// fetch threads configuration
+	fetchThreads := defaultFetchThreads
+	ft, found := options["fetch_threads"]
+	if found && ft != "" {
+		value, err := strconv.ParseInt(ft, 10, 32)
+		if err != nil || value < 1 {
+			return nil, fmt.Errorf("Invalid fetch_threads value \"%s\"", ft)
+		}
+		fetchThreads = int(value)
+	}
+
+	// incremental updates configuration
+	incr := options["incremental"]
+	incremental := incr == "true" || incr == "yes" || incr == "1"
+
+	// http client and auth configuration
+	client, err := httpclient.New(options)
+	if err != nil {
+		return nil, err
+	}
+	if !client.HasAuthToken() {
+		return nil, fmt.Errorf("Inventoree auth_token, auth_token_file or auth_token_command option is missing")
 	}
 
 	return &Inventoree{
@@ -74,33 +101,47 @@ func New(cfg *config.XCConfig) (*Inventoree, error) {
 		cacheDir:       cfg.CacheDir,
 		url:            url,
 		hostKeyField:   hostKey,
-		authToken:      authToken,
-		insecure:       insecure,
+		client:         client,
+		fetchThreads:   fetchThreads,
+		incremental:    incremental,
+		offline:        cfg.Offline,
 	}, nil
 }
 
 // Hosts exported backend method
 func (i *Inventoree) Hosts() []*store.Host {
+	i.lock.Lock()
+	defer i.lock.Unlock()
 	return i.hosts
 }
 
 // Groups exported backend method
 func (i *Inventoree) Groups() []*store.Group {
+	i.lock.Lock()
+	defer i.lock.Unlock()
 	return i.groups
 }
 
 // WorkGroups exported backend method
 func (i *Inventoree) WorkGroups() []*store.WorkGroup {
+	i.lock.Lock()
+	defer i.lock.Unlock()
 	return i.workgroups
 }
 
 // Datacenters exported backend method
 func (i *Inventoree) Datacenters() []*store.Datacenter {
+	i.lock.Lock()
+	defer i.lock.Unlock()
 	return i.datacenters
 }
 
 // Reload forces reloading data from HTTP(S)
 func (i *Inventoree) Reload() error {
+	if i.offline {
+		term.Warnf("Offline mode, reloading data from cache\n")
+		return i.loadLocal()
+	}
 	err := i.loadRemote()
 	if err != nil {
 		term.Errorf("\n%s\n", err)
@@ -111,60 +152,77 @@ func (i *Inventoree) Reload() error {
 	return nil
 }
 
-// Load tries to load data from cache unless it's expired
-// In case of cache expiration or absense it triggers Reload()
+// OnUpdate sets a handler called when data is refreshed in background
+func (i *Inventoree) OnUpdate(handler func()) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	i.onUpdate = handler
+}
+
+// Load loads data from cache, even if it's expired, so xc could
+// start immediately. Expired cache is then refreshed in background.
+// In case of cache absense it triggers Reload()
 func (i *Inventoree) Load() error {
-	var err error
-	if i.cacheExpired() {
+	err := i.loadLocal()
+	if err != nil {
+		if i.offline {
+			return fmt.Errorf("Offline mode, can't load cache %s: %s", i.cacheFilename(), err)
+		}
+		// no usable cache, the data must be loaded from remote
 		return i.Reload()
 	}
-	// trying to use cache
-	err = i.loadLocal()
-	if err != nil {
-		// if it failed, trying to get data from remote
-		return i.loadRemote()
+	if i.cacheExpired() && !i.offline {
+		term.Warnf("Cache is expired, refreshing in background\n")
+		go i.refresh()
 	}
 	return nil
 }
 
-func (i *Inventoree) inventoreeGet(path string) ([]byte, error) {
-	client := &http.Client{}
-
-	if i.insecure {
-		rootCAs, _ := x509.SystemCertPool()
-		tlsconf := &tls.Config{
-			InsecureSkipVerify: true,
-			RootCAs:            rootCAs,
-		}
-		transport := &http.Transport{TLSClientConfig: tlsconf}
-		client.Transport = transport
-	}
-
-	url := fmt.Sprintf("%s%s", i.url, path)
-	req, err := http.NewRequest("GET", url, nil)
+// refresh loads data from HTTP(S) in background and notifies
+// the store if the data has been updated. If the API is not available
+// the stale cache remains in use.
+func (i *Inventoree) refresh() {
+	log.Debugf("Cache %s is expired, refreshing in background", i.cacheFilename())
+	lc, err := i.fetchRemote(false)
 	if err != nil {
-		return nil, err
+		term.Warnf("\nError refreshing data from %s: %s\n", i.url, err)
+		term.Warnf("Stale cache is still in use, you may try to reload it manually\n")
+		return
 	}
-	req.Header.Add("X-Api-Auth-Token", i.authToken)
 
-	resp, err := client.Do(req)
+	err = i.saveCache(lc)
 	if err != nil {
-		return nil, err
+		log.Debugf("Error saving cache: %s", err)
 	}
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("Status code %d while fetching %s", resp.StatusCode, url)
+	i.extractCache(lc)
+	log.Debug("Background refresh finished")
+	i.lock.Lock()
+	handler := i.onUpdate
+	i.lock.Unlock()
+	if handler != nil {
+		handler()
 	}
+}
 
-	return ioutil.ReadAll(resp.Body)
+func (i *Inventoree) inventoreeGet(path string) ([]byte, error) {
+	return i.client.Get(i.url + path)
 }
 
-func (i *Inventoree) loadLocal() error {
+func (i *Inventoree) readCache() (*cache, error) {
 	data, err := ioutil.ReadFile(i.cacheFilename())
 	if err != nil {
-		return err
+		return nil, err
 	}
 	lc := new(cache)
 	err = json.Unmarshal(data, lc)
+	if err != nil {
+		return nil, err
+	}
+	return lc, nil
+}
+
+func (i *Inventoree) loadLocal() error {
+	lc, err := i.readCache()
 	if err != nil {
 		return err
 	}
@@ -174,9 +232,90 @@ func (i *Inventoree) loadLocal() error {
 }
 
 func (i *Inventoree) loadRemote() error {
+	lc, err := i.fetchRemote(true)
+	if err != nil {
+		return err
+	}
+
+	err = i.saveCache(lc)
+	if err != nil {
+		term.Errorf("Error saving cacne: %s\n", err)
+	} else {
+		term.Successf("Cache saved to %s\n", i.cacheFilename())
+	}
+	i.extractCache(lc)
+	return nil
+}
+
+// parallel calls fn for every index in [0, n) running
+// at most fetchThreads calls simultaneously
+func (i *Inventoree) parallel(n int, fn func(idx int)) {
+	var wg sync.WaitGroup
+	sem := make(chan bool, i.fetchThreads)
+	for idx := 0; idx < n; idx++ {
+		wg.Add(1)
+		sem <- true
+		go func(idx int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			fn(idx)
+		}(idx)
+	}
+	wg.Wait()
+}
+
+// parseTimestamp parses inventoree timestamps which may come
+// with or without time zone, the latter are considered UTC
+func parseTimestamp(ts string) (time.Time, error) {
+	for _, layout := range timestampLayouts {
+		t, err := time.Parse(layout, ts)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp \"%s\"", ts)
+}
+
+// lastUpdate returns the latest host modification time found in cache
+// as it came from the API to be used in updated_at__gt filter. Timestamps
+// are compared as time values as their string forms may differ in time
+// zone and precision
+func (lc *cache) lastUpdate() string {
+	var last time.Time
+	lastTS := ""
+	for _, h := range lc.Hosts {
+		if h.UpdatedAt == "" {
+			continue
+		}
+		t, err := parseTimestamp(h.UpdatedAt)
+		if err != nil {
+			log.Debugf("Host %s: %s", h.FQDN, err)
+			continue
+		}
+		if t.After(last) {
+			last = t
+			lastTS = h.UpdatedAt
+		}
+	}
+	return lastTS
+}
+
+// fetchRemote loads data from inventoree API. When verbose is false
+// the progress is written to debug log instead of the terminal
+func (i *Inventoree) fetchRemote(verbose bool) (*cache, error) {
 	var data []byte
 	var count int
 	var err error
+	var lock sync.Mutex
+
+	warnf := term.Warnf
+	errorf := term.Errorf
+	if !verbose {
+		warnf = log.Debugf
+		errorf = log.Debugf
+	}
 
 	lc := new(cache)
 	lc.Datacenters = make([]*datacenter, 0)
@@ -184,16 +323,16 @@ func (i *Inventoree) loadRemote() error {
 	lc.WorkGroups = make([]*workgroup, 0)
 	lc.Hosts = make([]*host, 0)
 
-	term.Warnf("Loading datacenters...")
+	warnf("Loading datacenters...")
 	data, err = i.inventoreeGet("/api/v2/datacenters/?_fields=_id,name,description,parent_id&_nopaging=true")
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	dcdata := &apiDatacenters{}
 	err = json.Unmarshal(data, dcdata)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	count = 0
@@ -201,30 +340,30 @@ func (i *Inventoree) loadRemote() error {
 		lc.Datacenters = append(lc.Datacenters, dc)
 		count++
 	}
-	term.Warnf("%d loaded\n", count)
+	warnf("%d loaded\n", count)
 
-	term.Warnf("Loading workgroups...")
+	warnf("Loading workgroups...")
 	count = 0
 
 	if len(i.workgroupNames) > 0 {
-		for _, wgname := range i.workgroupNames {
-			term.Warnf(wgname + "..")
+		i.parallel(len(i.workgroupNames), func(idx int) {
+			wgname := i.workgroupNames[idx]
 			path := fmt.Sprintf("/api/v2/work_groups/%s?_fields=_id,name,description", wgname)
-			data, err = i.inventoreeGet(path)
-			if err != nil {
-				term.Errorf("\nError loading workgroup %s: %s\n", wgname, err)
-				continue
-			}
-
-			wgdata := &apiWorkgroup{}
-			err = json.Unmarshal(data, wgdata)
-			if err != nil {
-				term.Errorf("\nError loading workgroup %s: %s\n", wgname, err)
-				continue
+			data, err := i.inventoreeGet(path)
+			if err == nil {
+				wgdata := &apiWorkgroup{}
+				err = json.Unmarshal(data, wgdata)
+				if err == nil {
+					lock.Lock()
+					defer lock.Unlock()
+					lc.WorkGroups = append(lc.WorkGroups, wgdata.Data)
+					count++
+					warnf(wgname + "..")
+					return
+				}
 			}
-			lc.WorkGroups = append(lc.WorkGroups, wgdata.Data)
-			count++
-		}
+			errorf("\nError loading workgroup %s: %s\n", wgname, err)
+		})
 	} else {
 		path := fmt.Sprintf("/api/v2/work_groups/?_fields=_id,name,description&_nopaging=true")
 		data, err = i.inventoreeGet(path)
@@ -239,100 +378,182 @@ func (i *Inventoree) loadRemote() error {
 			}
 		}
 		if err != nil {
-			term.Errorf("\nError loading workgroups: %s\n", err)
+			errorf("\nError loading workgroups: %s\n", err)
 		}
 	}
-	term.Warnf("%d loaded\n", count)
+	warnf("%d loaded\n", count)
 
-	term.Warnf("Loading groups...")
+	warnf("Loading groups...")
 
 	count = 0
 	if len(i.workgroupNames) > 0 {
-		for _, wgname := range i.workgroupNames {
+		var groupsErr error
+		i.parallel(len(i.workgroupNames), func(idx int) {
+			wgname := i.workgroupNames[idx]
 			path := fmt.Sprintf("/api/v2/groups/?work_group_id=%s&_fields=_id,name,parent_id,local_tags,description,work_group_id&_nopaging=true", wgname)
-			data, err = i.inventoreeGet(path)
+			data, err := i.inventoreeGet(path)
 			if err != nil {
-				term.Errorf("%s..", wgname)
-				continue
+				errorf("%s..", wgname)
+				return
 			}
 			gdata := &apiGroups{}
 			err = json.Unmarshal(data, gdata)
+
+			lock.Lock()
+			defer lock.Unlock()
 			if err != nil {
-				return err
+				groupsErr = err
+				return
 			}
 			for _, g := range gdata.Data {
 				lc.Groups = append(lc.Groups, g)
 				count++
 			}
-			term.Warnf("%s..", wgname)
+			warnf("%s..", wgname)
+		})
+		if groupsErr != nil {
+			return nil, groupsErr
 		}
 	} else {
 		path := "/api/v2/groups/?_fields=_id,name,parent_id,local_tags,description,work_group_id&_nopaging=true"
 		data, err = i.inventoreeGet(path)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		gdata := &apiGroups{}
 		err = json.Unmarshal(data, gdata)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		for _, g := range gdata.Data {
 			lc.Groups = append(lc.Groups, g)
 			count++
 		}
 	}
-	term.Warnf("%d loaded\n", count)
+	warnf("%d loaded\n", count)
 
-	term.Warnf("Loading hosts...")
-	count = 0
+	since := ""
+	var prev *cache
+	if i.incremental {
+		prev, err = i.readCache()
+		if err == nil {
+			since = prev.lastUpdate()
+		}
+	}
 
-	fieldSet := "_id,fqdn,ssh_hostname,local_tags,group_id,datacenter_id,aliases,description"
-	moveToFQDN := i.hostKeyField != "fqdn"
+	if since == "" {
+		warnf("Loading hosts...")
+	} else {
+		warnf("Loading hosts updated since %s...", since)
+	}
 
-	for _, wg := range lc.WorkGroups {
+	count = 0
+	fieldSet := "_id,fqdn,ssh_hostname,local_tags,group_id,datacenter_id,aliases,description,updated_at"
+	aliveIDs := make(map[string]bool)
+	var hostsErr error
+
+	i.parallel(len(lc.WorkGroups), func(idx int) {
+		wg := lc.WorkGroups[idx]
 		path := fmt.Sprintf("/api/v2/hosts/?work_group_id=%s&_fields=%s&_nopaging=true", wg.ID, fieldSet)
-		data, err = i.inventoreeGet(path)
-		if err != nil {
-			term.Errorf("\nError loading hosts of work group %s: %s", wg.Name, err)
-			continue
+		if since != "" {
+			path += "&updated_at__gt=" + url.QueryEscape(since)
 		}
 		hdata := &apiHosts{}
-		err = json.Unmarshal(data, hdata)
+		data, err := i.inventoreeGet(path)
+		if err == nil {
+			err = json.Unmarshal(data, hdata)
+		}
+
+		// in incremental mode the full list of ids is needed
+		// to find out which hosts have been deleted
+		idsdata := &apiHosts{}
+		if err == nil && since != "" {
+			path = fmt.Sprintf("/api/v2/hosts/?work_group_id=%s&_fields=_id&_nopaging=true", wg.ID)
+			data, err = i.inventoreeGet(path)
+			if err == nil {
+				err = json.Unmarshal(data, idsdata)
+			}
+		}
+
+		lock.Lock()
+		defer lock.Unlock()
 		if err != nil {
-			term.Errorf("\nError loading hosts of work group %s: %s", wg.Name, err)
-			continue
+			errorf("\nError loading hosts of work group %s: %s", wg.Name, err)
+			hostsErr = err
+			return
 		}
+
 		for _, h := range hdata.Data {
-			if moveToFQDN && h.SSHHostname != "" {
-				// copying ssh_hostname to FQDN
-				// to keep things simple
-				h.FQDN = h.SSHHostname
-			}
 			lc.Hosts = append(lc.Hosts, h)
 			count++
 		}
-		term.Warnf(wg.Name + "..")
+		for _, h := range idsdata.Data {
+			aliveIDs[h.ID] = true
+		}
+		warnf(wg.Name + "..")
+	})
+	warnf("%d loaded\n", count)
+
+	if hostsErr != nil {
+		// partial data can neither replace the cache
+		// nor be merged with it safely
+		return nil, hostsErr
 	}
-	term.Warnf("%d loaded\n", count)
-	err = i.saveCache(lc)
-	if err != nil {
-		term.Errorf("Error saving cacne: %s\n", err)
-	} else {
-		term.Successf("Cache saved to %s\n", i.cacheFilename())
+
+	if since != "" {
+		updated := make(map[string]bool)
+		for _, h := range lc.Hosts {
+			updated[h.ID] = true
+		}
+		for _, h := range prev.Hosts {
+			if aliveIDs[h.ID] && !updated[h.ID] {
+				lc.Hosts = append(lc.Hosts, h)
+			}
+		}
 	}
-	i.extractCache(lc)
-	return nil
+
+	return lc, nil
+}
+
+// SetOffline sets offline mode, i.e. using cache only
+func (i *Inventoree) SetOffline(offline bool) {
+	i.offline = offline
+}
+
+// Offline returns true if the backend is in offline mode
+func (i *Inventoree) Offline() bool {
+	return i.offline
+}
+
+// CacheInfo returns the cache file information
+func (i *Inventoree) CacheInfo() *store.CacheInfo {
+	ci := &store.CacheInfo{
+		Filename: i.cacheFilename(),
+		TTL:      i.cacheTTL,
+	}
+	st, err := os.Stat(ci.Filename)
+	if err == nil {
+		ci.Exists = true
+		ci.ModTime = st.ModTime()
+	}
+	return ci
+}
+
+// PurgeCache removes the cache file
+func (i *Inventoree) PurgeCache() error {
+	err := os.Remove(i.cacheFilename())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
 }
 
 func (i *Inventoree) cacheExpired() bool {
 	st, err := os.Stat(i.cacheFilename())
 	if err != nil {
-		if os.IsNotExist(err) {
-			// no cache in general means that it's been expired
-			return true
-		}
+		// no cache in general means that it's been expired
+		return true
 	}
 	modifiedAt := st.ModTime()
 	return modifiedAt.Add(i.cacheTTL).Before(time.Now())
@@ -351,7 +572,7 @@ func (i *Inventoree) cacheFilename() string {
 
 func (i *Inventoree) saveCache(lc *cache) error {
 	_, err := os.Stat(i.cacheDir)
-	if err != nil && os.IsNotExist(err) {
+	if os.IsNotExist(err) {
 		err = os.MkdirAll(i.cacheDir, 0755)
 		if err != nil {
 			return fmt.Errorf("Error creating cache dir: %s", err)
@@ -371,6 +592,9 @@ func (i *Inventoree) saveCache(lc *cache) error {
 }
 
 func (i *Inventoree) extractCache(lc *cache) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
 	i.datacenters = make([]*store.Datacenter, 0)
 	i.workgroups = make([]*store.WorkGroup, 0)
 	i.groups = make([]*store.Group, 0)
@@ -405,13 +629,20 @@ func (i *Inventoree) extractCache(lc *cache) {
 	}
 
 	for _, h := range lc.Hosts {
-		i.hosts = append(i.hosts, &store.Host{
+		host := &store.Host{
 			ID:           h.ID,
 			FQDN:         h.FQDN,
+			Address:      h.SSHHostname,
 			Aliases:      h.Aliases,
 			Tags:         h.Tags,
 			GroupID:      h.GroupID,
 			DatacenterID: h.DatacenterID,
-		})
+		}
+		if i.hostKeyField == "ssh_hostname" && h.SSHHostname != "" {
+			// ssh_hostname is used as the host key, so it's
+			// displayed and matched by expressions as well
+			host.FQDN = h.SSHHostname
+		}
+		i.hosts = append(i.hosts, host)
 	}
 }
@@ -0,0 +1,236 @@
+package inventoree
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/viert/xc/config"
+	"github.com/viert/xc/store"
+)
+
+type hostsAPI struct {
+	lock sync.Mutex
+	// hosts are the hosts in inventoree keyed by id, values are json objects
+	hosts map[string]string
+	// updated are the ids the updated_at__gt requests return
+	updated []string
+	// since are the updated_at__gt values requested
+	since []string
+	// failHosts makes the hosts requests fail
+	failHosts bool
+}
+
+func (api *hostsAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	api.lock.Lock()
+	defer api.lock.Unlock()
+
+	if r.Header.Get("X-Api-Auth-Token") != "secret" {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/api/v2/datacenters/":
+		fmt.Fprint(w, `{"data": [{"_id": "dc1", "name": "dc1"}]}`)
+	case "/api/v2/work_groups/":
+		fmt.Fprint(w, `{"data": [{"_id": "wg1", "name": "ops"}]}`)
+	case "/api/v2/groups/":
+		fmt.Fprint(w, `{"data": [{"_id": "g1", "name": "web", "work_group_id": "wg1"}]}`)
+	case "/api/v2/hosts/":
+		q := r.URL.Query()
+		if api.failHosts {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if q.Get("work_group_id") != "wg1" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		ids := make([]string, 0)
+		for id := range api.hosts {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+
+		items := make([]string, 0)
+		switch {
+		case q.Get("_fields") == "_id":
+			for _, id := range ids {
+				items = append(items, fmt.Sprintf(`{"_id": "%s"}`, id))
+			}
+		case q.Get("updated_at__gt") != "":
+			api.since = append(api.since, q.Get("updated_at__gt"))
+			for _, id := range api.updated {
+				items = append(items, api.hosts[id])
+			}
+		default:
+			for _, id := range ids {
+				items = append(items, api.hosts[id])
+			}
+		}
+		fmt.Fprintf(w, `{"data": [%s]}`, strings.Join(items, ","))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func testHost(id string, fqdn string, tag string, updatedAt string) string {
+	return fmt.Sprintf(`{"_id": "%s", "fqdn": "%s", "group_id": "g1", "datacenter_id": "dc1", "local_tags": ["%s"], "updated_at": "%s"}`,
+		id, fqdn, tag, updatedAt)
+}
+
+func hostTags(hosts []*store.Host) map[string]string {
+	tags := make(map[string]string)
+	for _, h := range hosts {
+		tags[h.FQDN] = strings.Join(h.Tags, ",")
+	}
+	return tags
+}
+
+func TestIncrementalLoad(t *testing.T) {
+	api := &hostsAPI{
+		hosts: map[string]string{
+			// the latest update is h2 while h1 is greater as a string
+			"h1": testHost("h1", "web1", "v1", "2019-10-23T10:00:00+03:00"),
+			"h2": testHost("h2", "web2", "v1", "2019-10-23T08:00:00Z"),
+		},
+	}
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+
+	cfg := &config.XCConfig{
+		CacheDir: t.TempDir(),
+		BackendCfg: &config.BackendConfig{Options: map[string]string{
+			"url":         srv.URL,
+			"auth_token":  "secret",
+			"incremental": "true",
+			"retries":     "0",
+		}},
+	}
+	inv, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// full load, there's no cache yet
+	if err = inv.Reload(); err != nil {
+		t.Fatalf("full load: %s", err)
+	}
+	expected := map[string]string{"web1": "v1", "web2": "v1"}
+	if tags := hostTags(inv.Hosts()); fmt.Sprint(tags) != fmt.Sprint(expected) {
+		t.Errorf("hosts after full load are %v, expected %v", tags, expected)
+	}
+	if len(api.since) != 0 {
+		t.Errorf("full load requested updates since %v", api.since)
+	}
+
+	// a new host is added and an existing one is updated
+	api.lock.Lock()
+	api.hosts["h1"] = testHost("h1", "web1", "v2", "2019-10-23T09:00:00.5Z")
+	api.hosts["h3"] = testHost("h3", "web3", "v1", "2019-10-23T09:00:01.25Z")
+	api.updated = []string{"h1", "h3"}
+	api.lock.Unlock()
+
+	if err = inv.Reload(); err != nil {
+		t.Fatalf("incremental load: %s", err)
+	}
+	expected = map[string]string{"web1": "v2", "web2": "v1", "web3": "v1"}
+	if tags := hostTags(inv.Hosts()); fmt.Sprint(tags) != fmt.Sprint(expected) {
+		t.Errorf("hosts after incremental load are %v, expected %v", tags, expected)
+	}
+
+	// a host is deleted
+	api.lock.Lock()
+	delete(api.hosts, "h2")
+	api.updated = []string{}
+	api.lock.Unlock()
+
+	if err = inv.Reload(); err != nil {
+		t.Fatalf("incremental load: %s", err)
+	}
+	expected = map[string]string{"web1": "v2", "web3": "v1"}
+	if tags := hostTags(inv.Hosts()); fmt.Sprint(tags) != fmt.Sprint(expected) {
+		t.Errorf("hosts after deletion are %v, expected %v", tags, expected)
+	}
+
+	expectedSince := []string{"2019-10-23T08:00:00Z", "2019-10-23T09:00:01.25Z"}
+	if fmt.Sprint(api.since) != fmt.Sprint(expectedSince) {
+		t.Errorf("updates requested since %q, expected %q", api.since, expectedSince)
+	}
+}
+
+func TestFullLoadHostsError(t *testing.T) {
+	api := &hostsAPI{
+		hosts: map[string]string{
+			"h1": testHost("h1", "web1", "v1", "2019-10-23T10:00:00Z"),
+			"h2": testHost("h2", "web2", "v1", "2019-10-23T08:00:00Z"),
+		},
+	}
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+
+	cfg := &config.XCConfig{
+		CacheDir: t.TempDir(),
+		BackendCfg: &config.BackendConfig{Options: map[string]string{
+			"url":        srv.URL,
+			"auth_token": "secret",
+			"retries":    "0",
+		}},
+	}
+	inv, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = inv.Reload(); err != nil {
+		t.Fatalf("full load: %s", err)
+	}
+
+	api.lock.Lock()
+	api.hosts["h3"] = testHost("h3", "web3", "v1", "2019-10-23T11:00:00Z")
+	api.failHosts = true
+	api.lock.Unlock()
+
+	if _, err = inv.fetchRemote(false); err == nil {
+		t.Errorf("hosts error is not returned")
+	}
+	// the cache saved previously is used instead of the partial data
+	if err = inv.Reload(); err != nil {
+		t.Fatalf("reload from cache: %s", err)
+	}
+	expected := map[string]string{"web1": "v1", "web2": "v1"}
+	if tags := hostTags(inv.Hosts()); fmt.Sprint(tags) != fmt.Sprint(expected) {
+		t.Errorf("hosts after failed load are %v, expected %v", tags, expected)
+	}
+}
+
+func TestLastUpdate(t *testing.T) {
+	tests := []struct {
+		timestamps []string
+		expected   string
+	}{
+		{[]string{}, ""},
+		{[]string{"", ""}, ""},
+		{[]string{"2019-10-23T10:00:00Z", "2019-10-23T09:00:00Z"}, "2019-10-23T10:00:00Z"},
+		// precision differs
+		{[]string{"2019-10-23T10:00:00.5Z", "2019-10-23T10:00:00.123456Z"}, "2019-10-23T10:00:00.5Z"},
+		// time zones differ
+		{[]string{"2019-10-23T12:00:00+03:00", "2019-10-23T10:00:00Z"}, "2019-10-23T10:00:00Z"},
+		// no time zone
+		{[]string{"2019-10-23T10:00:00.000001", "2019-10-23T10:00:00"}, "2019-10-23T10:00:00.000001"},
+		{[]string{"invalid", "2019-10-23T10:00:00Z"}, "2019-10-23T10:00:00Z"},
+	}
+	for _, tt := range tests {
+		lc := &cache{Hosts: make([]*host, 0)}
+		for i, ts := range tt.timestamps {
+			lc.Hosts = append(lc.Hosts, &host{ID: fmt.Sprint(i), UpdatedAt: ts})
+		}
+		if last := lc.lastUpdate(); last != tt.expected {
+			t.Errorf("lastUpdate of %q is %q, expected %q", tt.timestamps, last, tt.expected)
+		}
+	}
+}
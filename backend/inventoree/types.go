@@ -1,8 +1,10 @@
 package inventoree
 
 import (
+	"sync"
 	"time"
 
+	"github.com/viert/xc/backend/httpclient"
 	"github.com/viert/xc/store"
 )
 
@@ -12,13 +14,17 @@ type Inventoree struct {
 	cacheTTL       time.Duration
 	cacheDir       string
 	url            string
-	authToken      string
-	insecure       bool
+	client         *httpclient.Client
 	hostKeyField   string
+	fetchThreads   int
+	incremental    bool
 	hosts          []*store.Host
 	groups         []*store.Group
 	workgroups     []*store.WorkGroup
 	datacenters    []*store.Datacenter
+	offline        bool
+	lock           sync.Mutex
+	onUpdate       func()
 }
 
 type datacenter struct {
@@ -43,6 +49,7 @@ type host struct {
 	Aliases      []string `json:"aliases"`
 	GroupID      string   `json:"group_id"`
 	DatacenterID string   `json:"datacenter_id"`
+	UpdatedAt    string   `json:"updated_at,omitempty"`
 }
 
 type group struct {
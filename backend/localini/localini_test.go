@@ -0,0 +1,254 @@
+package localini
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/viert/xc/config"
+	"github.com/viert/xc/store"
+)
+
+const iniContents = `# test inventory
+[datacenters]
+dc1
+
+[workgroups]
+wg1
+
+[groups]
+group1 wg=wg1
+group2 wg=wg1
+
+[hosts]
+# web servers
+host1.example.com group=group1 dc=dc1 tags=web
+host2.example.com group=group1
+`
+
+func newLocalIni(t *testing.T, contents string) *LocalIni {
+	f, err := ioutil.TempFile("", "xc-localini")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(contents)
+	f.Close()
+	t.Cleanup(func() { os.Remove(f.Name()) })
+
+	cfg := &config.XCConfig{BackendCfg: &config.BackendConfig{Options: map[string]string{"filename": f.Name()}}}
+	li, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return li
+}
+
+func TestWriter(t *testing.T) {
+	li := newLocalIni(t, iniContents)
+	err := li.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	updates := 0
+	li.OnUpdate(func() { updates++ })
+
+	if err := li.AddHost(newHost("host3.example.com", "group2", "dc1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := li.AddHost(newHost("host3.example.com", "", "")); err == nil {
+		t.Error("error expected on adding an existing host")
+	}
+	if err := li.AddHost(newHost("host4.example.com", "nosuchgroup", "")); err == nil {
+		t.Error("error expected on adding a host to a missing group")
+	}
+	if err := li.MoveHosts([]string{"host1.example.com", "host2.example.com"}, "group2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := li.AddTags([]string{"host1.example.com"}, []string{"db", "web"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := li.RemoveTags([]string{"host1.example.com"}, []string{"web"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := li.RemoveHosts([]string{"host2.example.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if updates != 5 {
+		t.Errorf("expected 5 update notifications, got %d", updates)
+	}
+
+	data, _ := ioutil.ReadFile(li.filename)
+	expected := `# test inventory
+[datacenters]
+dc1
+
+[workgroups]
+wg1
+
+[groups]
+group1 wg=wg1
+group2 wg=wg1
+
+[hosts]
+# web servers
+host1.example.com dc=dc1 group=group2 tags=db
+host3.example.com group=group2 dc=dc1
+`
+	if string(data) != expected {
+		t.Errorf("unexpected file contents:\n%s", string(data))
+	}
+
+	if len(li.Hosts()) != 2 {
+		t.Errorf("expected 2 hosts after reload, got %d", len(li.Hosts()))
+	}
+}
+
+func TestAddHostBeforeNextSection(t *testing.T) {
+	li := newLocalIni(t, "[hosts]\nhost1.example.com\n\n[datacenters]\ndc1\n")
+	err := li.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := li.AddHost(newHost("host2.example.com", "", "dc1")); err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := ioutil.ReadFile(li.filename)
+	expected := "[hosts]\nhost1.example.com\nhost2.example.com dc=dc1\n\n[datacenters]\ndc1\n"
+	if string(data) != expected {
+		t.Errorf("unexpected file contents:\n%s", string(data))
+	}
+}
+
+func newHost(fqdn, group, dc string) *store.Host {
+	return &store.Host{FQDN: fqdn, GroupID: group, DatacenterID: dc}
+}
+
+func TestParse(t *testing.T) {
+	li := newLocalIni(t, `[datacenters]
+dc1 description="Main datacenter" # inline comment
+
+[workgroups]
+wg1
+
+[groups]
+group1 wg=wg1 tags=a,b tag=c
+
+[hosts]
+host1.example.com group=group1 dc=dc1 desc="web server #1" tags=x tags=y aliases=h1,web1 alias='h 1'
+host2.example.com address=10.0.0.2 port=2222 user=admin jump=bastion.example.com
+`)
+	err := li.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if li.Datacenters()[0].Description != "Main datacenter" {
+		t.Errorf("unexpected datacenter description %q", li.Datacenters()[0].Description)
+	}
+	if len(li.Groups()[0].Tags) != 3 {
+		t.Errorf("expected 3 group tags, got %v", li.Groups()[0].Tags)
+	}
+
+	h := li.Hosts()[0]
+	if h.Description != "web server #1" {
+		t.Errorf("unexpected host description %q", h.Description)
+	}
+	if len(h.Tags) != 2 || h.Tags[0] != "x" || h.Tags[1] != "y" {
+		t.Errorf("unexpected host tags %v", h.Tags)
+	}
+	if len(h.Aliases) != 3 || h.Aliases[2] != "h 1" {
+		t.Errorf("unexpected host aliases %v", h.Aliases)
+	}
+
+	h = li.Hosts()[1]
+	if h.Address != "10.0.0.2" || h.Port != 2222 || h.User != "admin" || h.JumpHost != "bastion.example.com" {
+		t.Errorf("unexpected connection parameters %+v", h)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	li := newLocalIni(t, `orphan
+[groups]
+group1 wg=nosuchwg
+group1
+
+[hosts]
+host1.example.com foo=bar
+host2.example.com desc="unterminated
+host3.example.com group=nosuchgroup
+`)
+	err := li.Load()
+	if err == nil {
+		t.Fatal("parse errors expected")
+	}
+
+	msg := err.Error()
+	for _, expected := range []string{
+		":1: unexpected line outside sections",
+		":4: duplicate group group1, first defined at line 3",
+		":7: invalid host option foo",
+		":8: unterminated quote",
+	} {
+		if !strings.Contains(msg, li.filename+expected) {
+			t.Errorf("expected error %q in:\n%s", expected, msg)
+		}
+	}
+	// dangling references are warnings
+	if strings.Contains(msg, "is not defined") {
+		t.Errorf("undefined references are reported as errors:\n%s", msg)
+	}
+}
+
+func TestParseUndefinedReferences(t *testing.T) {
+	p := newParser("test.ini")
+	err := p.parse(strings.NewReader(`[datacenters]
+dc1 parent=nosuchdc
+
+[groups]
+group1 wg=nosuchwg parent=nosuchparent
+
+[hosts]
+host1.example.com group=nosuchgroup dc=dc2
+host2.example.com group=group1 dc=dc1
+`))
+	if err != nil {
+		t.Fatalf("undefined references fail parsing: %s", err)
+	}
+
+	expected := []string{
+		"test.ini:2: parent datacenter nosuchdc is not defined",
+		"test.ini:5: parent group nosuchparent is not defined",
+		"test.ini:5: workgroup nosuchwg is not defined",
+		"test.ini:8: group nosuchgroup is not defined",
+		"test.ini:8: datacenter dc2 is not defined",
+	}
+	if strings.Join(p.warnings, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("warnings are\n%s\nexpected\n%s", strings.Join(p.warnings, "\n"), strings.Join(expected, "\n"))
+	}
+	if len(p.hosts) != 2 || p.hosts[0].GroupID != "nosuchgroup" {
+		t.Errorf("hosts with undefined references are not loaded: %+v", p.hosts)
+	}
+}
+
+func TestWriterQuoting(t *testing.T) {
+	li := newLocalIni(t, "[hosts]\nhost1.example.com desc=\"my host\" tags=a # keep me\n")
+	err := li.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := li.AddTags([]string{"host1.example.com"}, []string{"b c"}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := ioutil.ReadFile(li.filename)
+	expected := "[hosts]\nhost1.example.com desc=\"my host\" tags=\"a,b c\" # keep me\n"
+	if string(data) != expected {
+		t.Errorf("unexpected file contents:\n%s", string(data))
+	}
+}
@@ -0,0 +1,411 @@
+package localini
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/viert/xc/store"
+)
+
+type parseSection int
+
+const (
+	sectionWorkgroups parseSection = iota
+	sectionDatacenters
+	sectionGroups
+	sectionHosts
+	sectionNone
+	sectionUnknown
+)
+
+var sections = map[string]parseSection{
+	"[workgroups]":  sectionWorkgroups,
+	"[datacenters]": sectionDatacenters,
+	"[groups]":      sectionGroups,
+	"[hosts]":       sectionHosts,
+}
+
+type option struct {
+	key   string
+	value string
+}
+
+// parseErrors collects all the errors found in the file
+// so they can be fixed at once
+type parseErrors []string
+
+func (pe parseErrors) Error() string {
+	return fmt.Sprintf("%d error(s) found:\n%s", len(pe), strings.Join(pe, "\n"))
+}
+
+// parser keeps the state of reading one ini file
+type parser struct {
+	filename    string
+	lineNum     int
+	errors      parseErrors
+	warnings    []string
+	hosts       []*store.Host
+	groups      []*store.Group
+	workgroups  []*store.WorkGroup
+	datacenters []*store.Datacenter
+
+	// object id -> line it's defined at, for duplicates and references checks
+	hostLines  map[string]int
+	groupLines map[string]int
+	wgLines    map[string]int
+	dcLines    map[string]int
+	refs       []reference
+}
+
+type reference struct {
+	lineNum int
+	kind    string
+	id      string
+	lines   map[string]int
+}
+
+func newParser(filename string) *parser {
+	return &parser{
+		filename:    filename,
+		errors:      make(parseErrors, 0),
+		warnings:    make([]string, 0),
+		hosts:       make([]*store.Host, 0),
+		groups:      make([]*store.Group, 0),
+		workgroups:  make([]*store.WorkGroup, 0),
+		datacenters: make([]*store.Datacenter, 0),
+		hostLines:   make(map[string]int),
+		groupLines:  make(map[string]int),
+		wgLines:     make(map[string]int),
+		dcLines:     make(map[string]int),
+		refs:        make([]reference, 0),
+	}
+}
+
+func (p *parser) errorf(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	p.errors = append(p.errors, fmt.Sprintf("%s:%d: %s", p.filename, p.lineNum, msg))
+}
+
+// warnf reports a problem which doesn't prevent the file from loading
+func (p *parser) warnf(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	p.warnings = append(p.warnings, fmt.Sprintf("%s:%d: %s", p.filename, p.lineNum, msg))
+}
+
+func (p *parser) parse(r io.Reader) error {
+	section := sectionNone
+	scan := bufio.NewScanner(r)
+
+	for scan.Scan() {
+		p.lineNum++
+		line := strings.TrimSpace(scan.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			sect, found := sections[line]
+			if !found {
+				p.errorf("unknown section %s", line)
+				// the section contents are skipped to avoid an error on every line
+				sect = sectionUnknown
+			}
+			section = sect
+			continue
+		}
+
+		if section == sectionUnknown {
+			continue
+		}
+		if section == sectionNone {
+			p.errorf("unexpected line outside sections: %s", line)
+			continue
+		}
+
+		name, options, err := parseLine(line)
+		if err != nil {
+			p.errorf("%s", err)
+			continue
+		}
+
+		switch section {
+		case sectionWorkgroups:
+			p.addWorkgroup(name, options)
+		case sectionGroups:
+			p.addGroup(name, options)
+		case sectionDatacenters:
+			p.addDatacenter(name, options)
+		case sectionHosts:
+			p.addHost(name, options)
+		}
+	}
+
+	if err := scan.Err(); err != nil {
+		return err
+	}
+
+	// dangling references are left unresolved by the store
+	// the same way they've always been, so they're only warned about
+	for _, ref := range p.refs {
+		if _, found := ref.lines[ref.id]; !found {
+			p.lineNum = ref.lineNum
+			p.warnf("%s %s is not defined", ref.kind, ref.id)
+		}
+	}
+
+	if len(p.errors) > 0 {
+		return p.errors
+	}
+	return nil
+}
+
+// define checks the object id is unique and remembers its line
+func (p *parser) define(kind string, id string, lines map[string]int) {
+	if prev, found := lines[id]; found {
+		p.errorf("duplicate %s %s, first defined at line %d", kind, id, prev)
+		return
+	}
+	lines[id] = p.lineNum
+}
+
+// ref remembers a reference to be checked after the whole file is read
+func (p *parser) ref(kind string, id string, lines map[string]int) {
+	if id == "" {
+		return
+	}
+	p.refs = append(p.refs, reference{p.lineNum, kind, id, lines})
+}
+
+func (p *parser) addWorkgroup(name string, options []option) {
+	wg := &store.WorkGroup{ID: name, Name: name}
+	for _, opt := range options {
+		switch opt.key {
+		case "id":
+			wg.ID = opt.value
+		case "name":
+			wg.Name = opt.value
+		case "desc", "description":
+			wg.Description = opt.value
+		default:
+			p.errorf("invalid workgroup option %s", opt.key)
+		}
+	}
+	p.define("workgroup", wg.ID, p.wgLines)
+	p.workgroups = append(p.workgroups, wg)
+}
+
+func (p *parser) addDatacenter(name string, options []option) {
+	dc := &store.Datacenter{ID: name, Name: name}
+	for _, opt := range options {
+		switch opt.key {
+		case "id":
+			dc.ID = opt.value
+		case "name":
+			dc.Name = opt.value
+		case "parent", "parent_id":
+			dc.ParentID = opt.value
+		case "desc", "description":
+			dc.Description = opt.value
+		default:
+			p.errorf("invalid datacenter option %s", opt.key)
+		}
+	}
+	p.define("datacenter", dc.ID, p.dcLines)
+	p.ref("parent datacenter", dc.ParentID, p.dcLines)
+	p.datacenters = append(p.datacenters, dc)
+}
+
+func (p *parser) addGroup(name string, options []option) {
+	group := &store.Group{ID: name, Name: name, Tags: make([]string, 0)}
+	for _, opt := range options {
+		switch opt.key {
+		case "id":
+			group.ID = opt.value
+		case "name":
+			group.Name = opt.value
+		case "parent", "parent_id":
+			group.ParentID = opt.value
+		case "tag", "tags":
+			group.Tags = append(group.Tags, splitList(opt.value)...)
+		case "desc", "description":
+			group.Description = opt.value
+		case "workgroup", "wg", "wg_id":
+			group.WorkGroupID = opt.value
+		default:
+			p.errorf("invalid group option %s", opt.key)
+		}
+	}
+	p.define("group", group.ID, p.groupLines)
+	p.ref("parent group", group.ParentID, p.groupLines)
+	p.ref("workgroup", group.WorkGroupID, p.wgLines)
+	p.groups = append(p.groups, group)
+}
+
+func (p *parser) addHost(name string, options []option) {
+	host := &store.Host{ID: name, FQDN: name, Tags: make([]string, 0), Aliases: make([]string, 0)}
+	for _, opt := range options {
+		switch opt.key {
+		case "id":
+			host.ID = opt.value
+		case "name":
+			host.FQDN = opt.value
+		case "group", "group_id":
+			host.GroupID = opt.value
+		case "alias", "aliases":
+			host.Aliases = append(host.Aliases, splitList(opt.value)...)
+		case "tag", "tags":
+			host.Tags = append(host.Tags, splitList(opt.value)...)
+		case "desc", "description":
+			host.Description = opt.value
+		case "datacenter", "datacenter_id", "dc", "dc_id":
+			host.DatacenterID = opt.value
+		case "address", "addr":
+			host.Address = opt.value
+		case "port":
+			port, err := strconv.ParseUint(opt.value, 10, 16)
+			if err != nil || port == 0 {
+				p.errorf("invalid port %s", opt.value)
+			}
+			host.Port = int(port)
+		case "user":
+			host.User = opt.value
+		case "jump", "jump_host":
+			host.JumpHost = opt.value
+		default:
+			p.errorf("invalid host option %s", opt.key)
+		}
+	}
+	p.define("host", host.FQDN, p.hostLines)
+	p.ref("group", host.GroupID, p.groupLines)
+	p.ref("datacenter", host.DatacenterID, p.dcLines)
+	p.hosts = append(p.hosts, host)
+}
+
+// parseLine reads the object name followed by key=value options.
+// Values may be quoted, everything after an unquoted # is a comment
+func parseLine(line string) (string, []option, error) {
+	tokens, _, err := splitLine(line)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(tokens) == 0 {
+		return "", nil, fmt.Errorf("empty line")
+	}
+
+	name, _, hasValue := parseToken(tokens[0])
+	if hasValue {
+		return "", nil, fmt.Errorf("object name expected, got %s", tokens[0])
+	}
+
+	options := make([]option, 0, len(tokens)-1)
+	for _, token := range tokens[1:] {
+		key, value, hasValue := parseToken(token)
+		if !hasValue || key == "" {
+			return "", nil, fmt.Errorf("invalid token %s, expected key=value format", token)
+		}
+		options = append(options, option{key, value})
+	}
+	return name, options, nil
+}
+
+// splitLine splits the line into raw tokens by unquoted whitespace
+// and returns them along with the trailing comment if any
+func splitLine(line string) ([]string, string, error) {
+	var (
+		cur   strings.Builder
+		quote rune
+	)
+	tokens := make([]string, 0)
+	runes := []rune(line)
+
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote != 0:
+			cur.WriteRune(r)
+			if r == '\\' && quote == '"' && i+1 < len(runes) {
+				i++
+				cur.WriteRune(runes[i])
+			} else if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			cur.WriteRune(r)
+		case unicode.IsSpace(r):
+			if cur.Len() > 0 {
+				tokens = append(tokens, cur.String())
+				cur.Reset()
+			}
+		case r == '#' && cur.Len() == 0:
+			return tokens, strings.TrimSpace(string(runes[i:])), nil
+		default:
+			cur.WriteRune(r)
+		}
+	}
+
+	if quote != 0 {
+		return nil, "", fmt.Errorf("unterminated quote")
+	}
+	if cur.Len() > 0 {
+		tokens = append(tokens, cur.String())
+	}
+	return tokens, "", nil
+}
+
+// parseToken splits a raw token into key and unquoted value
+func parseToken(token string) (string, string, bool) {
+	idx := strings.IndexAny(token, "=\"'")
+	if idx < 0 || token[idx] != '=' {
+		return unquote(token), "", false
+	}
+	return token[:idx], unquote(token[idx+1:]), true
+}
+
+func unquote(value string) string {
+	var (
+		sb    strings.Builder
+		quote rune
+	)
+	runes := []rune(value)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote == 0 && (r == '"' || r == '\''):
+			quote = r
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote == '"' && r == '\\' && i+1 < len(runes):
+			i++
+			sb.WriteRune(runes[i])
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+// quoteValue makes a value safe to write back into the file
+func quoteValue(value string) string {
+	if value != "" && !strings.ContainsAny(value, " \t\"'#") {
+		return value
+	}
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	return `"` + value + `"`
+}
+
+func splitList(value string) []string {
+	list := make([]string, 0)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
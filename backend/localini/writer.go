@@ -0,0 +1,280 @@
+package localini
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/viert/xc/store"
+	"github.com/viert/xc/stringslice"
+)
+
+var (
+	// option names which may refer to the same host field
+	groupKeys = []string{"group", "group_id"}
+	dcKeys    = []string{"dc", "dc_id", "datacenter", "datacenter_id"}
+	tagsKeys  = []string{"tags", "tag"}
+)
+
+// AddHost adds a new host to the [hosts] section of the file
+func (li *LocalIni) AddHost(host *store.Host) error {
+	if li.findHost(host.FQDN) != nil {
+		return fmt.Errorf("host %s already exists", host.FQDN)
+	}
+
+	line := quoteValue(host.FQDN)
+	if host.GroupID != "" {
+		group := li.findGroup(host.GroupID)
+		if group == nil {
+			return fmt.Errorf("group %s not found", host.GroupID)
+		}
+		line = setOption(line, groupKeys, group.ID)
+	}
+	if host.DatacenterID != "" {
+		dc := li.findDatacenter(host.DatacenterID)
+		if dc == nil {
+			return fmt.Errorf("datacenter %s not found", host.DatacenterID)
+		}
+		line = setOption(line, dcKeys, dc.ID)
+	}
+	if len(host.Tags) > 0 {
+		line = setOption(line, tagsKeys, strings.Join(host.Tags, ","))
+	}
+
+	return li.modify(func(lines []string) ([]string, error) {
+		start, end := sectionRange(lines, "[hosts]")
+		if start < 0 {
+			if len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) != "" {
+				lines = append(lines, "")
+			}
+			return append(lines, "[hosts]", line), nil
+		}
+		// insert right after the last non-empty line of the section
+		pos := end
+		for pos > start+1 && strings.TrimSpace(lines[pos-1]) == "" {
+			pos--
+		}
+		lines = append(lines[:pos], append([]string{line}, lines[pos:]...)...)
+		return lines, nil
+	})
+}
+
+// RemoveHosts removes hosts from the file
+func (li *LocalIni) RemoveHosts(fqdns []string) error {
+	return li.modifyHosts(fqdns, func(host *store.Host, line string) (string, bool) {
+		return "", false
+	})
+}
+
+// MoveHosts sets the group of hosts
+func (li *LocalIni) MoveHosts(fqdns []string, groupName string) error {
+	group := li.findGroup(groupName)
+	if group == nil {
+		return fmt.Errorf("group %s not found", groupName)
+	}
+	return li.modifyHosts(fqdns, func(host *store.Host, line string) (string, bool) {
+		return setOption(line, groupKeys, group.ID), true
+	})
+}
+
+// AddTags adds tags to hosts
+func (li *LocalIni) AddTags(fqdns []string, tags []string) error {
+	return li.modifyHosts(fqdns, func(host *store.Host, line string) (string, bool) {
+		hostTags := append([]string{}, host.Tags...)
+		for _, tag := range tags {
+			if !stringslice.Contains(hostTags, tag) {
+				hostTags = append(hostTags, tag)
+			}
+		}
+		return setOption(line, tagsKeys, strings.Join(hostTags, ",")), true
+	})
+}
+
+// RemoveTags removes tags from hosts
+func (li *LocalIni) RemoveTags(fqdns []string, tags []string) error {
+	return li.modifyHosts(fqdns, func(host *store.Host, line string) (string, bool) {
+		hostTags := make([]string, 0)
+		for _, tag := range host.Tags {
+			if !stringslice.Contains(tags, tag) {
+				hostTags = append(hostTags, tag)
+			}
+		}
+		return setOption(line, tagsKeys, strings.Join(hostTags, ",")), true
+	})
+}
+
+// modifyHosts applies modifier to the lines of the given hosts.
+// modifier returns the new line and false if the line must be removed
+func (li *LocalIni) modifyHosts(fqdns []string, modifier func(*store.Host, string) (string, bool)) error {
+	hosts := make(map[string]*store.Host)
+	for _, fqdn := range fqdns {
+		host := li.findHost(fqdn)
+		if host == nil {
+			return fmt.Errorf("host %s not found", fqdn)
+		}
+		hosts[fqdn] = host
+	}
+
+	return li.modify(func(lines []string) ([]string, error) {
+		result := make([]string, 0, len(lines))
+		start, end := sectionRange(lines, "[hosts]")
+		for i, line := range lines {
+			if i > start && i < end {
+				if name, ok := hostName(line); ok {
+					if host, found := hosts[name]; found {
+						var keep bool
+						line, keep = modifier(host, line)
+						if !keep {
+							continue
+						}
+					}
+				}
+			}
+			result = append(result, line)
+		}
+		return result, nil
+	})
+}
+
+// modify rewrites the file line by line keeping comments and
+// formatting of untouched lines, then reloads the data
+func (li *LocalIni) modify(modifier func([]string) ([]string, error)) error {
+	st, err := os.Stat(li.filename)
+	if err != nil {
+		return err
+	}
+
+	data, err := ioutil.ReadFile(li.filename)
+	if err != nil {
+		return err
+	}
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+
+	lines, err = modifier(lines)
+	if err != nil {
+		return err
+	}
+
+	// write to a temporary file first so the inventory is never left half-written
+	tmp, err := ioutil.TempFile(filepath.Dir(li.filename), ".xc-ini-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.WriteString(strings.Join(lines, "\n") + "\n")
+	if err == nil {
+		err = tmp.Chmod(st.Mode())
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(tmp.Name(), li.filename)
+	if err != nil {
+		return err
+	}
+
+	err = li.Load()
+	if err != nil {
+		return err
+	}
+	if li.onUpdate != nil {
+		li.onUpdate()
+	}
+	return nil
+}
+
+// sectionRange returns the index of the section header line
+// and the index of the line right after the section
+func sectionRange(lines []string, header string) (int, int) {
+	start := -1
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if start < 0 {
+			if line == header {
+				start = i
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			return start, i
+		}
+	}
+	if start < 0 {
+		return -1, -1
+	}
+	return start, len(lines)
+}
+
+// setOption replaces all the key=value tokens of the line matching
+// any of keys with keys[0]=value, or removes them if value is empty.
+// Untouched tokens and the trailing comment are kept as is
+func setOption(line string, keys []string, value string) string {
+	tokens, comment, err := splitLine(line)
+	if err != nil || len(tokens) == 0 {
+		// lines with errors are never loaded, thus never modified
+		return line
+	}
+	result := []string{tokens[0]}
+	for _, token := range tokens[1:] {
+		key, _, _ := parseToken(token)
+		if stringslice.Contains(keys, key) {
+			continue
+		}
+		result = append(result, token)
+	}
+	if value != "" {
+		result = append(result, keys[0]+"="+quoteValue(value))
+	}
+	if comment != "" {
+		result = append(result, comment)
+	}
+	return strings.Join(result, " ")
+}
+
+// hostName returns the fqdn of a host defined by the line
+func hostName(line string) (string, bool) {
+	name, options, err := parseLine(line)
+	if err != nil {
+		return "", false
+	}
+	for _, opt := range options {
+		if opt.key == "name" {
+			name = opt.value
+		}
+	}
+	return name, true
+}
+
+func (li *LocalIni) findHost(fqdn string) *store.Host {
+	for _, host := range li.hosts {
+		if host.FQDN == fqdn {
+			return host
+		}
+	}
+	return nil
+}
+
+func (li *LocalIni) findGroup(name string) *store.Group {
+	for _, group := range li.groups {
+		if group.Name == name || group.ID == name {
+			return group
+		}
+	}
+	return nil
+}
+
+func (li *LocalIni) findDatacenter(name string) *store.Datacenter {
+	for _, dc := range li.datacenters {
+		if dc.Name == name || dc.ID == name {
+			return dc
+		}
+	}
+	return nil
+}
@@ -35,11 +35,17 @@ type Cli struct {
 	user           string
 	raiseType      remote.RaiseType
 	distributeType remote.CopyType
+	transport      remote.TransportType
+	outputFormat   remote.OutputFormat
 	raisePasswd    string
 	remoteTmpDir   string
 	delay          int
+	batchSize      remote.Threshold
+	maxFailures    remote.Threshold
+	healthCheck    remote.HealthCheck
 	sshThreads     int
 	connectTimeout int
+	commandTimeout int
 
 	exitConfirm      bool
 	execConfirm      bool
@@ -47,7 +53,9 @@ type Cli struct {
 	showSshMin       int
 	showSshMax       int
 	prependHostnames bool
+	separateStderr   bool
 	progressBar      bool
+	reuseConnections bool
 	debug            bool
 	usePasswordMgr   bool
 	naturalSort      bool
@@ -56,19 +64,37 @@ type Cli struct {
 	sudoInterpreter string
 	suInterpreter   string
 
+	collapseTrim    bool
+	collapseMask    bool
+	collapseReplace map[string]string
+	liveCollapse    bool
+
 	curDir              string
 	outputFile          *os.File
 	outputFileName      string
+	outputDir           string
 	aliasRecursionCount int
+
+	lastResult  *remote.ExecResult
+	lastCommand *lastCommand
+	cmdStatus   int
+
+	scriptVars  map[string]string
+	scriptDepth int
 }
 
 const (
 	emSerial execMode = iota
 	emParallel
 	emCollapse
+	emRolling
+	emDiff
 
 	maxAliasRecursion = 10
 	maxSSHThreadsSane = 1024
+
+	// statusNone means the command status is derived from its result
+	statusNone = -1
 )
 
 var (
@@ -77,6 +103,8 @@ var (
 		emSerial:   "serial",
 		emParallel: "parallel",
 		emCollapse: "collapse",
+		emRolling:  "rolling",
+		emDiff:     "diff",
 	}
 )
 
@@ -98,6 +126,7 @@ func New(cfg *config.XCConfig, backend store.Backend) (*Cli, error) {
 	cli.store = st
 	cli.stopped = false
 	cli.aliases = make(map[string]*alias)
+	cli.scriptVars = make(map[string]string)
 	cli.setupCmdHandlers()
 	setEnvironment(cfg.LocalEnvironment)
 
@@ -116,15 +145,19 @@ func New(cfg *config.XCConfig, backend store.Backend) (*Cli, error) {
 	cli.user = cfg.User
 	cli.sshThreads = cfg.SSHThreads
 	cli.prependHostnames = cfg.PrependHostnames
+	cli.separateStderr = cfg.SeparateStderr
 	cli.progressBar = cfg.ProgressBar
+	cli.reuseConnections = cfg.ReuseConnections
 	cli.debug = cfg.Debug
 	cli.connectTimeout = cfg.SSHConnectTimeout
+	cli.commandTimeout = cfg.CommandTimeout
 	cli.remoteTmpDir = cfg.RemoteTmpdir
 	cli.naturalSort = true
 
 	// output
 	cli.outputFileName = ""
 	cli.outputFile = nil
+	cli.outputDir = cfg.OutputDir
 
 	if cfg.PasswordManagerPath != "" {
 		term.Warnf("Loading password manager from %s\n", cfg.PasswordManagerPath)
@@ -137,14 +170,19 @@ func New(cfg *config.XCConfig, backend store.Backend) (*Cli, error) {
 	}
 	remote.Initialize(cli.sshThreads, cli.user)
 	remote.SetPrependHostnames(cli.prependHostnames)
+	remote.SetSeparateStderr(cli.separateStderr)
 	remote.SetRemoteTmpdir(cfg.RemoteTmpdir)
+	remote.SetOutputDir(cli.outputDir)
 	remote.SetProgressBar(cli.progressBar)
+	remote.SetReuseConnections(cli.reuseConnections)
 	remote.SetConnectTimeout(cli.connectTimeout)
+	remote.SetCommandTimeout(cli.commandTimeout)
 	remote.SetDebug(cli.debug)
 	remote.SetUsePasswordManager(cli.usePasswordMgr)
 	remote.SetNumThreads(cli.sshThreads)
 	remote.SetSSHCommand(cfg.SSHCommand)
 	remote.SetRemoteEnvironment(cfg.RemoteEnvironment)
+	remote.SetHostResolver(cli.hostParams)
 	remote.ApplyConfiguredOptions(cfg.SSHOptions)
 
 	// interpreter
@@ -154,6 +192,23 @@ func New(cfg *config.XCConfig, backend store.Backend) (*Cli, error) {
 
 	cli.setRaiseType(cfg.RaiseType)
 	cli.setDistributeType(cfg.Distribute)
+	cli.setTransport(cfg.Transport)
+	cli.setOutputFormat(cfg.OutputFormat)
+	cli.setThreshold("batch_size", &cli.batchSize, cfg.BatchSize)
+	cli.setThreshold("max_failures", &cli.maxFailures, cfg.MaxFailures)
+	cli.healthCheck = remote.HealthCheck{
+		Cmd:      cfg.HealthCheck,
+		Local:    cfg.HealthCheckLocal,
+		Timeout:  cfg.HealthCheckTimeout,
+		Interval: cfg.HealthCheckInterval,
+	}
+	cli.applyHealthCheck()
+	cli.collapseTrim = cfg.CollapseTrimWhitespace
+	cli.collapseMask = cfg.CollapseMaskHostnames
+	cli.collapseReplace = cfg.CollapseReplace
+	cli.applyCollapseOptions()
+	cli.liveCollapse = cfg.CollapseLive
+	remote.SetLiveCollapse(cli.liveCollapse)
 
 	cli.curDir, err = os.Getwd()
 	if err != nil {
@@ -169,6 +224,14 @@ func New(cfg *config.XCConfig, backend store.Backend) (*Cli, error) {
 	return cli, nil
 }
 
+func (c *Cli) rollingOptions() remote.RollingOptions {
+	return remote.RollingOptions{
+		BatchSize:   c.batchSize,
+		Delay:       c.delay,
+		MaxFailures: c.maxFailures,
+	}
+}
+
 func (c *Cli) setPrompt() {
 	rts := ""
 	rtbold := false
@@ -185,6 +248,10 @@ func (c *Cli) setPrompt() {
 		pr = term.Yellow(pr)
 	case emCollapse:
 		pr = term.Green(pr)
+	case emRolling:
+		pr = term.Colored(fmt.Sprintf("[Rolling:%s]", c.batchSize), term.CMagenta, false)
+	case emDiff:
+		pr = term.Colored(pr, term.CLightCyan, false)
 	}
 
 	if c.showSsh {
@@ -221,6 +288,21 @@ func (c *Cli) setPrompt() {
 	c.rl.SetPrompt(pr)
 }
 
+// hostParams provides remote package with connection parameters
+// the backend may have set for a host
+func (c *Cli) hostParams(hostname string) *remote.HostParams {
+	host := c.store.Host(hostname)
+	if host == nil {
+		return nil
+	}
+	return &remote.HostParams{
+		Address:  host.Address,
+		Port:     host.Port,
+		User:     host.User,
+		JumpHost: host.JumpHost,
+	}
+}
+
 func (c *Cli) setInterpreter(iType string, interpreter string) {
 	switch iType {
 	case "none":
@@ -240,6 +322,7 @@ func (c *Cli) setInterpreter(iType string, interpreter string) {
 
 // Finalize closes resources at xc's exit. Must be called explicitly
 func (c *Cli) Finalize() {
+	remote.CloseConnections()
 	if c.outputFile != nil {
 		c.outputFile.Close()
 		c.outputFile = nil
@@ -279,6 +362,46 @@ func (c *Cli) OneCmd(line string) {
 	}
 }
 
+// Run runs a single command non-interactively and returns the exit code:
+// 0 on success, 1 if the command has failed or has been skipped on any host
+// and 2 if the command couldn't be run at all
+func (c *Cli) Run(line string) int {
+	prev := c.lastResult
+	c.cmdStatus = statusNone
+	c.aliasRecursionCount = maxAliasRecursion
+	c.OneCmd(line)
+
+	if c.cmdStatus != statusNone {
+		// the command has set its own status, i.e. a script
+		return c.cmdStatus
+	}
+
+	if c.lastResult == prev {
+		cmdRunes, _ := split([]rune(strings.TrimSpace(line)))
+		cmd := string(cmdRunes)
+		if _, found := c.handlers[cmd]; !found || producesResult(cmd) {
+			return 2
+		}
+		return 0
+	}
+
+	r := c.lastResult
+	if len(r.ErrorHosts) > 0 || len(r.SkippedHosts) > 0 || r.ForceStoppedHosts > 0 {
+		return 1
+	}
+	return 0
+}
+
+// producesResult returns true if the command runs on hosts
+// leaving the execution result
+func producesResult(cmd string) bool {
+	switch cmd {
+	case "distribute", "retry":
+		return true
+	}
+	return strings.HasSuffix(cmd, "exec") || strings.HasSuffix(cmd, "runscript")
+}
+
 // CmdLoop reads commands and runs OneCmd
 func (c *Cli) CmdLoop() {
 	for !c.stopped {
@@ -348,6 +471,24 @@ func (c *Cli) setOutput(filename string) error {
 	return err
 }
 
+// writeOutputDir saves per-host outputs of the last command
+// if the output dir is set
+func (c *Cli) writeOutputDir(r *remote.ExecResult) {
+	info := remote.RunInfo{
+		Name:    c.lastCommand.name,
+		Mode:    modeMap[c.lastCommand.mode],
+		Command: c.lastCommand.args,
+	}
+	runDir, err := r.WriteOutputDir(info)
+	if err != nil {
+		term.Errorf("Error writing output to %s: %s\n", c.outputDir, err)
+		return
+	}
+	if runDir != "" {
+		term.Successf("Output is saved to %s\n", runDir)
+	}
+}
+
 func (c *Cli) doexec(mode execMode, argsLine string) {
 	var r *remote.ExecResult
 
@@ -383,6 +524,7 @@ func (c *Cli) doexec(mode execMode, argsLine string) {
 	}
 
 	remote.WriteOutput(fmt.Sprintf("==== exec %s\n", argsLine))
+	c.lastCommand = &lastCommand{"exec", mode, cmd}
 
 	switch mode {
 	case emParallel:
@@ -390,9 +532,16 @@ func (c *Cli) doexec(mode execMode, argsLine string) {
 	case emCollapse:
 		r = remote.RunCollapse(hosts, cmd)
 		r.PrintOutputMap()
+	case emDiff:
+		r = remote.RunCollapse(hosts, cmd)
+		r.PrintDiff()
 	case emSerial:
 		r = remote.RunSerial(hosts, cmd, c.delay)
+	case emRolling:
+		r = remote.RunRolling(hosts, cmd, c.rollingOptions())
 	}
+	c.setLastResult(r)
+	c.writeOutputDir(r)
 	r.Print()
 }
 
@@ -451,8 +600,8 @@ func (c *Cli) dorunscript(mode execMode, argsLine string) {
 		defer remote.SetDistributeType(currentDistributeType)
 	}
 
+	c.lastCommand = &lastCommand{"runscript", mode, string(rest)}
 	dr := remote.Distribute(hosts, localFilename, remoteFilename, false)
-	copyError := dr.ErrorHosts
 	hosts = dr.SuccessHosts
 
 	cmd := fmt.Sprintf("%s%s; rm %s", remoteFilename, scriptArgsString, remoteFilename)
@@ -462,10 +611,17 @@ func (c *Cli) dorunscript(mode execMode, argsLine string) {
 	case emCollapse:
 		r = remote.RunCollapse(hosts, cmd)
 		r.PrintOutputMap()
+	case emDiff:
+		r = remote.RunCollapse(hosts, cmd)
+		r.PrintDiff()
 	case emSerial:
 		r = remote.RunSerial(hosts, cmd, c.delay)
+	case emRolling:
+		r = remote.RunRolling(hosts, cmd, c.rollingOptions())
 	}
-	r.ErrorHosts = append(r.ErrorHosts, copyError...)
+	r.MergeFailed(dr)
+	c.setLastResult(r)
+	c.writeOutputDir(r)
 	r.Print()
 }
 
@@ -528,6 +684,38 @@ func (c *Cli) setDistributeType(dtr string) {
 	remote.SetDistributeType(c.distributeType)
 }
 
+func (c *Cli) setTransport(transport string) {
+	switch transport {
+	case "ssh":
+		c.transport = remote.TTExternal
+	case "native":
+		c.transport = remote.TTNative
+	default:
+		term.Errorf("Unknown transport: %s\n", transport)
+		return
+	}
+	remote.SetTransport(c.transport)
+}
+
+// setOutputFormat switches between text and json output,
+// json output goes without colors and other messages go to stderr
+func (c *Cli) setOutputFormat(format string) {
+	switch format {
+	case "text":
+		c.outputFormat = remote.OFText
+		term.SetColors(true)
+		term.SetOutput(os.Stdout)
+	case "json":
+		c.outputFormat = remote.OFJSON
+		term.SetColors(false)
+		term.SetOutput(os.Stderr)
+	default:
+		term.Errorf("Unknown output format: %s\n", format)
+		return
+	}
+	remote.SetOutputFormat(c.outputFormat)
+}
+
 func (c *Cli) runRC(rcfile string) {
 	f, err := os.Open(rcfile)
 	if err != nil {
@@ -20,28 +20,51 @@ type completer struct {
 
 func newCompleter(store *store.Store, commands []string) *completer {
 	x := &completer{commands, make(map[string]completeFunc), store}
-	x.handlers["mode"] = staticCompleter([]string{"collapse", "serial", "parallel"})
+	x.handlers["mode"] = staticCompleter([]string{"collapse", "serial", "parallel", "rolling", "diff"})
 	x.handlers["debug"] = onOffCompleter()
 	x.handlers["progressbar"] = onOffCompleter()
 	x.handlers["prepend_hostnames"] = onOffCompleter()
 	x.handlers["use_password_manager"] = onOffCompleter()
 	x.handlers["natural_sort"] = onOffCompleter()
+	x.handlers["offline"] = onOffCompleter()
+	x.handlers["cache"] = staticCompleter([]string{"purge"})
+	x.handlers["reuse_connections"] = onOffCompleter()
+	x.handlers["separate_stderr"] = onOffCompleter()
+	x.handlers["live_collapse"] = onOffCompleter()
+	x.handlers["last"] = x.completeLast
+	x.handlers["connections"] = x.completeConnections
 	x.handlers["raise"] = staticCompleter([]string{"none", "su", "sudo"})
 	x.handlers["interpreter"] = staticCompleter([]string{"none", "su", "sudo"})
 	x.handlers["exec"] = x.completeExec
 	x.handlers["s_exec"] = x.completeExec
 	x.handlers["c_exec"] = x.completeExec
 	x.handlers["p_exec"] = x.completeExec
+	x.handlers["r_exec"] = x.completeExec
+	x.handlers["d_exec"] = x.completeExec
 	x.handlers["ssh"] = x.completeExec
 	x.handlers["hostlist"] = x.completeExec
+	x.handlers["export"] = x.completeExport
+	x.handlers["host_remove"] = x.completeExec
+	x.handlers["host_move"] = x.completeExec
+	x.handlers["tag_add"] = x.completeExec
+	x.handlers["tag_remove"] = x.completeExec
 	x.handlers["cd"] = completeFiles
 	x.handlers["output"] = completeFiles
+	x.handlers["output_dir"] = completeFiles
+	x.handlers["run"] = completeFiles
+	x.handlers["source"] = completeFiles
+	x.handlers["output_format"] = staticCompleter([]string{"text", "json"})
 	x.handlers["distribute"] = x.completeDistribute
 	x.handlers["runscript"] = x.completeDistribute
 	x.handlers["s_runscript"] = x.completeDistribute
 	x.handlers["c_runscript"] = x.completeDistribute
 	x.handlers["p_runscript"] = x.completeDistribute
+	x.handlers["r_runscript"] = x.completeDistribute
+	x.handlers["d_runscript"] = x.completeDistribute
 	x.handlers["distribute_type"] = staticCompleter([]string{"tar", "scp"})
+	x.handlers["transport"] = staticCompleter([]string{"ssh", "native"})
+	x.handlers["health_check"] = staticCompleter([]string{"off", "remote", "local", "timeout", "interval"})
+	x.handlers["normalize"] = staticCompleter([]string{"trim", "mask", "replace"})
 
 	helpTopics := append(commands, "expressions", "config", "rcfiles", "passmgr")
 	x.handlers["help"] = staticCompleter(helpTopics)
@@ -146,6 +169,34 @@ func (x *completer) completeDistribute(line []rune) ([][]rune, int) {
 	return completeFiles(cmd)
 }
 
+func (x *completer) completeExport(line []rune) ([][]rune, int) {
+	expr, rest := split(line)
+	if rest == nil {
+		return x.completeExec(expr)
+	}
+	format, filename := split(rest)
+	if filename == nil {
+		return staticCompleter(exportFormatNames())(format)
+	}
+	return completeFiles(filename)
+}
+
+func (x *completer) completeConnections(line []rune) ([][]rune, int) {
+	action, expr := split(line)
+	if expr == nil {
+		return staticCompleter([]string{"drop"})(action)
+	}
+	return x.completeExec(expr)
+}
+
+func (x *completer) completeLast(line []rune) ([][]rune, int) {
+	view, filter := split(line)
+	if filter == nil {
+		return staticCompleter(append(lastViews, "ok", "failed"))(view)
+	}
+	return staticCompleter([]string{"ok", "failed", "command", "connection", "copy", "auth", "timeout", "stopped", "local"})(filter)
+}
+
 func (x *completer) completeExec(line []rune) ([][]rune, int) {
 	_, shellCmd := split(line)
 	if shellCmd != nil {
@@ -0,0 +1,328 @@
+package cli
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/viert/xc/config"
+	"github.com/viert/xc/store"
+	"github.com/viert/xc/term"
+)
+
+type exportFunc func(io.Writer, []*store.Host) error
+
+var (
+	exportFormats = map[string]exportFunc{
+		"plain":      exportPlain,
+		"csv":        exportCSV,
+		"json":       exportJSON,
+		"ansible":    exportAnsible,
+		"ssh_config": exportSSHConfig,
+	}
+
+	ansibleGroupExpr = regexp.MustCompile(`[^A-Za-z0-9_]`)
+)
+
+// exportHost is the representation of a host in csv and json formats
+type exportHost struct {
+	FQDN        string   `json:"fqdn"`
+	Group       string   `json:"group,omitempty"`
+	WorkGroup   string   `json:"workgroup,omitempty"`
+	Datacenter  string   `json:"datacenter,omitempty"`
+	Tags        []string `json:"tags"`
+	Aliases     []string `json:"aliases"`
+	Description string   `json:"description,omitempty"`
+	Address     string   `json:"address,omitempty"`
+	Port        int      `json:"port,omitempty"`
+	User        string   `json:"user,omitempty"`
+	JumpHost    string   `json:"jump_host,omitempty"`
+}
+
+func exportFormatNames() []string {
+	names := make([]string, 0, len(exportFormats))
+	for name := range exportFormats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func newExportHost(h *store.Host) *exportHost {
+	eh := &exportHost{
+		FQDN:        h.FQDN,
+		Tags:        h.AllTags,
+		Aliases:     h.Aliases,
+		Description: h.Description,
+		Address:     h.Address,
+		Port:        h.Port,
+		User:        h.User,
+		JumpHost:    h.JumpHost,
+	}
+	if eh.Tags == nil {
+		eh.Tags = make([]string, 0)
+	}
+	if eh.Aliases == nil {
+		eh.Aliases = make([]string, 0)
+	}
+	if h.Group != nil {
+		eh.Group = h.Group.Name
+		if h.Group.WorkGroup != nil {
+			eh.WorkGroup = h.Group.WorkGroup.Name
+		}
+	}
+	if h.Datacenter != nil {
+		eh.Datacenter = h.Datacenter.Name
+	}
+	return eh
+}
+
+func exportPlain(w io.Writer, hosts []*store.Host) error {
+	for _, h := range hosts {
+		_, err := fmt.Fprintln(w, h.FQDN)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func exportCSV(w io.Writer, hosts []*store.Host) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"fqdn", "group", "workgroup", "datacenter", "tags", "aliases",
+		"description", "address", "port", "user", "jump_host"})
+	for _, h := range hosts {
+		eh := newExportHost(h)
+		port := ""
+		if eh.Port > 0 {
+			port = strconv.Itoa(eh.Port)
+		}
+		cw.Write([]string{eh.FQDN, eh.Group, eh.WorkGroup, eh.Datacenter,
+			strings.Join(eh.Tags, ","), strings.Join(eh.Aliases, ","),
+			eh.Description, eh.Address, port, eh.User, eh.JumpHost})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func exportJSON(w io.Writer, hosts []*store.Host) error {
+	data := make([]*exportHost, len(hosts))
+	for i, h := range hosts {
+		data[i] = newExportHost(h)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(data)
+}
+
+// ansibleGroupNames makes unique Ansible group names of the groups given
+// keyed by group id. Groups with valid names keep them, others are sanitized
+// and get a numeric suffix if the result clashes with a name already taken,
+// i.e. "web-1" becomes "web_1_2" if there's a "web_1" group as well
+func ansibleGroupNames(groups map[string]*store.Group) map[string]string {
+	names := make(map[string]string)
+	// the names Ansible defines implicitly
+	taken := map[string]bool{"all": true, "ungrouped": true}
+
+	ids := make([]string, 0, len(groups))
+	for id := range groups {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		gi, gj := groups[ids[i]], groups[ids[j]]
+		if gi.Name != gj.Name {
+			return gi.Name < gj.Name
+		}
+		return gi.ID < gj.ID
+	})
+
+	sanitized := make([]string, 0)
+	for _, id := range ids {
+		name := groups[id].Name
+		if name != "" && !ansibleGroupExpr.MatchString(name) && !taken[name] {
+			names[id] = name
+			taken[name] = true
+		} else {
+			sanitized = append(sanitized, id)
+		}
+	}
+
+	for _, id := range sanitized {
+		base := ansibleGroupExpr.ReplaceAllString(groups[id].Name, "_")
+		if base == "" {
+			base = "_"
+		}
+		name := base
+		for i := 2; taken[name]; i++ {
+			name = fmt.Sprintf("%s_%d", base, i)
+		}
+		names[id] = name
+		taken[name] = true
+	}
+	return names
+}
+
+// exportAnsible writes an ini-style Ansible inventory. Hosts are put into
+// sections named after their groups, and the group hierarchy is preserved
+// using :children sections for the groups present in the export
+func exportAnsible(w io.Writer, hosts []*store.Host) error {
+	sections := make(map[string][]string)
+	order := make([]string, 0)
+	groups := make(map[string]*store.Group)
+
+	for _, h := range hosts {
+		// all the parent groups are to be defined as well
+		for g := h.Group; g != nil; g = g.Parent {
+			groups[g.ID] = g
+		}
+	}
+	names := ansibleGroupNames(groups)
+
+	for _, h := range hosts {
+		section := "ungrouped"
+		if h.Group != nil {
+			section = names[h.Group.ID]
+		}
+		if _, found := sections[section]; !found {
+			order = append(order, section)
+		}
+
+		line := h.FQDN
+		if h.Address != "" {
+			line += " ansible_host=" + h.Address
+		}
+		if h.Port > 0 {
+			line += " ansible_port=" + strconv.Itoa(h.Port)
+		}
+		if h.User != "" {
+			line += " ansible_user=" + h.User
+		}
+		if h.JumpHost != "" {
+			line += fmt.Sprintf(" ansible_ssh_common_args='-o ProxyJump=%s'", h.JumpHost)
+		}
+		sections[section] = append(sections[section], line)
+	}
+
+	for _, section := range order {
+		fmt.Fprintf(w, "[%s]\n", section)
+		for _, line := range sections[section] {
+			fmt.Fprintln(w, line)
+		}
+		fmt.Fprintln(w)
+	}
+
+	children := make(map[string][]string)
+	for _, g := range groups {
+		if g.Parent != nil {
+			parent := names[g.Parent.ID]
+			children[parent] = append(children[parent], names[g.ID])
+		}
+	}
+	parents := make([]string, 0, len(children))
+	for parent := range children {
+		parents = append(parents, parent)
+	}
+	sort.Strings(parents)
+
+	for _, parent := range parents {
+		sort.Strings(children[parent])
+		fmt.Fprintf(w, "[%s:children]\n", parent)
+		for _, child := range children[parent] {
+			fmt.Fprintln(w, child)
+		}
+		_, err := fmt.Fprintln(w)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func exportSSHConfig(w io.Writer, hosts []*store.Host) error {
+	for _, h := range hosts {
+		patterns := append([]string{h.FQDN}, h.Aliases...)
+		fmt.Fprintf(w, "Host %s\n", strings.Join(patterns, " "))
+		address := h.Address
+		if address == "" {
+			address = h.FQDN
+		}
+		fmt.Fprintf(w, "    HostName %s\n", address)
+		if h.Port > 0 {
+			fmt.Fprintf(w, "    Port %d\n", h.Port)
+		}
+		if h.User != "" {
+			fmt.Fprintf(w, "    User %s\n", h.User)
+		}
+		if h.JumpHost != "" {
+			fmt.Fprintf(w, "    ProxyJump %s\n", h.JumpHost)
+		}
+		_, err := fmt.Fprintln(w)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Cli) doExport(name string, argsLine string, args ...string) {
+	if len(args) < 2 || len(args) > 3 {
+		term.Errorf("Usage: export <host_expr> <%s> [filename]\n", strings.Join(exportFormatNames(), "/"))
+		return
+	}
+
+	export, found := exportFormats[args[1]]
+	if !found {
+		term.Errorf("Unknown export format %s, use one of %s\n", args[1], strings.Join(exportFormatNames(), ", "))
+		return
+	}
+
+	hostnames, err := c.store.HostList([]rune(args[0]))
+	if err != nil {
+		term.Errorf("Error parsing expression %s: %s\n", args[0], err)
+		return
+	}
+
+	if len(hostnames) == 0 {
+		term.Errorf("Empty hostlist\n")
+		return
+	}
+
+	hosts := make([]*store.Host, 0, len(hostnames))
+	for _, hostname := range hostnames {
+		host := c.store.Host(hostname)
+		if host == nil {
+			// hosts not found in inventory are allowed in expressions
+			host = &store.Host{FQDN: hostname}
+		}
+		hosts = append(hosts, host)
+	}
+
+	if len(args) < 3 {
+		err = export(os.Stdout, hosts)
+		if err != nil {
+			term.Errorf("Error exporting hosts: %s\n", err)
+		}
+		return
+	}
+
+	filename := config.ExpandPath(args[2])
+	f, err := os.Create(filename)
+	if err != nil {
+		term.Errorf("Error creating %s: %s\n", filename, err)
+		return
+	}
+	defer f.Close()
+
+	err = export(f, hosts)
+	if err != nil {
+		term.Errorf("Error exporting hosts: %s\n", err)
+		return
+	}
+	term.Successf("%d hosts exported to %s\n", len(hosts), filename)
+}
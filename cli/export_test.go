@@ -0,0 +1,162 @@
+package cli
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/viert/xc/store"
+)
+
+func exportTestHosts() []*store.Host {
+	wg := &store.WorkGroup{ID: "wg1", Name: "ops"}
+	dc := &store.Datacenter{ID: "dc1", Name: "dc1"}
+	web := &store.Group{ID: "g1", Name: "web", WorkGroup: wg}
+	front := &store.Group{ID: "g2", Name: "web-front", WorkGroup: wg, Parent: web}
+	db := &store.Group{ID: "g3", Name: "db", WorkGroup: wg}
+
+	return []*store.Host{
+		{
+			FQDN:        "web1.example.com",
+			Group:       front,
+			Datacenter:  dc,
+			AllTags:     []string{"nginx", "prod"},
+			Aliases:     []string{"web1"},
+			Description: "frontend, \"main\"",
+			Address:     "10.0.0.1",
+			Port:        2222,
+			User:        "deploy",
+			JumpHost:    "bastion.example.com",
+		},
+		{
+			FQDN:  "db1.example.com",
+			Group: db,
+		},
+		{
+			FQDN: "unknown.example.com",
+		},
+	}
+}
+
+func checkExport(t *testing.T, export exportFunc, hosts []*store.Host, expected string) {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := export(&buf, hosts); err != nil {
+		t.Fatalf("export error: %s", err)
+	}
+	if buf.String() != expected {
+		t.Errorf("export output is\n%s\nexpected\n%s", buf.String(), expected)
+	}
+}
+
+func TestExportCSV(t *testing.T) {
+	expected := `fqdn,group,workgroup,datacenter,tags,aliases,description,address,port,user,jump_host
+web1.example.com,web-front,ops,dc1,"nginx,prod",web1,"frontend, ""main""",10.0.0.1,2222,deploy,bastion.example.com
+db1.example.com,db,ops,,,,,,,,
+unknown.example.com,,,,,,,,,,
+`
+	checkExport(t, exportCSV, exportTestHosts(), expected)
+}
+
+func TestExportJSON(t *testing.T) {
+	expected := `[
+  {
+    "fqdn": "web1.example.com",
+    "group": "web-front",
+    "workgroup": "ops",
+    "datacenter": "dc1",
+    "tags": [
+      "nginx",
+      "prod"
+    ],
+    "aliases": [
+      "web1"
+    ],
+    "description": "frontend, \"main\"",
+    "address": "10.0.0.1",
+    "port": 2222,
+    "user": "deploy",
+    "jump_host": "bastion.example.com"
+  },
+  {
+    "fqdn": "db1.example.com",
+    "group": "db",
+    "workgroup": "ops",
+    "tags": [],
+    "aliases": []
+  },
+  {
+    "fqdn": "unknown.example.com",
+    "tags": [],
+    "aliases": []
+  }
+]
+`
+	checkExport(t, exportJSON, exportTestHosts(), expected)
+}
+
+func TestExportAnsible(t *testing.T) {
+	expected := `[web_front]
+web1.example.com ansible_host=10.0.0.1 ansible_port=2222 ansible_user=deploy ansible_ssh_common_args='-o ProxyJump=bastion.example.com'
+
+[db]
+db1.example.com
+
+[ungrouped]
+unknown.example.com
+
+[web:children]
+web_front
+
+`
+	checkExport(t, exportAnsible, exportTestHosts(), expected)
+}
+
+func TestExportAnsibleGroupCollisions(t *testing.T) {
+	parent := &store.Group{ID: "g0", Name: "web"}
+	hosts := []*store.Host{
+		{FQDN: "h1", Group: &store.Group{ID: "g1", Name: "web-1", Parent: parent}},
+		{FQDN: "h2", Group: &store.Group{ID: "g2", Name: "web_1", Parent: parent}},
+		{FQDN: "h3", Group: &store.Group{ID: "g3", Name: "web.1", Parent: parent}},
+		{FQDN: "h4", Group: &store.Group{ID: "g4", Name: "ungrouped"}},
+		{FQDN: "h5"},
+	}
+	expected := `[web_1_2]
+h1
+
+[web_1]
+h2
+
+[web_1_3]
+h3
+
+[ungrouped_2]
+h4
+
+[ungrouped]
+h5
+
+[web:children]
+web_1
+web_1_2
+web_1_3
+
+`
+	checkExport(t, exportAnsible, hosts, expected)
+}
+
+func TestExportSSHConfig(t *testing.T) {
+	expected := `Host web1.example.com web1
+    HostName 10.0.0.1
+    Port 2222
+    User deploy
+    ProxyJump bastion.example.com
+
+Host db1.example.com
+    HostName db1.example.com
+
+Host unknown.example.com
+    HostName unknown.example.com
+
+`
+	checkExport(t, exportSSHConfig, exportTestHosts(), expected)
+}
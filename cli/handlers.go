@@ -8,12 +8,15 @@ import (
 	"runtime"
 	"runtime/debug"
 	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/viert/xc/config"
 
 	"github.com/viert/xc/passmgr"
 	"github.com/viert/xc/remote"
+	"github.com/viert/xc/store"
 	"github.com/viert/xc/term"
 )
 
@@ -24,12 +27,17 @@ func (c *Cli) setupCmdHandlers() {
 	c.handlers["parallel"] = c.doParallel
 	c.handlers["collapse"] = c.doCollapse
 	c.handlers["serial"] = c.doSerial
+	c.handlers["rolling"] = c.doRolling
+	c.handlers["diff"] = c.doDiff
 	c.handlers["user"] = c.doUser
 	c.handlers["hostlist"] = c.doHostlist
+	c.handlers["export"] = c.doExport
 	c.handlers["exec"] = c.doExec
 	c.handlers["s_exec"] = c.doSExec
 	c.handlers["c_exec"] = c.doCExec
 	c.handlers["p_exec"] = c.doPExec
+	c.handlers["r_exec"] = c.doRExec
+	c.handlers["d_exec"] = c.doDExec
 	c.handlers["ssh"] = c.doSSH
 	c.handlers["raise"] = c.doRaise
 	c.handlers["passwd"] = c.doPasswd
@@ -37,22 +45,47 @@ func (c *Cli) setupCmdHandlers() {
 	c.handlers["local"] = c.doLocal
 	c.handlers["alias"] = c.doAlias
 	c.handlers["delay"] = c.doDelay
+	c.handlers["batch_size"] = c.doBatchSize
+	c.handlers["max_failures"] = c.doMaxFailures
+	c.handlers["health_check"] = c.doHealthCheck
+	c.handlers["normalize"] = c.doNormalize
+	c.handlers["live_collapse"] = c.doLiveCollapse
 	c.handlers["debug"] = c.doDebug
 	c.handlers["reload"] = c.doReload
+	c.handlers["offline"] = c.doOffline
+	c.handlers["cache"] = c.doCache
+	c.handlers["host_add"] = c.doHostAdd
+	c.handlers["host_remove"] = c.doHostRemove
+	c.handlers["host_move"] = c.doHostMove
+	c.handlers["tag_add"] = c.doTagAdd
+	c.handlers["tag_remove"] = c.doTagRemove
 	c.handlers["interpreter"] = c.doInterpreter
 	c.handlers["connect_timeout"] = c.doConnectTimeout
+	c.handlers["timeout"] = c.doTimeout
 	c.handlers["progressbar"] = c.doProgressBar
+	c.handlers["reuse_connections"] = c.doReuseConnections
+	c.handlers["connections"] = c.doConnections
 	c.handlers["prepend_hostnames"] = c.doPrependHostnames
+	c.handlers["separate_stderr"] = c.doSeparateStderr
+	c.handlers["last"] = c.doLast
+	c.handlers["retry"] = c.doRetry
 	c.handlers["help"] = c.doHelp
 	c.handlers["output"] = c.doOutput
+	c.handlers["output_dir"] = c.doOutputDir
+	c.handlers["output_format"] = c.doOutputFormat
+	c.handlers["run"] = c.doRun
+	c.handlers["source"] = c.doSource
 	c.handlers["threads"] = c.doThreads
 	c.handlers["distribute"] = c.doDistribute
 	c.handlers["runscript"] = c.doRunScript
 	c.handlers["s_runscript"] = c.doSRunScript
 	c.handlers["c_runscript"] = c.doCRunScript
 	c.handlers["p_runscript"] = c.doPRunScript
+	c.handlers["r_runscript"] = c.doRRunScript
+	c.handlers["d_runscript"] = c.doDRunScript
 	c.handlers["use_password_manager"] = c.doUsePasswordManager
 	c.handlers["distribute_type"] = c.doDistributeType
+	c.handlers["transport"] = c.doTransport
 	c.handlers["_passmgr_debug"] = c.doPassmgrDebug
 	c.handlers["version"] = c.doVersion
 	c.handlers["goruntime"] = c.doGoruntime
@@ -88,7 +121,7 @@ func (c *Cli) doMemoryDump(name string, argsLine string, args ...string) {
 
 func (c *Cli) doMode(name string, argsLine string, args ...string) {
 	if len(args) < 1 {
-		term.Errorf("Usage: mode <[serial,parallel,collapse]>\n")
+		term.Errorf("Usage: mode <[serial,parallel,collapse,rolling,diff]>\n")
 		return
 	}
 	newMode := args[0]
@@ -113,6 +146,14 @@ func (c *Cli) doSerial(name string, argsLine string, args ...string) {
 	c.doMode("mode", "serial", "serial")
 }
 
+func (c *Cli) doRolling(name string, argsLine string, args ...string) {
+	c.doMode("mode", "rolling", "rolling")
+}
+
+func (c *Cli) doDiff(name string, argsLine string, args ...string) {
+	c.doMode("mode", "diff", "diff")
+}
+
 func (c *Cli) doUser(name string, argsLine string, args ...string) {
 	if len(args) < 1 {
 		term.Errorf("Usage: user <username>\n")
@@ -184,6 +225,32 @@ func (c *Cli) doDistributeType(name string, argsLine string, args ...string) {
 	term.Successf("distribute_type set to %s\n", args[0])
 }
 
+func (c *Cli) doTransport(name string, argsLine string, args ...string) {
+	if len(args) < 1 {
+		transport := "ssh"
+		if c.transport == remote.TTNative {
+			transport = "native"
+		}
+		term.Warnf("transport is %s\n", transport)
+		return
+	}
+	c.setTransport(args[0])
+	term.Successf("transport set to %s\n", args[0])
+}
+
+func (c *Cli) doOutputFormat(name string, argsLine string, args ...string) {
+	if len(args) < 1 {
+		format := "text"
+		if c.outputFormat == remote.OFJSON {
+			format = "json"
+		}
+		term.Warnf("output format is %s\n", format)
+		return
+	}
+	c.setOutputFormat(args[0])
+	term.Successf("output format set to %s\n", args[0])
+}
+
 func (c *Cli) doPasswd(name string, argsLine string, args ...string) {
 	passwd, err := c.rl.ReadPassword("Set su/sudo password: ")
 	if err != nil {
@@ -209,6 +276,14 @@ func (c *Cli) doPExec(name string, argsLine string, args ...string) {
 	c.doexec(emParallel, argsLine)
 }
 
+func (c *Cli) doRExec(name string, argsLine string, args ...string) {
+	c.doexec(emRolling, argsLine)
+}
+
+func (c *Cli) doDExec(name string, argsLine string, args ...string) {
+	c.doexec(emDiff, argsLine)
+}
+
 func (c *Cli) doSSH(name string, argsLine string, args ...string) {
 	if len(args) < 1 {
 		term.Errorf("Usage: ssh <inventoree_expr>\n")
@@ -301,6 +376,92 @@ func (c *Cli) doDelay(name string, argsLine string, args ...string) {
 	c.delay = int(sec)
 }
 
+func (c *Cli) setThreshold(name string, dest *remote.Threshold, value string) bool {
+	t, err := remote.ParseThreshold(value)
+	if err != nil {
+		term.Errorf("Invalid %s: %s\n", name, err)
+		return false
+	}
+	*dest = t
+	return true
+}
+
+func (c *Cli) doBatchSize(name string, argsLine string, args ...string) {
+	if len(args) < 1 {
+		term.Warnf("Current batch size: %s\n", c.batchSize)
+		return
+	}
+	if args[0] == "0" || args[0] == "0%" {
+		term.Errorf("Invalid batch_size: batch can't be empty\n")
+		return
+	}
+	c.setThreshold(name, &c.batchSize, args[0])
+}
+
+func (c *Cli) applyHealthCheck() {
+	if c.healthCheck.Cmd == "" {
+		remote.SetHealthCheck(nil)
+		return
+	}
+	hc := c.healthCheck
+	remote.SetHealthCheck(&hc)
+}
+
+func (c *Cli) doHealthCheck(name string, argsLine string, args ...string) {
+	if len(args) < 1 {
+		if c.healthCheck.Cmd == "" {
+			term.Warnf("Health check is off\n")
+		} else {
+			term.Warnf("Health check is %s\n", c.healthCheck.String())
+		}
+		return
+	}
+
+	switch args[0] {
+	case "off":
+		if len(args) > 1 {
+			break
+		}
+		c.healthCheck.Cmd = ""
+		c.applyHealthCheck()
+		return
+	case "timeout", "interval":
+		if len(args) != 2 {
+			break
+		}
+		sec, err := strconv.ParseInt(args[1], 10, 32)
+		if err != nil || sec < 1 {
+			term.Errorf("Invalid %s value: %s\n", args[0], args[1])
+			return
+		}
+		if args[0] == "timeout" {
+			c.healthCheck.Timeout = int(sec)
+		} else {
+			c.healthCheck.Interval = int(sec)
+		}
+		c.applyHealthCheck()
+		return
+	case "remote", "local":
+		_, cmd := split([]rune(argsLine))
+		if len(cmd) == 0 {
+			break
+		}
+		c.healthCheck.Cmd = string(cmd)
+		c.healthCheck.Local = args[0] == "local"
+		c.applyHealthCheck()
+		return
+	}
+	term.Errorf("Usage: health_check [off/remote <command>/local <command>/timeout <seconds>/interval <seconds>]\n")
+}
+
+func (c *Cli) doMaxFailures(name string, argsLine string, args ...string) {
+	if len(args) < 1 {
+		term.Warnf("Current max failures: %s\n", c.maxFailures)
+		return
+	}
+	c.setThreshold(name, &c.maxFailures, args[0])
+}
+
 func (c *Cli) doDebug(name string, argsLine string, args ...string) {
 	if doOnOff("debug", &c.debug, args) {
 		remote.SetDebug(c.debug)
@@ -319,12 +480,62 @@ func (c *Cli) doProgressBar(name string, argsLine string, args ...string) {
 	}
 }
 
+func (c *Cli) doReuseConnections(name string, argsLine string, args ...string) {
+	if doOnOff("reuse_connections", &c.reuseConnections, args) {
+		remote.SetReuseConnections(c.reuseConnections)
+	}
+}
+
+func (c *Cli) doConnections(name string, argsLine string, args ...string) {
+	if len(args) > 0 {
+		if args[0] != "drop" || len(args) > 2 {
+			term.Errorf("Usage: connections [drop [host_expr]]\n")
+			return
+		}
+		var hosts []string
+		if len(args) == 2 {
+			var err error
+			hosts, err = c.store.HostList([]rune(args[1]))
+			if err != nil {
+				term.Errorf("Error parsing expression %s: %s\n", args[1], err)
+				return
+			}
+		}
+		count := remote.DropConnections(hosts)
+		term.Successf("%d connection(s) dropped\n", count)
+		return
+	}
+
+	conns := remote.Connections()
+	if len(conns) == 0 {
+		term.Warnf("No connections kept open\n")
+		return
+	}
+	for _, ci := range conns {
+		idle := time.Since(ci.LastUsed).Round(time.Second)
+		fmt.Printf("%-40s %-30s %-7s idle %s\n", ci.Host, ci.Address, ci.Transport, idle)
+	}
+	term.Successf("%d connection(s) kept open\n", len(conns))
+}
+
 func (c *Cli) doPrependHostnames(name string, argsLine string, args ...string) {
 	if doOnOff("prepend_hostnames", &c.prependHostnames, args) {
 		remote.SetPrependHostnames(c.prependHostnames)
 	}
 }
 
+func (c *Cli) doSeparateStderr(name string, argsLine string, args ...string) {
+	if doOnOff("separate_stderr", &c.separateStderr, args) {
+		remote.SetSeparateStderr(c.separateStderr)
+	}
+}
+
+func (c *Cli) doLiveCollapse(name string, argsLine string, args ...string) {
+	if doOnOff("live_collapse", &c.liveCollapse, args) {
+		remote.SetLiveCollapse(c.liveCollapse)
+	}
+}
+
 func (c *Cli) doUsePasswordManager(name string, argsLine string, args ...string) {
 	if doOnOff("use_password_manager", &c.usePasswordMgr, args) {
 		if c.usePasswordMgr && !passmgr.Ready() {
@@ -345,6 +556,178 @@ func (c *Cli) doReload(name string, argsLine string, args ...string) {
 	}
 }
 
+func (c *Cli) cachedBackend() store.CachedBackend {
+	cb, ok := c.store.Backend().(store.CachedBackend)
+	if !ok {
+		term.Errorf("The backend doesn't use cache\n")
+		return nil
+	}
+	return cb
+}
+
+func (c *Cli) doOffline(name string, argsLine string, args ...string) {
+	cb := c.cachedBackend()
+	if cb == nil {
+		return
+	}
+	offline := cb.Offline()
+	if doOnOff("offline", &offline, args) {
+		cb.SetOffline(offline)
+	}
+}
+
+func (c *Cli) doCache(name string, argsLine string, args ...string) {
+	cb := c.cachedBackend()
+	if cb == nil {
+		return
+	}
+
+	if len(args) > 0 {
+		if args[0] != "purge" {
+			term.Errorf("Usage: cache [purge]\n")
+			return
+		}
+		err := cb.PurgeCache()
+		if err != nil {
+			term.Errorf("Error purging cache: %s\n", err)
+			return
+		}
+		term.Successf("Cache purged\n")
+		return
+	}
+
+	ci := cb.CacheInfo()
+	be := c.store.Backend()
+	mode := "online"
+	if cb.Offline() {
+		mode = "offline"
+	}
+
+	term.Warnf("Cache File:          %s\n", ci.Filename)
+	if ci.Exists {
+		age := time.Since(ci.ModTime).Round(time.Second)
+		state := "valid"
+		if age > ci.TTL {
+			state = "expired"
+		}
+		term.Warnf("Modified:            %s\n", ci.ModTime.Format("2006-01-02 15:04:05"))
+		term.Warnf("Age:                 %s (%s)\n", age, state)
+	} else {
+		term.Warnf("Modified:            never, cache file doesn't exist\n")
+	}
+	term.Warnf("TTL:                 %s\n", ci.TTL)
+	term.Warnf("Mode:                %s\n\n", mode)
+	term.Warnf("Datacenters:         %d\n", len(be.Datacenters()))
+	term.Warnf("Workgroups:          %d\n", len(be.WorkGroups()))
+	term.Warnf("Groups:              %d\n", len(be.Groups()))
+	term.Warnf("Hosts:               %d\n", len(be.Hosts()))
+}
+
+func (c *Cli) writer() store.Writer {
+	w, ok := c.store.Backend().(store.Writer)
+	if !ok {
+		term.Errorf("The backend doesn't support modifications\n")
+		return nil
+	}
+	return w
+}
+
+func (c *Cli) doHostAdd(name string, argsLine string, args ...string) {
+	if len(args) < 1 || args[0] == "" || len(args) > 3 {
+		term.Errorf("Usage: host_add <fqdn> [group [datacenter]]\n")
+		return
+	}
+	w := c.writer()
+	if w == nil {
+		return
+	}
+
+	host := &store.Host{FQDN: args[0]}
+	if len(args) > 1 {
+		host.GroupID = args[1]
+	}
+	if len(args) > 2 {
+		host.DatacenterID = args[2]
+	}
+
+	err := w.AddHost(host)
+	if err != nil {
+		term.Errorf("Error adding host: %s\n", err)
+		return
+	}
+	term.Successf("Host %s added\n", host.FQDN)
+}
+
+// modifyHosts resolves the host expression and runs a writer
+// modification on the resulting hostlist
+func (c *Cli) modifyHosts(expr string, modifier func(store.Writer, []string) error) {
+	w := c.writer()
+	if w == nil {
+		return
+	}
+
+	hosts, err := c.store.HostList([]rune(expr))
+	if err != nil {
+		term.Errorf("Error parsing expression %s: %s\n", expr, err)
+		return
+	}
+
+	if len(hosts) == 0 {
+		term.Errorf("Empty hostlist\n")
+		return
+	}
+
+	err = modifier(w, hosts)
+	if err != nil {
+		term.Errorf("Error modifying hosts: %s\n", err)
+		return
+	}
+	term.Successf("%d hosts modified\n", len(hosts))
+}
+
+func (c *Cli) doHostRemove(name string, argsLine string, args ...string) {
+	if len(args) != 1 || args[0] == "" {
+		term.Errorf("Usage: host_remove <host_expr>\n")
+		return
+	}
+	c.modifyHosts(args[0], func(w store.Writer, hosts []string) error {
+		if c.execConfirm && !c.confirm(fmt.Sprintf("Remove %s?", strings.Join(hosts, ", "))) {
+			return fmt.Errorf("cancelled")
+		}
+		return w.RemoveHosts(hosts)
+	})
+}
+
+func (c *Cli) doHostMove(name string, argsLine string, args ...string) {
+	if len(args) != 2 {
+		term.Errorf("Usage: host_move <host_expr> <group>\n")
+		return
+	}
+	c.modifyHosts(args[0], func(w store.Writer, hosts []string) error {
+		return w.MoveHosts(hosts, args[1])
+	})
+}
+
+func (c *Cli) doTagAdd(name string, argsLine string, args ...string) {
+	if len(args) < 2 {
+		term.Errorf("Usage: tag_add <host_expr> <tag> [...tags]\n")
+		return
+	}
+	c.modifyHosts(args[0], func(w store.Writer, hosts []string) error {
+		return w.AddTags(hosts, args[1:])
+	})
+}
+
+func (c *Cli) doTagRemove(name string, argsLine string, args ...string) {
+	if len(args) < 2 {
+		term.Errorf("Usage: tag_remove <host_expr> <tag> [...tags]\n")
+		return
+	}
+	c.modifyHosts(args[0], func(w store.Writer, hosts []string) error {
+		return w.RemoveTags(hosts, args[1:])
+	})
+}
+
 func (c *Cli) doInterpreter(name string, argsLine string, args ...string) {
 	if len(args) == 0 {
 		term.Warnf("Using \"%s\" for commands with none-type raise\n", c.interpreter)
@@ -370,6 +753,25 @@ func (c *Cli) doConnectTimeout(name string, argsLine string, args ...string) {
 	remote.SetConnectTimeout(c.connectTimeout)
 }
 
+func (c *Cli) doTimeout(name string, argsLine string, args ...string) {
+	if len(args) < 1 {
+		if c.commandTimeout == 0 {
+			term.Warnf("timeout is off\n")
+		} else {
+			term.Warnf("timeout = %d\n", c.commandTimeout)
+		}
+		return
+	}
+	timeout, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil || timeout < 0 {
+		term.Errorf("Invalid timeout value %s, use a number of seconds or 0 to switch it off\n", args[0])
+		return
+	}
+	c.commandTimeout = int(timeout)
+	remote.SetCommandTimeout(c.commandTimeout)
+	term.Successf("timeout set to %d\n", c.commandTimeout)
+}
+
 func (c *Cli) doOutput(name string, argsLine string, args ...string) {
 	if len(args) == 0 {
 		if c.outputFile == nil {
@@ -402,6 +804,35 @@ func (c *Cli) doOutput(name string, argsLine string, args ...string) {
 	}
 }
 
+func (c *Cli) doOutputDir(name string, argsLine string, args ...string) {
+	if len(args) == 0 {
+		if c.outputDir == "" {
+			term.Warnf("Output dir is switched off\n")
+		} else {
+			term.Successf("Output is saved to %s\n", c.outputDir)
+		}
+		return
+	}
+
+	// special dirname to switch off the output
+	if argsLine == "_" {
+		c.outputDir = ""
+		remote.SetOutputDir("")
+		term.Warnf("Output dir is switched off\n")
+		return
+	}
+
+	dir := config.ExpandPath(argsLine)
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		term.Errorf("Error setting output dir to %s: %s\n", argsLine, err)
+		return
+	}
+	c.outputDir = dir
+	remote.SetOutputDir(c.outputDir)
+	term.Successf("Output is saved to %s\n", c.outputDir)
+}
+
 func (c *Cli) doThreads(name string, argsLine string, args ...string) {
 	if len(args) == 0 {
 		term.Successf("Max SSH threads: %d\n", c.sshThreads)
@@ -480,7 +911,10 @@ func (c *Cli) doDistribute(name string, argsLine string, args ...string) {
 		return
 	}
 
+	c.lastCommand = &lastCommand{"distribute", c.mode, string(rest)}
 	r = remote.Distribute(hosts, localFilename, remoteFilename, st.IsDir())
+	c.setLastResult(r)
+	c.writeOutputDir(r)
 	r.Print()
 }
 
@@ -500,6 +934,14 @@ func (c *Cli) doPRunScript(name string, argsLine string, args ...string) {
 	c.dorunscript(emParallel, argsLine)
 }
 
+func (c *Cli) doRRunScript(name string, argsLine string, args ...string) {
+	c.dorunscript(emRolling, argsLine)
+}
+
+func (c *Cli) doDRunScript(name string, argsLine string, args ...string) {
+	c.dorunscript(emDiff, argsLine)
+}
+
 func (c *Cli) doPassmgrDebug(name string, argsLine string, args ...string) {
 	passmgr.PrintDebug()
 }
@@ -21,7 +21,7 @@ var (
 List of hosts is represented by <host_expression> in its own syntax which can be learned 
 by using "help expressions" command.
 
-exec can proceed in 3 different modes: serial, parallel and collapse.
+exec can proceed in 5 different modes: serial, parallel, collapse, rolling and diff.
 
 In ` + term.Colored("serial", term.CWhite, true) + ` mode the command will be called server by server sequentally. Between servers in list 
 xc will hold for a delay which can be set with command "delay".
@@ -36,11 +36,20 @@ the execution is over. In this mode xc prints the result grouped by the output s
 between hosts become more obvious. Try running "exec %group cat /etc/redhat-release" on a big
 group of hosts in collapse mode to see if they have the same version of OS for example.
 
+In ` + term.Colored("rolling", term.CWhite, true) + ` mode the hosts are split into batches which are run one by one, every batch in parallel.
+The execution is aborted as soon as too many hosts fail. See "help rolling" for more info.
+
+The ` + term.Colored("diff", term.CWhite, true) + ` mode runs the command like collapse mode does, then prints the output of the largest group
+as the baseline followed by a unified diff of every other group against it. Try running
+"exec %group cat /etc/foo.conf" in diff mode to find the configuration drift.
+
 While the execution mode can be switched by "mode" command, there's a couple of shortcuts: 
     c_exec 
     p_exec
     s_exec 
-which are capable to run exec in collapse, parallel or serial mode correspondingly without switching
+    r_exec
+    d_exec
+which are capable to run exec in collapse, parallel, serial, rolling or diff mode correspondingly without switching
 the execution mode`,
 	}
 
@@ -54,10 +63,49 @@ runscript simply copies the script to every server in the list and then
 run it according to current execution mode (Type "help exec" to learn more 
 on execution modes), i.e. it can run in parallel or sequentally like exec does.
 
-There are also shortcut aliases c_runscript, s_runscript and p_runscript for calling runscript
+There are also shortcut aliases c_runscript, s_runscript, p_runscript, r_runscript and d_runscript for calling runscript
 in a particular execution mode without permanent switching to it.`,
 	}
 
+	scriptHelp = &helpItem{
+		usage: "<filename> [<name>=<value> ...]",
+		help: `Runs a script of xc commands. "run" starts the script with a fresh set of variables
+while "source" shares them with the session and other sourced scripts. Variables may be
+set in the command line, i.e. "run deploy.xc group=%web". Non-interactively a script is
+run as "xc run deploy.xc" and its status becomes the exit code of xc.
+
+Every line of a script is an xc command or one of the statements below, lines starting
+with # are comments:
+
+    let <name> = <value>               sets a variable, it's referenced as ${name} anywhere
+                                       in the following lines. References to undefined
+                                       variables are left as is for the remote shell
+    stop_on_error <on/off>             stops the script when a command fails on any host
+                                       or can't be run at all, off by default
+    if [not] <condition> ... end       runs the statements if the last execution result
+    if [not] <condition> ... else ...  matches the condition: "ok" (no host has failed),
+    end                                "failed", "timeout" or "skipped" (any host has)
+    for <name> in <host_expr> ... end  runs the statements for every host of the expression
+    exit [<code>]                      stops the script with the code given, 0 by default
+
+The whole script is checked for syntax errors before running. Example:
+
+    stop_on_error on
+    let svc = nginx
+    c_exec ${group} sudo systemctl restart ${svc}
+    stop_on_error off
+    c_exec ${group} systemctl is-active ${svc}
+    if failed
+        for host in $failed
+            s_exec ${host} sudo journalctl -u ${svc} -n 20
+        end
+        exit 1
+    end
+
+Rcfiles are not scripts, their lines are run one by one as commands. Use "source"
+in an rcfile to run a script sharing its variables with the session.`,
+	}
+
 	modeHelp = `Switches execution mode
 
 To learn more about execution modes type "help exec".
@@ -95,6 +143,7 @@ to default values:
 [main]
 user = 
 mode = parallel
+output_format = text
 history_file = ~/.xc_history
 cache_dir = ~/.xc_cache
 cache_ttl = 336 # 24 * 7 * 2
@@ -103,22 +152,42 @@ raise = none
 exit_confirm = true
 exec_confirm = false
 log_file = ~/xc.log
+output_dir = ~/xc_runs
 distribute = scp
 debug = false
 
 [executer]
 ssh_threads = 50
 ssh_connect_timeout = 1
+command_timeout = 0
 ssh_command = /usr/bin/ssh
+transport = ssh
+reuse_connections = false
 progress_bar = true
 prepend_hostnames = true
+separate_stderr = false
 remote_tmpdir = /tmp
 delay = 0
+batch_size = 10%
+max_failures = 0
+health_check = curl -sf localhost/health
+health_check_local = false
+health_check_timeout = 60
+health_check_interval = 5
 
 interpreter = bash
 interpreter_sudo = sudo bash
 interpreter_su = su -
 
+[collapse]
+trim_whitespace = true
+mask_hostnames = true
+live = true
+
+[collapse_replace]
+time = \d\d:\d\d:\d\d
+pid = pid \d+
+
 [backend]
 type = inventoree
 url = http://inventory-stage.infra.cloud.devmail.ru
@@ -133,11 +202,18 @@ Configuration is split to 3 sections: main, executer and backend.
 
     mode is the execution mode which will be set on xc startup. See "help mode" for more info on execution modes.
 
+    output_format is either text or json. The same is achieved by starting xc with "-o json".
+    See "help output_format" for more info.
+
     history_file sets the history file
 
     cache_dir sets the cache dir for data derived from inventoree
 
-    cache_ttl sets cache ttl (in hours)
+    cache_ttl sets cache ttl (in hours). Expired cache is still used on startup while fresh data is
+    being loaded in background, so a slow or unavailable backend API doesn't block xc.
+
+    offline makes the backend use the local cache only, never contacting the API. The same
+    is achieved by starting xc with -offline flag. See "help offline" for more info.
 
     rc_file is the rcfile which will be executed on xc startup. See "help rcfiles" for more info.
 
@@ -145,6 +221,8 @@ Configuration is split to 3 sections: main, executer and backend.
 
     exit_confirm is boolean setting for disable or enable confirmation on exit
 
+    output_dir sets the directory the output of every host is saved to. See "help output_dir" for more info.
+
     distribute sets initial distribute type to either tar or scp. See "help distribute_type" to learn more.
 
     debug sets initial debug logging on/off.
@@ -154,15 +232,39 @@ Configuration is split to 3 sections: main, executer and backend.
 
     ssh_connect_timeout sets the default ssh connect timeout. You can change it at any moment using connect_timeout command.
 
+    command_timeout sets the default per-host command timeout in seconds, 0 means no timeout.
+    See "help timeout" for more info.
+
+    transport sets the way xc connects to hosts in parallel, collapse and rolling modes, either "ssh" or "native".
+    See "help transport" for more info.
+
+    reuse_connections keeps connections to hosts open between commands. See "help reuse_connections".
+
     progress_bar sets progressbar on or off on xc startup
 
+    separate_stderr runs commands without a terminal to keep stderr apart from stdout. See "help separate_stderr".
+
     remote_tmpdir is a temporary directory used on remote servers for various xc needs
 
-    delay sets a delay in seconds between hosts when executing in serial mode. See "help delay" for more info
+    delay sets a delay in seconds between hosts when executing in serial mode and between batches
+    in rolling mode. See "help delay" for more info
+
+    batch_size and max_failures set the batch size and the number of failed hosts tolerated in
+    rolling mode, either a number of hosts or a percentage, i.e. "5" or "10%". See "help rolling".
+
+    health_check sets a command checking hosts after the main command in serial and rolling modes,
+    health_check_local runs it locally, health_check_timeout and health_check_interval set the time
+    to wait for the check to pass and the pause between attempts. See "help health_check".
 
     interpreter_* sets commands executed remotely to boot the necessary interpreter according to current "raise" mode
 
-The [backend] section sets data storage backend. Three backends are currently supported: inventoree, conductor and ini. The backend type is set by a mandatory option "type".
+The [collapse] section sets how outputs are normalized before grouping hosts in collapse mode. trim_whitespace
+removes trailing spaces and empty lines, mask_hostnames replaces the host name in its output with <host>.
+Every option of [collapse_replace] section is a regex, the matching parts of output are replaced by the option
+name in angle brackets, i.e. "time = \d\d:\d\d:\d\d" turns timestamps into <time>. See "help normalize".
+live turns on the live view of collapse mode, see "help live_collapse".
+
+The [backend] section sets data storage backend. Six backends are currently supported: inventoree, conductor, ini, ec2, consul and external. The backend type is set by a mandatory option "type".
 
   1. "ini" backend stores hosts and groups in a local ini-file.
     There's only one option "filename" to tell xc where to find the ini-file.
@@ -172,17 +274,24 @@ The [backend] section sets data storage backend. Three backends are currently su
 workgroup1
 
 [groups]
-group1 work_group=workgroup1
-group2 work_grlup=workgroup2 parent=group1
+group1 wg=workgroup1
+group2 wg=workgroup1 parent=group1 tags=tag1,tag2
 
 [hosts]
 host1.example.com group=group1 datacenter=dc1.1
-host2.example.com group=group2 datacenter=dc1.1
+host2.example.com group=group2 datacenter=dc1.1 tags=tag3 aliases=h2 desc="my host" # a comment
 
 [datacenters]
 dc1
 dc1.1 parent=dc1
 
+    Hosts may have connection parameters: address, port, user and jump (a jump host for ssh -J),
+    xc connects using them while still showing the hostname.
+
+    Values containing spaces may be quoted, tags and aliases options may be repeated.
+    All the errors found in the file are reported at once with line numbers. References
+    to undefined objects are reported as warnings and the file is loaded anyway.
+
   2. "conductor" loads hosts and groups via inventoree v1 API which is deprecated
 
   3. "inventoree" is the most modern way to store your data. Options are following:
@@ -191,7 +300,49 @@ dc1.1 parent=dc1
 	work_groups - a comma-separated list of workgroups to load. If the list is empty, xc will load all the workgroups which could increase loading time dramatically.
 	host_key_field - may be set to either "fqdn" or "ssh_hostname", this tells xc what a host is identified by.
                      ssh_hostname in its turn is a computed field in inventoree >= 7.2-45 which may be configured
-                     in custom data field "ssh_hostname" like aliases are configured (using $0, $1, $2 etc as domain parts)
+                     in custom data field "ssh_hostname" like aliases are configured (using $0, $1, $2 etc as domain parts).
+                     With "fqdn" host key, ssh_hostname is still used as the address to connect to.
+	fetch_threads - the number of simultaneous API requests while loading workgroups data, 8 by default
+	incremental - if set to true, only hosts modified since the last load are fetched (using "updated_at" field),
+                  hosts deleted from inventoree are detected by fetching the list of host ids
+
+  HTTP-based backends (conductor, inventoree, ec2 and consul with url) share the following options:
+	timeout - request timeout in seconds (or a duration like "1m30s"), 30 by default
+	retries - number of retries on network errors and 5xx responses, 2 by default
+	retry_delay - delay before the first retry in seconds, doubled on every next attempt, 1 by default
+	insecure - skip TLS certificate verification
+	ca_bundle - path to a PEM file with additional CA certificates
+	client_cert, client_key - paths to PEM client certificate and key for TLS client authentication
+	auth_token_file - read auth token from a file instead of auth_token
+	auth_token_command - run a command and use its output as auth token
+	auth_header - HTTP header to pass the auth token in, "X-Api-Auth-Token" by default
+
+  4. "ec2" loads instances from EC2 DescribeInstances JSON. Options are following:
+	filename - a comma-separated list of files containing "aws ec2 describe-instances" output
+	url - an endpoint serving the same JSON, may be used instead of or along with filename
+	group_tag - the tag used as the main group of a host, "Name" by default
+	parent_tag - the tag used as the parent group, "role" by default
+	workgroup - the workgroup to put all the groups in, "devops" by default
+	host_field - PublicDnsName (default), PrivateDnsName, PublicIpAddress or PrivateIpAddress
+	include_stopped - load instances which are not running, false by default
+
+  5. "consul" loads nodes and services from Consul catalog. Options are following:
+	filename - a comma-separated list of catalog dump files, see README for the format
+	url - Consul HTTP API address, i.e. http://127.0.0.1:8500, may be used along with filename
+	datacenters - a comma-separated list of datacenters to load, all the datacenters by default
+	domain - a domain appended to node names to make fqdns, short node names become aliases
+	workgroup - the workgroup to put all the groups in, "consul" by default
+	skip_services - a comma-separated list of services to ignore, "consul" by default
+	auth_token is passed in X-Consul-Token header unless auth_header is set.
+	Every service becomes a group, node meta becomes "key=value" host tags. A node belongs to
+	the group of its first service in alphabetical order, all of its services are reflected
+	in "service=<name>" tags, i.e. "#service=web" selects all the nodes providing web service.
+
+  6. "external" runs a command and reads inventory JSON from its stdout. Options are following:
+	command - a shell command printing the inventory, see README for the JSON format
+	timeout - the command timeout in seconds, 60 by default
+	Any other option is passed to the command as XC_BACKEND_<OPTION> environment variable.
+	XC_ACTION variable is set to "load" on startup and to "reload" on "reload" command.
 
 `,
 		},
@@ -200,7 +351,9 @@ dc1.1 parent=dc1
 			isTopic: true,
 			help: `Rcfile configured in .xc.conf file is executed every time xc starts.
 It may be useful for configuring aliases (as they are dropped when xc exits) and other options.
-Rcfile is just a number of xc commands in a text file.`,
+Rcfile is just a number of xc commands in a text file, every line is run on its own
+so an invalid line doesn't prevent the rest from running. Use "source" to run a script
+from it, see "help run" for more info.`,
 		},
 
 		"passmgr": {
@@ -227,8 +380,8 @@ https://medium.com/learning-the-go-programming-language/writing-modular-go-progr
 
 		"delay": {
 			usage: "<seconds>",
-			help: `Sets a delay between hosts when in serial mode. This is useful for soft restarting
-i.e. when you want to give a service some time to warm up before restarting it on next host.`,
+			help: `Sets a delay between hosts when in serial mode and between batches in rolling mode. This is useful
+for soft restarting i.e. when you want to give a service some time to warm up before restarting it on next host.`,
 		},
 
 		"distribute": {
@@ -267,6 +420,11 @@ Some self-explanatory examples:
     *myworkgroup@dc2,-%group3,host5     - all hosts from wg "myworkgroup" excluding hosts from group3, plus host5
 	%group5#tag1                        - all hosts from group5 tagged with tag1
 	&hosts.txt                          - hosts from file hosts.txt
+	$failed                             - hosts the last command has failed on
+
+After every exec, runscript or distribute the variables $ok, $failed and $timeout hold the hosts
+the last command has succeeded, failed or timed out on, $skipped holds the hosts left untouched
+by an aborted rolling execution. See "help retry".
 	
 You may combine any number of tokens keeping in mind that they are resolved left to right, so exclusions
 almost always should be on the righthand side. For example, "-host1,host1" will end up with host1 in list
@@ -278,6 +436,8 @@ despite being excluded previously.`,
 		"s_exec": execHelp,
 		"c_exec": execHelp,
 		"p_exec": execHelp,
+		"r_exec": execHelp,
+		"d_exec": execHelp,
 
 		"exit": {
 			usage: "",
@@ -306,7 +466,7 @@ aliases like so: alias ping local ping #*. This will create an alias "ping" so y
 		},
 
 		"mode": {
-			usage: "<serial/parallel/collapse>",
+			usage: "<serial/parallel/collapse/rolling/diff>",
 			help:  modeHelp,
 		},
 
@@ -323,6 +483,81 @@ aliases like so: alias ping local ping #*. This will create an alias "ping" so y
 			help:  modeHelp,
 		},
 
+		"diff": {
+			usage: "",
+			help:  modeHelp,
+		},
+
+		"rolling": {
+			usage: "",
+			help: `Switches execution mode to rolling.
+
+In rolling mode the hosts are split into batches of "batch_size" hosts. Every batch is run in parallel,
+the next batch is started once all the hosts of the previous one are finished and the "delay" is passed.
+If the number of failed hosts exceeds "max_failures" the execution is aborted, the hosts left are
+reported as skipped.
+
+Both batch_size and max_failures are either a number of hosts or a percentage of the whole host list,
+i.e. "batch_size 10%" and "max_failures 2". Use r_exec and r_runscript to run a single command in rolling
+mode without switching to it.`,
+		},
+
+		"batch_size": {
+			usage: "[<hosts>/<percent>%]",
+			help: `Sets the batch size for rolling mode, either a number of hosts or a percentage of them.
+When calling without arguments, shows the current value. See "help rolling".`,
+		},
+
+		"health_check": {
+			usage: "[off/remote <command>/local <command>/timeout <seconds>/interval <seconds>]",
+			help: `Sets a health check gate for serial and rolling modes. After the command is finished on a host
+(or on a batch of hosts in rolling mode) the check command is run on every host it has succeeded on
+and retried every "interval" seconds until it passes or the "timeout" is over. The next host or batch
+is only started when the check has passed on all of them, otherwise the execution is aborted, the hosts
+the check has failed on are reported with the "health" failure class and the hosts left as skipped.
+
+"health_check remote <command>" runs the check on hosts, "health_check local <command>" runs it on
+the local machine with XC_HOST environment variable set to the host being checked. "health_check off"
+switches the check off. When called without arguments, prints the current value.
+
+Example:
+    health_check remote curl -sf localhost/health
+    health_check local curl -sf http://$XC_HOST:8080/health`,
+		},
+
+		"live_collapse": {
+			usage: "[on/off]",
+			help: `Sets the live view of collapse mode on or off. When calling without arguments, shows the current value.
+
+While a command is running in collapse mode, the live view shows the number of running, finished and failed
+hosts, the current output groups with the number of hosts and the first line of output, and the hosts running
+for the longest time. The view is refreshed as the output arrives and replaces the progressbar. It's only drawn
+when the output is a terminal. The full grouped output is printed as usual when the execution is over.`,
+		},
+
+		"normalize": {
+			usage: "[trim <on/off>/mask <on/off>/replace <name> [<regex>]]",
+			help: `Sets how outputs are normalized before grouping hosts in collapse mode, so volatile parts
+like timestamps, PIDs or host names don't split hosts into separate groups. Hosts are grouped by the
+normalized output and the exit code, the largest groups are printed first.
+
+    trim <on/off>                 removes trailing whitespace and empty lines
+    mask <on/off>                 replaces the host name in its output with <host>
+    replace <name> <regex>        replaces the parts of output matching the regex with <name>
+    replace <name>                removes the replacement
+
+Replacements are applied in the order of their names. When called without arguments, shows the current settings.
+
+Example: normalize replace time \d\d:\d\d:\d\d`,
+		},
+
+		"max_failures": {
+			usage: "[<hosts>/<percent>%]",
+			help: `Sets the number of failed hosts tolerated in rolling mode, either a number of hosts
+or a percentage of them. The execution is aborted once it's exceeded, 0 means aborting on the first
+failed batch. When calling without arguments, shows the current value. See "help rolling".`,
+		},
+
 		"prepend_hostnames": {
 			usage: "<on/off>",
 			help: `Sets prepend hostnames mode on or off. When calling without arguments, shows the current value.
@@ -360,10 +595,136 @@ If the value is "none", no attempts to raise privileges will be made.`,
 			help:  `Reloads hosts and groups data from inventoree and rewrites the cache`,
 		},
 
+		"offline": {
+			usage: "[<on/off>]",
+			help: `Sets offline mode on or off. If no value is given, prints the current value.
+In offline mode the backend uses the local cache only and never contacts the remote API,
+even if the cache is expired. "reload" reloads data from the cache in this mode.
+To start xc in offline mode use "xc -offline" or set offline = true in [main] section.`,
+		},
+
+		"host_add": {
+			usage: "<fqdn> [group [datacenter]]",
+			help: `Adds a new host to the inventory. The backend must support modifications,
+at the moment only "ini" backend does. The changes are written to the inventory file
+immediately and the data is reloaded.`,
+		},
+
+		"host_remove": {
+			usage: "<host_expr>",
+			help: `Removes hosts matching the expression from the inventory. Asks for confirmation
+if exec_confirm is on. See "help host_add" for backends supporting modifications.`,
+		},
+
+		"host_move": {
+			usage: "<host_expr> <group>",
+			help: `Moves hosts matching the expression to the given group.
+See "help host_add" for backends supporting modifications.`,
+		},
+
+		"tag_add": {
+			usage: "<host_expr> <tag> [...tags]",
+			help: `Adds tags to hosts matching the expression. Group tags are not affected.
+See "help host_add" for backends supporting modifications.`,
+		},
+
+		"tag_remove": {
+			usage: "<host_expr> <tag> [...tags]",
+			help: `Removes tags from hosts matching the expression. Only host's own tags may be removed,
+tags inherited from groups remain. See "help host_add" for backends supporting modifications.`,
+		},
+
+		"export": {
+			usage: "<host_expr> <format> [filename]",
+			help: `Exports hosts matching the expression along with their inventory data to a file
+or to stdout if no filename is given. Supported formats are:
+
+    plain         one hostname per line
+    csv           hostname, group, workgroup, datacenter, tags, aliases, description
+                  and connection parameters
+    json          a list of objects with the same fields as csv
+    ansible       ini-style ansible inventory with hosts grouped by their groups,
+                  group hierarchy is kept in :children sections. Characters not allowed
+                  in ansible group names are replaced with "_", a numeric suffix is added
+                  if the name clashes with another group, i.e. web-1 becomes web_1_2
+                  when there's a web_1 group as well
+    ssh_config    ssh config entries with HostName, Port, User and ProxyJump
+
+Example: export %mygroup ansible ~/inventory.ini`,
+		},
+
+		"cache": {
+			usage: "[purge]",
+			help: `Shows the backend cache information: the cache file path, its age and ttl, current mode
+and the number of datacenters, workgroups, groups and hosts loaded.
+"cache purge" removes the cache file, the data already loaded stays in memory.`,
+		},
+
+		"reuse_connections": {
+			usage: "[<on/off>]",
+			help: `Sets connection reuse on or off. If no value is given, prints the current value.
+
+When on, every host gets one connection which is shared by copying the script and running it,
+and is kept open for the following commands until xc exits. With "ssh" transport this is done
+by ssh ControlMaster (ControlPersist is 30m unless set in [ssh] section), with "native"
+transport connections are cached in memory. Turning it off closes all the open connections.
+See "help connections" to list or drop them.`,
+		},
+
+		"connections": {
+			usage: "[drop [host_expression]]",
+			help: `Lists the connections kept open with reuse_connections on: the host, its address,
+transport and idle time. "connections drop" closes the connections to the given hosts,
+or all of them if no expression is given.`,
+		},
+
+		"separate_stderr": {
+			usage: "[<on/off>]",
+			help: `Sets stderr separation on or off. If no value is given, prints the current value.
+
+Commands are run in a terminal (ssh -tt) which merges stderr into stdout. When separate_stderr
+is on and raise is "none", no terminal is allocated so stdout and stderr of every host are
+captured separately (see "help last"). With su/sudo raise a terminal is still required to
+enter the password, so the streams are merged anyway.`,
+		},
+
+		"last": {
+			usage: "[summary/output/stdout/stderr] [ok/failed/<failure_class>/<host_expression>]",
+			help: `Shows the results of the last exec, runscript or distribute command.
+
+"last" or "last summary" lists every host with its exit code, start time, duration
+and status. "last output" re-displays the output of hosts, "last stdout" and "last stderr"
+show only the corresponding stream.
+
+Results may be filtered by "ok", "failed", a host expression or a failure class:
+    command       the command has exited with non-zero code
+    connection    the host couldn't be reached or ssh authentication has failed
+    copy          the script couldn't be copied to the host
+    auth          su/sudo authentication has failed
+    timeout       the command has timed out, see "help timeout"
+    health        the health check hasn't passed, see "help health_check"
+    stopped       the command has been stopped with ^C
+    local         a local error, i.e. ssh couldn't be started
+
+Example: last stderr failed`,
+		},
+
+		"retry": {
+			usage: "",
+			help: `Re-runs the last exec, runscript or distribute command on the hosts it has failed on,
+i.e. the same as running the command again with the "$failed" expression. The execution
+mode of the original command is kept.`,
+		},
+
+		"run":    scriptHelp,
+		"source": scriptHelp,
+
 		"runscript":   runScriptHelp,
 		"c_runscript": runScriptHelp,
 		"p_runscript": runScriptHelp,
 		"s_runscript": runScriptHelp,
+		"r_runscript": runScriptHelp,
+		"d_runscript": runScriptHelp,
 
 		"interpreter": {
 			usage: "[raise_type interpreter]",
@@ -384,6 +745,36 @@ the current output filename (or a message saying that the output logging is swit
 and exits.`,
 		},
 
+		"output_format": {
+			usage: "[<text/json>]",
+			help: `Sets the format of exec, runscript and distribute output. When called without arguments,
+prints the current value.
+
+"text" is the usual colored output. "json" prints a JSON object per line for scripts to parse:
+
+    {"type":"output","host":"host1","stream":"stdout","data":"a line of output"}
+    {"type":"finished","host":"host1","exit_code":0,"failure":"none","duration":0.523}
+    {"type":"health_check","host":"host1","passed":true}
+    {"type":"group","hosts":["host1","host2"],"exit_code":0,"output":"..."}
+    {"type":"summary","total":2,"success":["host1","host2"],"error":[],"timeout":[],"skipped":[],"force_stopped":0}
+
+An output event is printed for every line of output, a finished event when a host is done, a health_check
+event for every host checked in serial and rolling modes (in serial mode it precedes the finished event), group
+events follow in collapse and diff modes and the summary goes last. Progressbars and the live view are not drawn,
+colors are off and all the other messages are printed to stderr. Use "xc -o json exec <host_expr> <cmd>"
+to get json output of a single command.`,
+		},
+
+		"output_dir": {
+			usage: "[dirname]",
+			help: `Saves the output of every host to its own file after each exec, runscript and distribute.
+Every run gets a subdirectory named by its id, i.e. the start time like 20191023-153012, containing
+hosts/<host>.out with stdout, hosts/<host>.err with stderr (if any) and hosts/<host>.meta with the command,
+mode, exit code, failure class, start and end time of the host. run.meta describes the run itself listing succeeded,
+failed, timed out and skipped hosts. To switch it off, type "output_dir _". When invoked without arguments,
+output_dir prints the current directory.`,
+		},
+
 		"ssh": {
 			usage: "<host_expression>",
 			help: `Starts ssh session to hosts one by one, raising the privileges if raise type is not "none" 
@@ -397,6 +788,30 @@ xc moves on to the next server.`,
 without arguments, prints the current value.`,
 		},
 
+		"timeout": {
+			usage: "[seconds]",
+			help: `Sets the per-host timeout for exec, runscript and distribute in parallel, collapse and rolling modes.
+A host which doesn't finish in time is stopped and reported as timed out while other hosts
+keep running. 0 switches the timeout off. When called without arguments, prints the current value.`,
+		},
+
+		"transport": {
+			usage: "[<ssh/native>]",
+			help: `Sets the transport used by exec, runscript and distribute in parallel, collapse and rolling modes.
+When called without arguments, prints the current value.
+
+"ssh" runs an external ssh/scp process per host. "native" connects to hosts
+in-process which is much lighter on thousands of hosts. Native transport uses
+ssh-agent and unencrypted keys from IdentityFile (~/.ssh/id_* by default),
+checks host keys against UserKnownHostsFile (~/.ssh/known_hosts) according
+to StrictHostKeyChecking (no, accept-new or yes), and honours ConnectTimeout,
+ServerAliveInterval and ServerAliveCountMax options of the [ssh] config section.
+Hosts which couldn't be reached are counted as "connection failed" in the results
+separately from hosts where the command has failed.
+
+Serial mode and the ssh command always use external ssh as they are interactive.`,
+		},
+
 		"use_password_manager": {
 			usage: "[<on/off>]",
 			help: `Sets the password manager on/off. If no value is given, prints the current value.
@@ -436,28 +851,50 @@ func generalHelp() {
 	fmt.Println(`
 List of commands:
     alias                                  creates a local alias command
+    batch_size                             sets the batch size for rolling mode
+    cache                                  shows backend cache information or purges it
     cd                                     changes current working directory
     collapse                               shortcut for "mode collapse"
+    connections                            lists or drops connections kept open
     debug                                  one shouldn't use this
-    delay                                  sets a delay between hosts in serial mode
+    delay                                  sets a delay between hosts in serial and rolling modes
+    diff                                   shortcut for "mode diff"
     distribute                             copies a file to a number of hosts in parallel
     distribute_type                        sets the backend of the "distribute" command
-    exec/c_exec/s_exec/p_exec              executes a remote command on a number of hosts
+    exec/[c,s,p,r,d]_exec                  executes a remote command on a number of hosts
     exit                                   exits the xc
+    export                                 exports hosts data to various formats
+    health_check                           sets a health check gate for serial and rolling modes
     help                                   shows help on various topics
     hostlist                               resolves a host expression to a list of hosts
+    host_add/host_remove/host_move         modifies hosts in the inventory
     interpreter                            sets interpreter for each type of privileges raising
+    last                                   shows the results of the last command
+    live_collapse                          turns the live view of collapse mode on/off
     local                                  starts a local command
+    max_failures                           sets the number of failures tolerated in rolling mode
     mode                                   switches between execution modes
     natural_sort                           sets natural sorting on/off
+    normalize                              sets output normalization for collapse mode
+    offline                                sets backend offline mode on/off
+    output_dir                             saves the output of every host to its own file
+    output_format                          switches between text and json output
     parallel                               shortcut for "mode parallel"
     passwd                                 sets passwd for privilege raise
     progressbar                            controls progressbar
     raise                                  sets the privilege raise mode
     reload                                 reloads hosts and groups data from inventoree
+    retry                                  re-runs the last command on the failed hosts
+    reuse_connections                      keeps connections to hosts open between commands
+    rolling                                shortcut for "mode rolling"
+    run/source                             runs a script of xc commands
     runscript                              runs a local script on a number of remote hosts
+    separate_stderr                        keeps stderr apart from stdout
     serial                                 shortcut for "mode serial"
     ssh                                    starts ssh session to a number of hosts sequentally
+    tag_add/tag_remove                     modifies host tags in the inventory
+    timeout                                sets the per-host command timeout
+    transport                              sets the transport for parallel execution
     use_password_manager                   turns password manager on/off
     user                                   sets current user`)
 	fmt.Println()
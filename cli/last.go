@@ -0,0 +1,161 @@
+package cli
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/viert/xc/remote"
+	"github.com/viert/xc/stringslice"
+	"github.com/viert/xc/term"
+)
+
+var lastViews = []string{"summary", "output", "stdout", "stderr"}
+
+// lastCommand is the last command run on hosts, it's kept to be retried
+type lastCommand struct {
+	name string
+	mode execMode
+	// everything following the host expression
+	args string
+}
+
+// setLastResult keeps the result and exposes its hosts as
+// $ok, $failed, $timeout and $skipped expression variables
+func (c *Cli) setLastResult(r *remote.ExecResult) {
+	c.lastResult = r
+	c.store.SetVariable("ok", r.SuccessHosts)
+	c.store.SetVariable("failed", r.ErrorHosts)
+	c.store.SetVariable("timeout", r.TimeoutHosts)
+	c.store.SetVariable("skipped", r.SkippedHosts)
+}
+
+// filterLast returns the sorted hosts of the last result matching the filter
+// which is either ok, failed, a failure class or a host expression
+func (c *Cli) filterLast(filter string) ([]*remote.HostResult, error) {
+	var match func(*remote.HostResult) bool
+
+	if fc, found := remote.ParseFailureClass(filter); found && filter != "none" {
+		match = func(hr *remote.HostResult) bool { return hr.Failure == fc }
+	} else {
+		switch filter {
+		case "", "all":
+			match = func(hr *remote.HostResult) bool { return true }
+		case "ok":
+			match = func(hr *remote.HostResult) bool { return hr.ExitCode == 0 }
+		case "failed":
+			match = func(hr *remote.HostResult) bool { return hr.ExitCode != 0 }
+		default:
+			hosts, err := c.store.HostList([]rune(filter))
+			if err != nil {
+				return nil, fmt.Errorf("error parsing expression %s: %s", filter, err)
+			}
+			match = func(hr *remote.HostResult) bool { return stringslice.Contains(hosts, hr.Host) }
+		}
+	}
+
+	results := make([]*remote.HostResult, 0)
+	for _, hr := range c.lastResult.Hosts {
+		if match(hr) {
+			results = append(results, hr)
+		}
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Host < results[j].Host })
+	return results, nil
+}
+
+func printLastSummary(results []*remote.HostResult) {
+	for _, hr := range results {
+		status := term.Green("ok")
+		if hr.ExitCode != 0 {
+			status = term.Red(hr.Failure.String())
+		}
+		started := "-"
+		if !hr.Start.IsZero() {
+			started = hr.Start.Format("15:04:05")
+		}
+		code := fmt.Sprintf("%d", hr.ExitCode)
+		if hr.ExitCode >= remote.ErrMacOsExit {
+			// internal codes make no sense to the user
+			code = "-"
+		}
+		// the colored status goes last as escape sequences break the alignment
+		fmt.Printf("%-40s %-5s %s %10s  %s\n", hr.Host, code, started, hr.Duration().Round(time.Millisecond), status)
+	}
+}
+
+func printLastOutput(results []*remote.HostResult, view string) {
+	for _, hr := range results {
+		var data string
+		switch view {
+		case "stdout":
+			data = hr.Stdout
+		case "stderr":
+			data = hr.Stderr
+		default:
+			data = hr.Output()
+		}
+		if data == "" {
+			continue
+		}
+		for _, line := range strings.Split(strings.TrimRight(data, "\r\n"), "\n") {
+			fmt.Printf("%s: %s\n", term.Blue(hr.Host), strings.TrimRight(line, "\r"))
+		}
+	}
+}
+
+func (c *Cli) doLast(name string, argsLine string, args ...string) {
+	if c.lastResult == nil {
+		term.Errorf("Nothing has been executed yet\n")
+		return
+	}
+
+	view := "summary"
+	if len(args) > 0 && stringslice.Contains(lastViews, args[0]) {
+		view = args[0]
+		args = args[1:]
+	}
+	if len(args) > 1 {
+		term.Errorf("Usage: last [%s] [ok/failed/<failure_class>/<host_expr>]\n", strings.Join(lastViews, "/"))
+		return
+	}
+
+	filter := ""
+	if len(args) > 0 {
+		filter = args[0]
+	}
+	results, err := c.filterLast(filter)
+	if err != nil {
+		term.Errorf("%s\n", err)
+		return
+	}
+
+	if view == "summary" {
+		printLastSummary(results)
+		c.lastResult.Print()
+		return
+	}
+	printLastOutput(results, view)
+}
+
+func (c *Cli) doRetry(name string, argsLine string, args ...string) {
+	if c.lastCommand == nil || c.lastResult == nil {
+		term.Errorf("Nothing has been executed yet\n")
+		return
+	}
+	if len(c.lastResult.ErrorHosts) == 0 {
+		term.Successf("No failed hosts to retry\n")
+		return
+	}
+
+	line := "$failed " + c.lastCommand.args
+	switch c.lastCommand.name {
+	case "exec":
+		c.doexec(c.lastCommand.mode, line)
+	case "runscript":
+		c.dorunscript(c.lastCommand.mode, line)
+	case "distribute":
+		c.doDistribute("distribute", line)
+	}
+}
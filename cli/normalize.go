@@ -0,0 +1,89 @@
+package cli
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/viert/xc/remote"
+	"github.com/viert/xc/term"
+)
+
+// applyCollapseOptions passes normalization settings to the executer,
+// replacements are applied in the order of their names
+func (c *Cli) applyCollapseOptions() {
+	names := make([]string, 0, len(c.collapseReplace))
+	for name := range c.collapseReplace {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	rules := make([]*remote.CollapseRule, 0, len(names))
+	for _, name := range names {
+		expr, err := regexp.Compile(c.collapseReplace[name])
+		if err != nil {
+			term.Errorf("Invalid collapse replacement %s: %s\n", name, err)
+			continue
+		}
+		rules = append(rules, &remote.CollapseRule{Name: name, Pattern: expr, Replacement: "<" + name + ">"})
+	}
+
+	remote.SetCollapseOptions(remote.CollapseOptions{
+		Rules:          rules,
+		MaskHostnames:  c.collapseMask,
+		TrimWhitespace: c.collapseTrim,
+	})
+}
+
+func (c *Cli) printCollapseOptions() {
+	onOff := map[bool]string{true: "on", false: "off"}
+	fmt.Printf("trim %s\n", onOff[c.collapseTrim])
+	fmt.Printf("mask %s\n", onOff[c.collapseMask])
+
+	names := make([]string, 0, len(c.collapseReplace))
+	for name := range c.collapseReplace {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("replace %s %s\n", name, c.collapseReplace[name])
+	}
+}
+
+func (c *Cli) doNormalize(name string, argsLine string, args ...string) {
+	if len(args) < 1 {
+		c.printCollapseOptions()
+		return
+	}
+
+	switch args[0] {
+	case "trim":
+		if doOnOff("trim", &c.collapseTrim, args[1:]) {
+			c.applyCollapseOptions()
+		}
+	case "mask":
+		if doOnOff("mask", &c.collapseMask, args[1:]) {
+			c.applyCollapseOptions()
+		}
+	case "replace":
+		if len(args) < 2 {
+			term.Errorf("Usage: normalize replace <name> [<regex>]\n")
+			return
+		}
+		_, rest := split([]rune(argsLine))
+		replName, pattern := split(rest)
+		if len(pattern) == 0 {
+			delete(c.collapseReplace, string(replName))
+			c.applyCollapseOptions()
+			return
+		}
+		if _, err := regexp.Compile(string(pattern)); err != nil {
+			term.Errorf("Invalid regex: %s\n", err)
+			return
+		}
+		c.collapseReplace[string(replName)] = string(pattern)
+		c.applyCollapseOptions()
+	default:
+		term.Errorf("Usage: normalize [trim <on/off>/mask <on/off>/replace <name> [<regex>]]\n")
+	}
+}
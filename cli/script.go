@@ -0,0 +1,328 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/viert/xc/config"
+	"github.com/viert/xc/term"
+)
+
+const (
+	maxScriptDepth = 10
+)
+
+var (
+	scriptVarName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	scriptVarRef  = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+	scriptConditions = []string{"ok", "failed", "timeout", "skipped"}
+)
+
+type scriptNodeType int
+
+const (
+	sntCommand scriptNodeType = iota
+	sntIf
+	sntFor
+	sntLet
+	sntStopOnError
+	sntExit
+)
+
+// scriptNode is a statement of a script, "if" and "for" statements
+// have bodies, "if" may have an "else" branch as well
+type scriptNode struct {
+	typ     scriptNodeType
+	lineNum int
+	// the command line, the condition, the host expression or the value
+	args   string
+	name   string
+	body   []*scriptNode
+	orElse []*scriptNode
+}
+
+// scriptState is the state of a running script
+type scriptState struct {
+	filename    string
+	vars        map[string]string
+	stopOnError bool
+	stopped     bool
+	status      int
+}
+
+// parseCondition returns the condition name and whether it's negated
+func parseCondition(cond string) (string, bool, error) {
+	tokens := whitespace.Split(strings.TrimSpace(cond), -1)
+	negate := false
+	if tokens[0] == "not" {
+		negate = true
+		tokens = tokens[1:]
+	}
+	if len(tokens) != 1 {
+		return "", false, fmt.Errorf("invalid condition \"%s\"", cond)
+	}
+	for _, name := range scriptConditions {
+		if tokens[0] == name {
+			return name, negate, nil
+		}
+	}
+	return "", false, fmt.Errorf("unknown condition \"%s\", use one of %s", tokens[0], strings.Join(scriptConditions, ", "))
+}
+
+// parseScript parses the whole script so syntax errors are
+// reported before anything is run
+func parseScript(filename string, rd io.Reader) ([]*scriptNode, error) {
+	type frame struct {
+		node   *scriptNode
+		inElse bool
+	}
+
+	root := &scriptNode{}
+	stack := []*frame{{node: root}}
+	sc := bufio.NewScanner(rd)
+	lineNum := 0
+
+	for sc.Scan() {
+		lineNum++
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		syntaxError := func(format string, args ...interface{}) error {
+			return fmt.Errorf("%s:%d: %s", filename, lineNum, fmt.Sprintf(format, args...))
+		}
+
+		keyword, rest := split([]rune(line))
+		args := strings.TrimSpace(string(rest))
+		top := stack[len(stack)-1]
+		node := &scriptNode{lineNum: lineNum, args: args}
+
+		switch string(keyword) {
+		case "if":
+			if _, _, err := parseCondition(args); args == "" || err != nil {
+				return nil, syntaxError("usage: if [not] <ok/failed/timeout/skipped>")
+			}
+			node.typ = sntIf
+		case "else":
+			if top.node.typ != sntIf || top.inElse {
+				return nil, syntaxError("else without if")
+			}
+			top.inElse = true
+			continue
+		case "end":
+			if len(stack) == 1 {
+				return nil, syntaxError("end without if or for")
+			}
+			stack = stack[:len(stack)-1]
+			continue
+		case "for":
+			tokens := whitespace.Split(args, 3)
+			if len(tokens) < 3 || tokens[1] != "in" || !scriptVarName.MatchString(tokens[0]) {
+				return nil, syntaxError("usage: for <name> in <host_expression>")
+			}
+			node.typ = sntFor
+			node.name = tokens[0]
+			node.args = tokens[2]
+		case "let":
+			idx := strings.Index(args, "=")
+			if idx < 0 || !scriptVarName.MatchString(strings.TrimSpace(args[:idx])) {
+				return nil, syntaxError("usage: let <name> = <value>")
+			}
+			node.typ = sntLet
+			node.name = strings.TrimSpace(args[:idx])
+			node.args = strings.TrimSpace(args[idx+1:])
+		case "stop_on_error":
+			if args != "on" && args != "off" {
+				return nil, syntaxError("usage: stop_on_error <on/off>")
+			}
+			node.typ = sntStopOnError
+		case "exit":
+			if _, err := strconv.Atoi(args); args != "" && err != nil {
+				return nil, syntaxError("usage: exit [<code>]")
+			}
+			node.typ = sntExit
+		default:
+			node.typ = sntCommand
+			node.args = line
+		}
+
+		if top.inElse {
+			top.node.orElse = append(top.node.orElse, node)
+		} else {
+			top.node.body = append(top.node.body, node)
+		}
+		if node.typ == sntIf || node.typ == sntFor {
+			stack = append(stack, &frame{node: node})
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(stack) > 1 {
+		open := stack[len(stack)-1].node
+		return nil, fmt.Errorf("%s:%d: statement is not closed with end", filename, open.lineNum)
+	}
+	return root.body, nil
+}
+
+// interpolate substitutes ${name} references with variable values, references
+// to undefined variables are left as is as they may be meant for the shell
+func (st *scriptState) interpolate(line string) string {
+	return scriptVarRef.ReplaceAllStringFunc(line, func(ref string) string {
+		name := scriptVarRef.FindStringSubmatch(ref)[1]
+		if value, found := st.vars[name]; found {
+			return value
+		}
+		return ref
+	})
+}
+
+// stop stops the script with the status given
+func (st *scriptState) stop(node *scriptNode, status int, format string, args ...interface{}) {
+	if format != "" {
+		term.Errorf("%s:%d: %s\n", st.filename, node.lineNum, fmt.Sprintf(format, args...))
+	}
+	st.stopped = true
+	st.status = status
+}
+
+// checkCondition checks the condition against the last execution result
+func (c *Cli) checkCondition(cond string) bool {
+	name, negate, _ := parseCondition(cond)
+	res := false
+	if r := c.lastResult; r != nil {
+		switch name {
+		case "ok":
+			res = len(r.ErrorHosts) == 0 && len(r.SkippedHosts) == 0 && r.ForceStoppedHosts == 0
+		case "failed":
+			res = len(r.ErrorHosts) > 0
+		case "timeout":
+			res = len(r.TimeoutHosts) > 0
+		case "skipped":
+			res = len(r.SkippedHosts) > 0
+		}
+	}
+	return res != negate
+}
+
+func (c *Cli) execScriptNodes(st *scriptState, nodes []*scriptNode) {
+	for _, node := range nodes {
+		if st.stopped || c.stopped {
+			return
+		}
+
+		args := st.interpolate(node.args)
+
+		switch node.typ {
+		case sntCommand:
+			term.Successf("%s\n", args)
+			status := c.Run(args)
+			if status != 0 && st.stopOnError {
+				st.stop(node, status, "command has failed, script stopped")
+			}
+		case sntIf:
+			if c.checkCondition(args) {
+				c.execScriptNodes(st, node.body)
+			} else {
+				c.execScriptNodes(st, node.orElse)
+			}
+		case sntFor:
+			hosts, err := c.store.HostList([]rune(args))
+			if err != nil {
+				st.stop(node, 2, "error parsing expression %s: %s", args, err)
+				return
+			}
+			for _, host := range hosts {
+				st.vars[node.name] = host
+				c.execScriptNodes(st, node.body)
+				if st.stopped {
+					return
+				}
+			}
+		case sntLet:
+			st.vars[node.name] = args
+		case sntStopOnError:
+			st.stopOnError = args == "on"
+		case sntExit:
+			status := 0
+			if args != "" {
+				status, _ = strconv.Atoi(args)
+			}
+			st.stop(node, status, "")
+		}
+	}
+}
+
+// runScript parses and runs a script file with the variables given.
+// Returns the exit status of the script
+func (c *Cli) runScript(filename string, vars map[string]string) int {
+	if c.scriptDepth >= maxScriptDepth {
+		term.Errorf("Maximum script nesting reached running %s\n", filename)
+		return 2
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		term.Errorf("Error opening script: %s\n", err)
+		return 2
+	}
+	nodes, err := parseScript(filename, f)
+	f.Close()
+	if err != nil {
+		term.Errorf("Error parsing script: %s\n", err)
+		return 2
+	}
+
+	c.scriptDepth++
+	defer func() { c.scriptDepth-- }()
+
+	st := &scriptState{filename: filename, vars: vars}
+	c.execScriptNodes(st, nodes)
+	return st.status
+}
+
+// scriptArgs parses the script filename followed by name=value variables
+func scriptArgs(args []string, vars map[string]string) (string, error) {
+	for _, arg := range args[1:] {
+		idx := strings.Index(arg, "=")
+		if idx < 0 || !scriptVarName.MatchString(arg[:idx]) {
+			return "", fmt.Errorf("invalid variable \"%s\", use <name>=<value>", arg)
+		}
+		vars[arg[:idx]] = arg[idx+1:]
+	}
+	return config.ExpandPath(args[0]), nil
+}
+
+func (c *Cli) doRun(name string, argsLine string, args ...string) {
+	c.doScript(name, make(map[string]string), args)
+}
+
+func (c *Cli) doSource(name string, argsLine string, args ...string) {
+	c.doScript(name, c.scriptVars, args)
+}
+
+// doScript runs a script keeping its status as the status of the command,
+// "run" starts with a fresh set of variables while "source" shares them with
+// the session and other sourced scripts
+func (c *Cli) doScript(name string, vars map[string]string, args []string) {
+	if len(args) < 1 || args[0] == "" {
+		term.Errorf("Usage: %s <filename> [<name>=<value> ...]\n", name)
+		c.cmdStatus = 2
+		return
+	}
+	filename, err := scriptArgs(args, vars)
+	if err != nil {
+		term.Errorf("%s\n", err)
+		c.cmdStatus = 2
+		return
+	}
+	c.cmdStatus = c.runScript(filename, vars)
+}
@@ -0,0 +1,241 @@
+package cli
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/viert/xc/remote"
+)
+
+func TestParseScript(t *testing.T) {
+	script := `# comment
+let greeting = hello world
+stop_on_error on
+for h in %group
+    if not ok
+        echo ${h} failed
+    else
+        echo ${h} ok
+    end
+end
+exit 3
+`
+	nodes, err := parseScript("test.xc", strings.NewReader(script))
+	if err != nil {
+		t.Fatalf("parseScript: %s", err)
+	}
+	if len(nodes) != 4 {
+		t.Fatalf("%d top level nodes parsed, expected 4", len(nodes))
+	}
+
+	let := nodes[0]
+	if let.typ != sntLet || let.name != "greeting" || let.args != "hello world" || let.lineNum != 2 {
+		t.Errorf("unexpected let node %+v", let)
+	}
+	if nodes[1].typ != sntStopOnError || nodes[1].args != "on" {
+		t.Errorf("unexpected stop_on_error node %+v", nodes[1])
+	}
+
+	loop := nodes[2]
+	if loop.typ != sntFor || loop.name != "h" || loop.args != "%group" || len(loop.body) != 1 {
+		t.Fatalf("unexpected for node %+v", loop)
+	}
+	cond := loop.body[0]
+	if cond.typ != sntIf || cond.args != "not ok" || len(cond.body) != 1 || len(cond.orElse) != 1 {
+		t.Fatalf("unexpected if node %+v", cond)
+	}
+	if cond.body[0].typ != sntCommand || cond.body[0].args != "echo ${h} failed" {
+		t.Errorf("unexpected if body %+v", cond.body[0])
+	}
+	if cond.orElse[0].typ != sntCommand || cond.orElse[0].args != "echo ${h} ok" {
+		t.Errorf("unexpected else body %+v", cond.orElse[0])
+	}
+
+	if nodes[3].typ != sntExit || nodes[3].args != "3" {
+		t.Errorf("unexpected exit node %+v", nodes[3])
+	}
+}
+
+func TestParseScriptErrors(t *testing.T) {
+	tests := []struct {
+		script string
+		err    string
+	}{
+		{"else\n", "test.xc:1: else without if"},
+		{"for h in %g\nelse\nend\n", "test.xc:2: else without if"},
+		{"if ok\nelse\nelse\nend\n", "test.xc:3: else without if"},
+		{"end\n", "test.xc:1: end without if or for"},
+		{"if ok\nend\nend\n", "test.xc:3: end without if or for"},
+		{"if ok\n  for h in %g\n  end\n", "test.xc:1: statement is not closed with end"},
+		{"for h in %g\n  if ok\n", "test.xc:2: statement is not closed with end"},
+		{"if\nend\n", "test.xc:1: usage: if [not] <ok/failed/timeout/skipped>"},
+		{"if good\nend\n", "test.xc:1: usage: if [not] <ok/failed/timeout/skipped>"},
+		{"if not not ok\nend\n", "test.xc:1: usage: if [not] <ok/failed/timeout/skipped>"},
+		{"for h %g\nend\n", "test.xc:1: usage: for <name> in <host_expression>"},
+		{"for h in\nend\n", "test.xc:1: usage: for <name> in <host_expression>"},
+		{"for 1h in %g\nend\n", "test.xc:1: usage: for <name> in <host_expression>"},
+		{"let x\n", "test.xc:1: usage: let <name> = <value>"},
+		{"let x-y = 1\n", "test.xc:1: usage: let <name> = <value>"},
+		{"stop_on_error yes\n", "test.xc:1: usage: stop_on_error <on/off>"},
+		{"exit now\n", "test.xc:1: usage: exit [<code>]"},
+	}
+	for _, tt := range tests {
+		_, err := parseScript("test.xc", strings.NewReader(tt.script))
+		if err == nil {
+			t.Errorf("no error parsing %q, expected %q", tt.script, tt.err)
+			continue
+		}
+		if err.Error() != tt.err {
+			t.Errorf("error parsing %q is %q, expected %q", tt.script, err, tt.err)
+		}
+	}
+}
+
+func TestParseScriptSyntax(t *testing.T) {
+	nodes, err := parseScript("test.xc", strings.NewReader("let  x=a = b \nlet y =\nfor  h  in  %g  #web\nend\nexit\n"))
+	if err != nil {
+		t.Fatalf("parseScript: %s", err)
+	}
+	if nodes[0].name != "x" || nodes[0].args != "a = b" {
+		t.Errorf("let x is parsed as %q = %q", nodes[0].name, nodes[0].args)
+	}
+	if nodes[1].name != "y" || nodes[1].args != "" {
+		t.Errorf("let y is parsed as %q = %q", nodes[1].name, nodes[1].args)
+	}
+	if nodes[2].name != "h" || nodes[2].args != "%g  #web" {
+		t.Errorf("for is parsed as %q in %q", nodes[2].name, nodes[2].args)
+	}
+	if nodes[3].typ != sntExit || nodes[3].args != "" {
+		t.Errorf("unexpected exit node %+v", nodes[3])
+	}
+}
+
+func TestInterpolate(t *testing.T) {
+	st := &scriptState{vars: map[string]string{"host": "web1", "n": "2", "empty": ""}}
+	tests := []struct {
+		line     string
+		expected string
+	}{
+		{"exec ${host} uptime", "exec web1 uptime"},
+		{"${host}${n}", "web12"},
+		{"echo [${empty}]", "echo []"},
+		{"echo ${undefined} $host ${n", "echo ${undefined} $host ${n"},
+		{"echo ${1x}", "echo ${1x}"},
+		{"no refs", "no refs"},
+	}
+	for _, tt := range tests {
+		if res := st.interpolate(tt.line); res != tt.expected {
+			t.Errorf("interpolate(%q) = %q, expected %q", tt.line, res, tt.expected)
+		}
+	}
+}
+
+func TestCheckCondition(t *testing.T) {
+	results := map[string]*remote.ExecResult{
+		"none":    nil,
+		"ok":      {SuccessHosts: []string{"h1"}},
+		"failed":  {ErrorHosts: []string{"h1"}},
+		"timeout": {ErrorHosts: []string{"h1"}, TimeoutHosts: []string{"h1"}},
+		"skipped": {SuccessHosts: []string{"h1"}, SkippedHosts: []string{"h2"}},
+		"stopped": {SuccessHosts: []string{"h1"}, ForceStoppedHosts: 1},
+	}
+	tests := []struct {
+		result string
+		cond   string
+		res    bool
+	}{
+		{"none", "ok", false},
+		{"none", "failed", false},
+		{"none", "not ok", true},
+		{"ok", "ok", true},
+		{"ok", "failed", false},
+		{"ok", "not failed", true},
+		{"failed", "ok", false},
+		{"failed", "failed", true},
+		{"failed", "timeout", false},
+		{"timeout", "failed", true},
+		{"timeout", "timeout", true},
+		{"skipped", "ok", false},
+		{"skipped", "skipped", true},
+		{"skipped", "failed", false},
+		{"stopped", "ok", false},
+		{"stopped", "not ok", true},
+	}
+	for _, tt := range tests {
+		c := &Cli{lastResult: results[tt.result]}
+		if res := c.checkCondition(tt.cond); res != tt.res {
+			t.Errorf("checkCondition(%q) on %s result = %v, expected %v", tt.cond, tt.result, res, tt.res)
+		}
+	}
+}
+
+// newScriptCli makes a cli with "echo" recording its arguments
+// and "fail" leaving a failed result
+func newScriptCli(calls *[]string) *Cli {
+	c := &Cli{scriptVars: make(map[string]string)}
+	c.handlers = map[string]cmdHandler{
+		"echo": func(name string, argsLine string, args ...string) {
+			*calls = append(*calls, argsLine)
+		},
+		"fail": func(name string, argsLine string, args ...string) {
+			*calls = append(*calls, "fail")
+			c.lastResult = &remote.ExecResult{ErrorHosts: []string{"h1"}}
+		},
+	}
+	return c
+}
+
+func writeScript(t *testing.T, script string) string {
+	filename := filepath.Join(t.TempDir(), "script.xc")
+	if err := ioutil.WriteFile(filename, []byte(script), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func TestRunScript(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		vars   map[string]string
+		calls  []string
+		status int
+	}{
+		{"variables", "let x = 1\necho ${x} ${y}\n", map[string]string{"y": "2"}, []string{"1 2"}, 0},
+		{"else branch", "fail\nif ok\necho yes\nelse\necho no\nend\necho done\n", nil, []string{"fail", "no", "done"}, 0},
+		{"stop on error", "stop_on_error on\nfail\necho unreachable\n", nil, []string{"fail"}, 1},
+		{"stop on error off", "stop_on_error off\nfail\necho reached\n", nil, []string{"fail", "reached"}, 0},
+		{"exit", "echo a\nexit 4\necho b\n", nil, []string{"a"}, 4},
+		{"syntax error", "echo a\nif ok\n", nil, []string{}, 2},
+	}
+	for _, tt := range tests {
+		calls := make([]string, 0)
+		c := newScriptCli(&calls)
+		vars := tt.vars
+		if vars == nil {
+			vars = make(map[string]string)
+		}
+		status := c.runScript(writeScript(t, tt.script), vars)
+		if status != tt.status {
+			t.Errorf("%s: status is %d, expected %d", tt.name, status, tt.status)
+		}
+		if !reflect.DeepEqual(calls, tt.calls) {
+			t.Errorf("%s: commands run are %q, expected %q", tt.name, calls, tt.calls)
+		}
+	}
+}
+
+func TestRunRCLineByLine(t *testing.T) {
+	calls := make([]string, 0)
+	c := newScriptCli(&calls)
+	// script statements aren't recognized in rcfiles so an unclosed
+	// "if" doesn't prevent other lines from running
+	c.runRC(writeScript(t, "echo a\nif ok\necho ${x}\n"))
+	expected := []string{"a", "${x}"}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("commands run are %q, expected %q", calls, expected)
+	}
+}
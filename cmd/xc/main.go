@@ -1,14 +1,20 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"net/http"
 	"os"
 	"path"
 	"strings"
 
-	"github.com/viert/xc/backend/conductor"
-	"github.com/viert/xc/backend/inventoree"
-	"github.com/viert/xc/backend/localini"
+	"github.com/viert/xc/backend"
+	_ "github.com/viert/xc/backend/conductor"
+	_ "github.com/viert/xc/backend/consul"
+	_ "github.com/viert/xc/backend/ec2"
+	_ "github.com/viert/xc/backend/external"
+	_ "github.com/viert/xc/backend/inventoree"
+	_ "github.com/viert/xc/backend/localini"
 
 	_ "net/http/pprof"
 
@@ -17,6 +23,19 @@ import (
 	"github.com/viert/xc/term"
 )
 
+func usage() {
+	fmt.Fprintf(os.Stderr, `Usage: %s [options] [command [args...]]
+
+Starts the interactive shell if no command is given, otherwise runs
+the command and exits, i.e. "xc -m collapse -t 100 exec %%group uptime".
+The exit code is 1 if the command has failed on any host and 2 if it
+hasn't been run at all.
+
+Options:
+`, os.Args[0])
+	flag.PrintDefaults()
+}
+
 func main() {
 
 	go http.ListenAndServe(":5001", nil)
@@ -24,61 +43,65 @@ func main() {
 	var tool *cli.Cli
 	var err error
 
-	cfgFilename := path.Join(os.Getenv("HOME"), ".xc.conf")
-	xccfg, err := config.Read(cfgFilename)
+	cfgFilename := flag.String("c", path.Join(os.Getenv("HOME"), ".xc.conf"), "config file")
+	backendType := flag.String("b", "", "backend type, overrides the config one")
+	mode := flag.String("m", "", "execution mode: serial, parallel, collapse, rolling or diff")
+	threads := flag.Int("t", 0, "max number of ssh threads")
+	raise := flag.String("r", "", "privilege raise type: none, su or sudo")
+	format := flag.String("o", "", "output format: text or json")
+	offline := flag.Bool("offline", false, "use backend cache only, never contacting the API")
+	flag.Usage = usage
+	flag.Parse()
+
+	// the backend type is overridden before the config is validated
+	// so it may be missing in the config file
+	xccfg, err := config.ReadWithBackendType(config.ExpandPath(*cfgFilename), *backendType)
 	if err != nil {
 		term.Errorf("Error reading config: %s\n", err)
-		return
+		os.Exit(2)
+	}
+	if *offline {
+		xccfg.Offline = true
+	}
+	if *mode != "" {
+		xccfg.Mode = *mode
+	}
+	if *threads > 0 {
+		xccfg.SSHThreads = *threads
+	}
+	if *raise != "" {
+		xccfg.RaiseType = *raise
+	}
+	if *format != "" {
+		xccfg.OutputFormat = *format
 	}
 
-	switch xccfg.BackendCfg.Type {
-	case config.BTInventoree:
-		be, err := inventoree.New(xccfg)
-		if err != nil {
-			term.Errorf("Error creating inventoree backend: %s\n", err)
-			return
-		}
-
-		tool, err = cli.New(xccfg, be)
-		if err != nil {
-			term.Errorf("%s\n", err)
-			return
-		}
-	case config.BTIni:
-		be, err := localini.New(xccfg)
-		if err != nil {
-			term.Errorf("Error creating local ini backend: %s\n", err)
-			return
-		}
-
-		tool, err = cli.New(xccfg, be)
-		if err != nil {
-			term.Errorf("%s\n", err)
-			return
-		}
-
-	case config.BTConductor:
-		be, err := conductor.New(xccfg)
-		if err != nil {
-			term.Errorf("Error creating conductor backend: %s\n", err)
-			return
-		}
-
-		tool, err = cli.New(xccfg, be)
-		if err != nil {
-			term.Errorf("%s\n", err)
-			return
-		}
-	default:
-		term.Errorf("Backend type %s is not implemented yet\n", xccfg.BackendCfg.TypeString)
-		return
+	interactive := flag.NArg() == 0
+	if !interactive {
+		// nobody is there to answer
+		xccfg.ExecConfirm = false
+		xccfg.ExitConfirm = false
+	}
+
+	be, err := backend.New(xccfg)
+	if err != nil {
+		term.Errorf("Error creating %s backend: %s\n", xccfg.BackendCfg.Type, err)
+		os.Exit(2)
 	}
 
-	defer tool.Finalize()
-	if len(os.Args) < 2 {
+	tool, err = cli.New(xccfg, be)
+	if err != nil {
+		term.Errorf("%s\n", err)
+		os.Exit(2)
+	}
+
+	if interactive {
 		tool.CmdLoop()
-	} else {
-		cmd := strings.Join(os.Args[1:], " ")
-		tool.OneCmd(cmd)
+		tool.Finalize()
+		return
 	}
+
+	code := tool.Run(strings.Join(flag.Args(), " "))
+	tool.Finalize()
+	os.Exit(code)
 }
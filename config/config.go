@@ -14,11 +14,13 @@ import (
 const defaultConfigContents = `[main]
 user = 
 mode = parallel
+output_format = text
 history_file = ~/.xc_history
 cache_dir = ~/.xc_cache
 cache_ttl = 336 # 24 * 7 * 2
 rc_file = ~/.xcrc
 log_file = 
+output_dir = 
 raise = none
 exit_confirm = true
 exec_confirm = true
@@ -30,16 +32,31 @@ show_ssh_threads_max = 50
 [executer]
 ssh_threads = 50
 ssh_connect_timeout = 1
+command_timeout = 0
 ssh_command = /usr/bin/ssh
+transport = ssh
+reuse_connections = false
 progress_bar = true
 prepend_hostnames = true
+separate_stderr = false
 remote_tmpdir = /tmp
 delay = 0
+batch_size = 10%
+max_failures = 0
+health_check = 
+health_check_local = false
+health_check_timeout = 60
+health_check_interval = 5
 
 interpreter = bash
 interpreter_sudo = sudo bash
 interpreter_su = su -
 
+[collapse]
+trim_whitespace = true
+mask_hostnames = false
+live = false
+
 [ssh]
 PasswordAuthentication = no
 PubkeyAuthentication = yes
@@ -57,21 +74,10 @@ work_groups =
 path =
 `
 
-// BackendType is a backend type enum
-type BackendType int
-
-// Backend types
-const (
-	BTIni BackendType = iota
-	BTConductor
-	BTInventoree
-)
-
 // BackendConfig is a backend configuration struct
 type BackendConfig struct {
-	Type       BackendType
-	TypeString string
-	Options    map[string]string
+	Type    string
+	Options map[string]string
 }
 
 // XCConfig represents a configuration struct for XC
@@ -81,19 +87,34 @@ type XCConfig struct {
 	User                   string
 	SSHThreads             int
 	SSHConnectTimeout      int
+	CommandTimeout         int
 	SSHCommand             string
 	SSHOptions             map[string]string
 	RemoteTmpdir           string
 	Mode                   string
+	OutputFormat           string
 	RaiseType              string
 	Delay                  int
+	BatchSize              string
+	MaxFailures            string
+	HealthCheck            string
+	HealthCheckLocal       bool
+	HealthCheckTimeout     int
+	HealthCheckInterval    int
+	CollapseTrimWhitespace bool
+	CollapseMaskHostnames  bool
+	CollapseLive           bool
+	CollapseReplace        map[string]string
 	RCfile                 string
 	CacheDir               string
 	CacheTTL               time.Duration
+	Offline                bool
 	Debug                  bool
 	ProgressBar            bool
 	PrependHostnames       bool
+	SeparateStderr         bool
 	LogFile                string
+	OutputDir              string
 	ExitConfirm            bool
 	ExecConfirm            bool
 	ShowSsh                bool
@@ -107,6 +128,8 @@ type XCConfig struct {
 	LocalEnvironment       map[string]string
 	RemoteEnvironment      map[string]string
 	Distribute             string
+	Transport              string
+	ReuseConnections       bool
 }
 
 const (
@@ -114,17 +137,24 @@ const (
 	defaultCacheDir          = "~/.xc_cache"
 	defaultRCfile            = "~/.xcrc"
 	defaultCacheTTL          = 24
+	defaultOffline           = false
 	defaultThreads           = 50
 	defaultRemoteTmpDir      = "/tmp"
 	defaultDelay             = 0
+	defaultBatchSize         = "10%"
+	defaultMaxFailures       = "0"
 	defaultMode              = "parallel"
+	defaultOutputFormat      = "text"
 	defaultRaiseType         = "none"
 	defaultDebug             = false
 	defaultProgressbar       = true
 	defaultPrependHostnames  = true
+	defaultSeparateStderr    = false
 	defaultSSHConnectTimeout = 1
+	defaultCommandTimeout    = 0
 	defaultSSHCommand        = "/usr/bin/ssh"
 	defaultLogFile           = ""
+	defaultOutputDir         = ""
 	defaultExitConfirm       = true
 	defaultExecConfirm       = true
 	defaultShowSshThreads    = true
@@ -134,6 +164,21 @@ const (
 	defaultSudoInterpreter   = "sudo /bin/bash"
 	defaultSuInterpreter     = "su -"
 	defaultDistribute        = "tar"
+	defaultTransport         = "ssh"
+	defaultReuseConnections  = false
+)
+
+const (
+	defaultHealthCheck         = ""
+	defaultHealthCheckLocal    = false
+	defaultHealthCheckTimeout  = 60
+	defaultHealthCheckInterval = 5
+)
+
+const (
+	defaultCollapseTrimWhitespace = true
+	defaultCollapseMaskHostnames  = false
+	defaultCollapseLive           = false
 )
 
 var (
@@ -156,10 +201,17 @@ func ExpandPath(path string) string {
 
 // Read reads and parses a configuration file
 func Read(filename string) (*XCConfig, error) {
-	return read(filename, false)
+	return read(filename, "", false)
+}
+
+// ReadWithBackendType reads a configuration file overriding the backend type,
+// the type option may be missing in the file then. An empty backendType
+// leaves the configured one
+func ReadWithBackendType(filename string, backendType string) (*XCConfig, error) {
+	return read(filename, backendType, false)
 }
 
-func read(filename string, secondPass bool) (*XCConfig, error) {
+func read(filename string, backendType string, secondPass bool) (*XCConfig, error) {
 	var props *properties.Properties
 	var err error
 
@@ -175,15 +227,16 @@ func read(filename string, secondPass bool) (*XCConfig, error) {
 				return nil, err
 			}
 		}
-		return read(filename, true)
+		return read(filename, backendType, true)
 	}
 
 	cfg := new(XCConfig)
 	cfg.Readline = defaultReadlineConfig
-	cfg.BackendCfg = &BackendConfig{Type: BTIni, Options: make(map[string]string)}
+	cfg.BackendCfg = &BackendConfig{Options: make(map[string]string)}
 	cfg.LocalEnvironment = make(map[string]string)
 	cfg.RemoteEnvironment = make(map[string]string)
 	cfg.SSHOptions = make(map[string]string)
+	cfg.CollapseReplace = make(map[string]string)
 
 	hf, err := props.GetString("main.history_file")
 	if err != nil {
@@ -203,12 +256,24 @@ func read(filename string, secondPass bool) (*XCConfig, error) {
 	}
 	cfg.LogFile = ExpandPath(lf)
 
+	od, err := props.GetString("main.output_dir")
+	if err != nil {
+		od = defaultOutputDir
+	}
+	cfg.OutputDir = ExpandPath(od)
+
 	cttl, err := props.GetInt("main.cache_ttl")
 	if err != nil {
 		cttl = defaultCacheTTL
 	}
 	cfg.CacheTTL = time.Hour * time.Duration(cttl)
 
+	offline, err := props.GetBool("main.offline")
+	if err != nil {
+		offline = defaultOffline
+	}
+	cfg.Offline = offline
+
 	cd, err := props.GetString("main.cache_dir")
 	if err != nil {
 		cd = defaultCacheDir
@@ -239,12 +304,54 @@ func read(filename string, secondPass bool) (*XCConfig, error) {
 	}
 	cfg.SSHConnectTimeout = ctimeout
 
+	cmdtimeout, err := props.GetInt("executer.command_timeout")
+	if err != nil || cmdtimeout < 0 {
+		cmdtimeout = defaultCommandTimeout
+	}
+	cfg.CommandTimeout = cmdtimeout
+
 	delay, err := props.GetInt("executer.delay")
 	if err != nil || delay < 0 {
 		delay = defaultDelay
 	}
 	cfg.Delay = delay
 
+	batch, err := props.GetString("executer.batch_size")
+	if err != nil {
+		batch = defaultBatchSize
+	}
+	cfg.BatchSize = batch
+
+	maxfail, err := props.GetString("executer.max_failures")
+	if err != nil {
+		maxfail = defaultMaxFailures
+	}
+	cfg.MaxFailures = maxfail
+
+	hcheck, err := props.GetString("executer.health_check")
+	if err != nil {
+		hcheck = defaultHealthCheck
+	}
+	cfg.HealthCheck = hcheck
+
+	hclocal, err := props.GetBool("executer.health_check_local")
+	if err != nil {
+		hclocal = defaultHealthCheckLocal
+	}
+	cfg.HealthCheckLocal = hclocal
+
+	hctimeout, err := props.GetInt("executer.health_check_timeout")
+	if err != nil || hctimeout < 1 {
+		hctimeout = defaultHealthCheckTimeout
+	}
+	cfg.HealthCheckTimeout = hctimeout
+
+	hcinterval, err := props.GetInt("executer.health_check_interval")
+	if err != nil || hcinterval < 1 {
+		hcinterval = defaultHealthCheckInterval
+	}
+	cfg.HealthCheckInterval = hcinterval
+
 	tmpdir, err := props.GetString("executer.remote_tmpdir")
 	if err != nil {
 		tmpdir = defaultRemoteTmpDir
@@ -281,12 +388,30 @@ func read(filename string, secondPass bool) (*XCConfig, error) {
 	}
 	cfg.Distribute = dtr
 
+	transport, err := props.GetString("executer.transport")
+	if err != nil {
+		transport = defaultTransport
+	}
+	cfg.Transport = transport
+
+	reuse, err := props.GetBool("executer.reuse_connections")
+	if err != nil {
+		reuse = defaultReuseConnections
+	}
+	cfg.ReuseConnections = reuse
+
 	mode, err := props.GetString("main.mode")
 	if err != nil {
 		mode = defaultMode
 	}
 	cfg.Mode = mode
 
+	format, err := props.GetString("main.output_format")
+	if err != nil {
+		format = defaultOutputFormat
+	}
+	cfg.OutputFormat = format
+
 	dbg, err := props.GetBool("main.debug")
 	if err != nil {
 		dbg = defaultDebug
@@ -335,6 +460,12 @@ func read(filename string, secondPass bool) (*XCConfig, error) {
 	}
 	cfg.PrependHostnames = phn
 
+	sstderr, err := props.GetBool("executer.separate_stderr")
+	if err != nil {
+		sstderr = defaultSeparateStderr
+	}
+	cfg.SeparateStderr = sstderr
+
 	sshOptsKeys, err := props.Subkeys("ssh")
 	if err == nil {
 		for _, key := range sshOptsKeys {
@@ -344,7 +475,7 @@ func read(filename string, secondPass bool) (*XCConfig, error) {
 	}
 
 	bkeys, err := props.Subkeys("backend")
-	if err != nil {
+	if err != nil && backendType == "" {
 		return nil, fmt.Errorf("Backend configuration error: %s", err)
 	}
 
@@ -352,23 +483,18 @@ func read(filename string, secondPass bool) (*XCConfig, error) {
 	for _, key := range bkeys {
 		value, _ := props.GetString("backend." + key)
 		if key == "type" {
-			cfg.BackendCfg.TypeString = value
-			switch value {
-			case "ini":
-				cfg.BackendCfg.Type = BTIni
-			case "conductor":
-				cfg.BackendCfg.Type = BTConductor
-			case "inventoree":
-				cfg.BackendCfg.Type = BTInventoree
-			default:
-				return nil, fmt.Errorf("Invalid backend type \"%s\"", value)
-			}
-			typeFound = true
+			cfg.BackendCfg.Type = value
+			typeFound = value != ""
 		} else {
 			cfg.BackendCfg.Options[key] = value
 		}
 	}
 
+	if backendType != "" {
+		cfg.BackendCfg.Type = backendType
+		typeFound = true
+	}
+
 	if !typeFound {
 		return nil, fmt.Errorf("Error configuring backend: backend type is not defined")
 	}
@@ -404,5 +530,31 @@ func read(filename string, secondPass bool) (*XCConfig, error) {
 		}
 	}
 
+	trim, err := props.GetBool("collapse.trim_whitespace")
+	if err != nil {
+		trim = defaultCollapseTrimWhitespace
+	}
+	cfg.CollapseTrimWhitespace = trim
+
+	mask, err := props.GetBool("collapse.mask_hostnames")
+	if err != nil {
+		mask = defaultCollapseMaskHostnames
+	}
+	cfg.CollapseMaskHostnames = mask
+
+	live, err := props.GetBool("collapse.live")
+	if err != nil {
+		live = defaultCollapseLive
+	}
+	cfg.CollapseLive = live
+
+	replkeys, err := props.Subkeys("collapse_replace")
+	if err == nil {
+		for _, key := range replkeys {
+			value, _ := props.GetString(fmt.Sprintf("collapse_replace.%s", key))
+			cfg.CollapseReplace[key] = value
+		}
+	}
+
 	return cfg, nil
 }
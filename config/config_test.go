@@ -0,0 +1,91 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func writeConfig(t *testing.T, contents string) string {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "xc.conf")
+	if err := ioutil.WriteFile(filename, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func TestHealthCheckTimings(t *testing.T) {
+	tests := []struct {
+		timeout          string
+		interval         string
+		expectedTimeout  int
+		expectedInterval int
+	}{
+		{"30", "2", 30, 2},
+		{"1", "1", 1, 1},
+		// values below 1 are replaced by defaults
+		{"0", "0", defaultHealthCheckTimeout, defaultHealthCheckInterval},
+		{"-5", "-1", defaultHealthCheckTimeout, defaultHealthCheckInterval},
+		{"abc", "", defaultHealthCheckTimeout, defaultHealthCheckInterval},
+	}
+	for _, tt := range tests {
+		filename := writeConfig(t, fmt.Sprintf(`[executer]
+health_check_timeout = %s
+health_check_interval = %s
+
+[backend]
+type = localini
+`, tt.timeout, tt.interval))
+		cfg, err := Read(filename)
+		if err != nil {
+			t.Fatalf("config read error: %s", err)
+		}
+		if cfg.HealthCheckTimeout != tt.expectedTimeout {
+			t.Errorf("health_check_timeout = %q is read as %d, expected %d", tt.timeout, cfg.HealthCheckTimeout, tt.expectedTimeout)
+		}
+		if cfg.HealthCheckInterval != tt.expectedInterval {
+			t.Errorf("health_check_interval = %q is read as %d, expected %d", tt.interval, cfg.HealthCheckInterval, tt.expectedInterval)
+		}
+	}
+}
+
+func TestReadWithBackendType(t *testing.T) {
+	tests := []struct {
+		name        string
+		contents    string
+		backendType string
+		expected    string
+	}{
+		{"configured", "[backend]\ntype = inventoree\nurl = http://localhost\n", "", "inventoree"},
+		{"overridden", "[backend]\ntype = inventoree\nurl = http://localhost\n", "ini", "ini"},
+		{"type missing", "[backend]\nfilename = ~/hosts.ini\n", "ini", "ini"},
+		{"section missing", "[main]\nmode = parallel\n", "ini", "ini"},
+	}
+	for _, tt := range tests {
+		cfg, err := ReadWithBackendType(writeConfig(t, tt.contents), tt.backendType)
+		if err != nil {
+			t.Errorf("%s: config read error: %s", tt.name, err)
+			continue
+		}
+		if cfg.BackendCfg.Type != tt.expected {
+			t.Errorf("%s: backend type is %q, expected %q", tt.name, cfg.BackendCfg.Type, tt.expected)
+		}
+	}
+
+	// the rest of the backend options are kept
+	cfg, err := ReadWithBackendType(writeConfig(t, "[backend]\nfilename = /tmp/hosts.ini\n"), "ini")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.BackendCfg.Options["filename"] != "/tmp/hosts.ini" {
+		t.Errorf("backend options are %v", cfg.BackendCfg.Options)
+	}
+
+	for _, contents := range []string{"[backend]\nfilename = /tmp/hosts.ini\n", "[main]\nmode = parallel\n"} {
+		if _, err := Read(writeConfig(t, contents)); err == nil {
+			t.Errorf("config without backend type is read:\n%s", contents)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package remote
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	hostnameMask = "<host>"
+)
+
+// CollapseRule replaces volatile parts of output like timestamps or PIDs
+type CollapseRule struct {
+	Name        string
+	Pattern     *regexp.Regexp
+	Replacement string
+}
+
+// CollapseOptions describe how outputs are normalized
+// before grouping hosts in collapse mode
+type CollapseOptions struct {
+	Rules          []*CollapseRule
+	MaskHostnames  bool
+	TrimWhitespace bool
+}
+
+// OutputKey is the key of collapsed outputs, hosts are grouped
+// by their normalized output and exit code
+type OutputKey struct {
+	Output   string
+	ExitCode int
+}
+
+// OutputGroup is a group of hosts with the same output key
+type OutputGroup struct {
+	OutputKey
+	Hosts []string
+}
+
+var (
+	currentCollapseOptions CollapseOptions
+
+	// compiled once per host as the live view normalizes
+	// outputs on every redraw
+	hostnameExprs    = make(map[string]*regexp.Regexp)
+	hostnameExprLock sync.Mutex
+)
+
+// SetCollapseOptions sets output normalization for collapse mode
+func SetCollapseOptions(opts CollapseOptions) {
+	currentCollapseOptions = opts
+}
+
+// hostnameExpr returns the cached expression matching the host name
+// and its short form, the full name goes first to be preferred
+func hostnameExpr(host string) *regexp.Regexp {
+	hostnameExprLock.Lock()
+	defer hostnameExprLock.Unlock()
+
+	expr, found := hostnameExprs[host]
+	if !found {
+		pattern := regexp.QuoteMeta(host)
+		if idx := strings.Index(host, "."); idx > 0 {
+			pattern += "|" + regexp.QuoteMeta(host[:idx])
+		}
+		expr = regexp.MustCompile(`\b(?:` + pattern + `)\b`)
+		hostnameExprs[host] = expr
+	}
+	return expr
+}
+
+// maskHostname replaces the host name and its short form
+// with a placeholder
+func maskHostname(host string, output string) string {
+	return hostnameExpr(host).ReplaceAllLiteralString(output, hostnameMask)
+}
+
+// trimWhitespace removes trailing whitespace including \r added by
+// terminals from every line as well as leading and trailing empty lines
+func trimWhitespace(output string) string {
+	lines := strings.Split(output, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t\r")
+	}
+	return strings.Trim(strings.Join(lines, "\n"), "\n")
+}
+
+// normalize applies the options to the output of a host
+func (o *CollapseOptions) normalize(host string, output string) string {
+	if o.MaskHostnames {
+		output = maskHostname(host, output)
+	}
+	for _, rule := range o.Rules {
+		output = rule.Pattern.ReplaceAllString(output, rule.Replacement)
+	}
+	if o.TrimWhitespace {
+		output = trimWhitespace(output)
+	}
+	return output
+}
+
+// groupOutputs groups all the hosts of the result by their normalized output
+// and exit code, hosts without any output form groups as well
+func (r *ExecResult) groupOutputs() {
+	for host, code := range r.Codes {
+		output := ""
+		if hr, found := r.Hosts[host]; found {
+			output = hr.Output()
+		}
+		key := OutputKey{currentCollapseOptions.normalize(host, output), code}
+		r.Outputs[key] = append(r.Outputs[key], host)
+	}
+}
+
+// Groups returns output groups sorted by size, the largest group goes first
+func (r *ExecResult) Groups() []*OutputGroup {
+	groups := make([]*OutputGroup, 0, len(r.Outputs))
+	for key, hosts := range r.Outputs {
+		sorted := make([]string, len(hosts))
+		copy(sorted, hosts)
+		sort.Strings(sorted)
+		groups = append(groups, &OutputGroup{key, sorted})
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if len(groups[i].Hosts) != len(groups[j].Hosts) {
+			return len(groups[i].Hosts) > len(groups[j].Hosts)
+		}
+		if groups[i].ExitCode != groups[j].ExitCode {
+			return groups[i].ExitCode < groups[j].ExitCode
+		}
+		return groups[i].Hosts[0] < groups[j].Hosts[0]
+	})
+	return groups
+}
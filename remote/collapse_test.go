@@ -0,0 +1,133 @@
+package remote
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestMaskHostname(t *testing.T) {
+	tests := []struct {
+		host     string
+		output   string
+		expected string
+	}{
+		{"web1.example.com", "web1.example.com is up", "<host> is up"},
+		{"web1.example.com", "hostname: web1\n", "hostname: <host>\n"},
+		{"web1.example.com", "web1 web1.example.com web1", "<host> <host> <host>"},
+		// partial words aren't masked
+		{"web1.example.com", "web10 aweb1 web1_x", "web10 aweb1 web1_x"},
+		{"web1.example.com", "web1.example.community", "<host>.example.community"},
+		{"web1", "web1.example.com", "<host>.example.com"},
+		// regexp metacharacters are matched literally, the dot isn't a wildcard
+		{"web1.example.com", "web1xexample.com", "web1xexample.com"},
+		{"db+1.local", "db+1.local db+1 dbb1", "<host> <host> dbb1"},
+		{"web1.example.com", "no hostname here", "no hostname here"},
+	}
+	for _, tt := range tests {
+		if res := maskHostname(tt.host, tt.output); res != tt.expected {
+			t.Errorf("maskHostname(%q, %q) = %q, expected %q", tt.host, tt.output, res, tt.expected)
+		}
+	}
+}
+
+func TestHostnameExprCached(t *testing.T) {
+	if hostnameExpr("cached.example.com") != hostnameExpr("cached.example.com") {
+		t.Errorf("host name expression is compiled on every call")
+	}
+}
+
+func TestTrimWhitespace(t *testing.T) {
+	tests := []struct {
+		output   string
+		expected string
+	}{
+		{"", ""},
+		{"\n\n", ""},
+		{"line", "line"},
+		{"line  \r\n", "line"},
+		{"\n\none \t\r\n  two\r\n\n", "one\n  two"},
+		{"one\n\n\ntwo", "one\n\n\ntwo"},
+		{"  indented\n", "  indented"},
+	}
+	for _, tt := range tests {
+		if res := trimWhitespace(tt.output); res != tt.expected {
+			t.Errorf("trimWhitespace(%q) = %q, expected %q", tt.output, res, tt.expected)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	pidRule := &CollapseRule{Name: "pid", Pattern: regexp.MustCompile(`pid \d+`), Replacement: "pid N"}
+	hostRule := &CollapseRule{Name: "mask", Pattern: regexp.MustCompile(`<host>`), Replacement: "HOST"}
+	output := "web1.example.com: started, pid 1234  \r\n"
+
+	tests := []struct {
+		name     string
+		opts     CollapseOptions
+		expected string
+	}{
+		{"nothing", CollapseOptions{}, output},
+		{"mask", CollapseOptions{MaskHostnames: true}, "<host>: started, pid 1234  \r\n"},
+		{"rules", CollapseOptions{Rules: []*CollapseRule{pidRule}}, "web1.example.com: started, pid N  \r\n"},
+		{"trim", CollapseOptions{TrimWhitespace: true}, "web1.example.com: started, pid 1234"},
+		{
+			"all", CollapseOptions{Rules: []*CollapseRule{pidRule}, MaskHostnames: true, TrimWhitespace: true},
+			"<host>: started, pid N",
+		},
+		{
+			// rules apply to the masked output
+			"rules after mask", CollapseOptions{Rules: []*CollapseRule{hostRule}, MaskHostnames: true},
+			"HOST: started, pid 1234  \r\n",
+		},
+	}
+	for _, tt := range tests {
+		if res := tt.opts.normalize("web1.example.com", output); res != tt.expected {
+			t.Errorf("%s: normalized output is %q, expected %q", tt.name, res, tt.expected)
+		}
+	}
+}
+
+func TestGroups(t *testing.T) {
+	r := newExecResult()
+	outputs := []struct {
+		host   string
+		output string
+		code   int
+	}{
+		{"h5", "b", 0},
+		{"h2", "a", 0},
+		{"h6", "a", 1},
+		{"h1", "a", 0},
+		{"h3", "c", 0},
+		{"h4", "b", 0},
+		{"h7", "", 2},
+		{"h0", "d", 1},
+	}
+	for _, o := range outputs {
+		r.addOutput(o.host, []byte(o.output), false)
+		r.addResult(o.host, o.code)
+	}
+	r.groupOutputs()
+
+	// by size, then by exit code, then by the first host
+	expected := []*OutputGroup{
+		{OutputKey{"a", 0}, []string{"h1", "h2"}},
+		{OutputKey{"b", 0}, []string{"h4", "h5"}},
+		{OutputKey{"c", 0}, []string{"h3"}},
+		{OutputKey{"d", 1}, []string{"h0"}},
+		{OutputKey{"a", 1}, []string{"h6"}},
+		{OutputKey{"", 2}, []string{"h7"}},
+	}
+	groups := r.Groups()
+	if !reflect.DeepEqual(groups, expected) {
+		for i, g := range groups {
+			t.Logf("group %d: %q %d %v", i, g.Output, g.ExitCode, g.Hosts)
+		}
+		t.Errorf("groups are not sorted as expected")
+	}
+
+	if groups := newExecResult().Groups(); len(groups) != 0 {
+		t.Errorf("empty result has %d groups", len(groups))
+	}
+}
@@ -3,32 +3,57 @@ package remote
 import (
 	"fmt"
 	"os/exec"
+	"strconv"
 	"strings"
 
 	"github.com/viert/xc/log"
 )
 
 func (w *Worker) copy(task *Task) int {
+	if currentTransport == TTNative {
+		return w.nativeCopy(task)
+	}
 	cmd := createSCPCmd(task.Hostname, task.LocalFilename, task.RemoteFilename, task.RecursiveCopy)
 	return w._run(task, cmd)
 }
 
 func (w *Worker) runcmd(task *Task) int {
-	cmd := createSSHCmd(task.Hostname, task.Cmd)
+	if currentTransport == TTNative {
+		return w.nativeRuncmd(task)
+	}
+	cmd := createSSHCmd(task.Hostname, task.Cmd, needTTY())
 	return w._run(task, cmd)
 }
 
 func (w *Worker) tarcopy(task *Task) int {
+	if currentTransport == TTNative {
+		return w.nativeTarcopy(task)
+	}
 	cmd := createTarCopyCmd(task.Hostname, task.LocalFilename, task.RemoteFilename)
 	return w._run(task, cmd)
 }
 
+// sshHostOpts returns ssh options specific to the host.
+// portFlag differs for ssh (-p) and scp (-P)
+func sshHostOpts(hp *HostParams, portFlag string) []string {
+	params := make([]string, 0)
+	if hp.Port > 0 {
+		params = append(params, portFlag, strconv.Itoa(hp.Port))
+	}
+	if hp.JumpHost != "" {
+		params = append(params, "-o", "ProxyJump="+hp.JumpHost)
+	}
+	return params
+}
+
 func createTarCopyCmd(host string, local string, remote string) *exec.Cmd {
 	if remote == "" || remote == local {
 		remote = "."
 	}
-	options := strings.Join(sshOpts(), " ")
-	sshCmd := fmt.Sprintf("ssh -l %s %s %s", currentUser, options, host)
+	hp := resolveHost(host)
+	options := append(sshOpts(), sshHostOpts(hp, "-p")...)
+	options = append(options, controlOpts(host, hp)...)
+	sshCmd := fmt.Sprintf("ssh -l %s %s %s", hp.User, strings.Join(options, " "), hp.Address)
 	tarCmd := fmt.Sprintf("tar c %s | %s tar x -C %s", local, sshCmd, remote)
 	params := []string{"-c", tarCmd}
 	log.Debugf("Created command bash %v", params)
@@ -40,21 +65,36 @@ func createSCPCmd(host string, local string, remote string, recursive bool) *exe
 	if recursive {
 		params = []string{"-r"}
 	}
+	hp := resolveHost(host)
 	params = append(params, sshOpts()...)
-	remoteExpr := fmt.Sprintf("%s@%s:%s", currentUser, host, remote)
+	params = append(params, sshHostOpts(hp, "-P")...)
+	params = append(params, controlOpts(host, hp)...)
+	address := hp.Address
+	if strings.Contains(address, ":") {
+		// IPv6 address
+		address = "[" + address + "]"
+	}
+	remoteExpr := fmt.Sprintf("%s@%s:%s", hp.User, address, remote)
 	params = append(params, local, remoteExpr)
 	log.Debugf("Created command scp %v", params)
 	return exec.Command("scp", params...)
 }
 
-func createSSHCmd(host string, argv string) *exec.Cmd {
+func createSSHCmd(host string, argv string, tty bool) *exec.Cmd {
+	hp := resolveHost(host)
+	ttyFlag := "-tt"
+	if !tty {
+		ttyFlag = "-T"
+	}
 	params := []string{
-		"-tt",
+		ttyFlag,
 		"-l",
-		currentUser,
+		hp.User,
 	}
 	params = append(params, sshOpts()...)
-	params = append(params, host)
+	params = append(params, sshHostOpts(hp, "-p")...)
+	params = append(params, controlOpts(host, hp)...)
+	params = append(params, hp.Address)
 	params = append(params, getInterpreter()...)
 	if argv != "" {
 		params = append(params, "-c", argv)
@@ -63,6 +103,13 @@ func createSSHCmd(host string, argv string) *exec.Cmd {
 	return exec.Command(sshCommand, params...)
 }
 
+// needTTY returns true if commands are to be run in a terminal. A terminal
+// merges stderr into stdout so it's only skipped when stderr is to be
+// kept separately and there's no su/sudo password prompt to answer
+func needTTY() bool {
+	return !currentSeparateStderr || currentRaise != RTNone
+}
+
 func getInterpreter() []string {
 	switch currentRaise {
 	case RTSudo:
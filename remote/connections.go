@@ -0,0 +1,239 @@
+package remote
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/viert/xc/log"
+)
+
+const (
+	// masters left by a crashed xc die by themselves after this timeout
+	defaultControlPersist = "30m"
+)
+
+// ConnectionInfo describes a connection kept open for reuse
+type ConnectionInfo struct {
+	Host      string
+	Address   string
+	Transport string
+	Created   time.Time
+	LastUsed  time.Time
+}
+
+// cachedConn is an entry of the connection cache, either a native
+// connection or an external ssh control master socket
+type cachedConn struct {
+	info        ConnectionInfo
+	conn        *nativeConn
+	controlPath string
+	params      *HostParams
+}
+
+var (
+	currentReuseConnections bool
+	connCache               = make(map[string]*cachedConn)
+	connCacheLock           sync.Mutex
+	controlDir              string
+)
+
+// SetReuseConnections sets connection reuse on/off,
+// turning it off drops all the cached connections
+func SetReuseConnections(reuse bool) {
+	currentReuseConnections = reuse
+	if !reuse {
+		DropConnections(nil)
+	}
+}
+
+// Connections returns the list of connections kept open
+func Connections() []*ConnectionInfo {
+	connCacheLock.Lock()
+	defer connCacheLock.Unlock()
+
+	result := make([]*ConnectionInfo, 0, len(connCache))
+	for host, cc := range connCache {
+		if !cc.alive() {
+			delete(connCache, host)
+			continue
+		}
+		info := cc.info
+		result = append(result, &info)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Host < result[j].Host })
+	return result
+}
+
+// DropConnections closes cached connections to the given hosts
+// or all of them if hosts is nil. Returns the number of connections closed
+func DropConnections(hosts []string) int {
+	connCacheLock.Lock()
+	defer connCacheLock.Unlock()
+
+	if hosts == nil {
+		hosts = make([]string, 0, len(connCache))
+		for host := range connCache {
+			hosts = append(hosts, host)
+		}
+	}
+
+	count := 0
+	for _, host := range hosts {
+		cc, found := connCache[host]
+		if !found {
+			continue
+		}
+		if cc.alive() {
+			count++
+		}
+		cc.close()
+		delete(connCache, host)
+	}
+	return count
+}
+
+// CloseConnections closes all the cached connections, it's called on xc exit
+func CloseConnections() {
+	DropConnections(nil)
+	if controlDir != "" {
+		os.RemoveAll(controlDir)
+		controlDir = ""
+	}
+}
+
+func (cc *cachedConn) alive() bool {
+	if cc.conn != nil {
+		select {
+		case <-cc.conn.done:
+			return false
+		default:
+			return true
+		}
+	}
+	_, err := os.Stat(cc.controlPath)
+	return err == nil
+}
+
+func (cc *cachedConn) close() {
+	if cc.conn != nil {
+		cc.conn.Close()
+		return
+	}
+	if _, err := os.Stat(cc.controlPath); err != nil {
+		return
+	}
+	params := append(sshOpts(), "-O", "exit", "-o", "ControlPath="+cc.controlPath, cc.params.Address)
+	err := exec.Command(sshCommand, params...).Run()
+	if err != nil {
+		log.Debugf("error stopping ssh control master for %s: %s", cc.info.Host, err)
+		os.Remove(cc.controlPath)
+	}
+}
+
+// cachedNativeConn returns an alive cached connection to the host if any
+func cachedNativeConn(host string) *nativeConn {
+	connCacheLock.Lock()
+	defer connCacheLock.Unlock()
+	cc, found := connCache[host]
+	if !found || cc.conn == nil {
+		return nil
+	}
+	if !cc.alive() {
+		delete(connCache, host)
+		return nil
+	}
+	cc.info.LastUsed = time.Now()
+	return cc.conn
+}
+
+// cacheNativeConn puts a new connection into the cache. If another worker
+// has cached a connection to the same host meanwhile, that one is returned
+func cacheNativeConn(host string, conn *nativeConn) *nativeConn {
+	connCacheLock.Lock()
+	defer connCacheLock.Unlock()
+	if cc, found := connCache[host]; found {
+		if cc.conn != nil && cc.alive() {
+			conn.Close()
+			return cc.conn
+		}
+		// e.g. an ssh master left after switching the transport
+		cc.close()
+	}
+	conn.cached = true
+	now := time.Now()
+	connCache[host] = &cachedConn{
+		info: ConnectionInfo{
+			Host:      host,
+			Address:   conn.client.RemoteAddr().String(),
+			Transport: "native",
+			Created:   now,
+			LastUsed:  now,
+		},
+		conn: conn,
+	}
+	return conn
+}
+
+// controlOpts returns ssh options making the external ssh share
+// one master connection per host while connection reuse is on
+func controlOpts(host string, hp *HostParams) []string {
+	if !currentReuseConnections {
+		return []string{}
+	}
+
+	connCacheLock.Lock()
+	defer connCacheLock.Unlock()
+
+	if controlDir == "" {
+		dir, err := ioutil.TempDir("", fmt.Sprintf("xc-%d-", os.Getpid()))
+		if err != nil {
+			log.Debugf("error creating ssh control directory: %s", err)
+			return []string{}
+		}
+		controlDir = dir
+	}
+
+	// socket paths are limited to ~100 chars so a hash of connection
+	// parameters is used instead of the host name
+	id := fmt.Sprintf("%s@%s:%d/%s", hp.User, hp.Address, hp.Port, hp.JumpHost)
+	controlPath := filepath.Join(controlDir, fmt.Sprintf("%x", sha1.Sum([]byte(id)))[:16])
+
+	now := time.Now()
+	cc, found := connCache[host]
+	if !found || cc.controlPath != controlPath {
+		if found {
+			cc.close()
+		}
+		address := hp.Address
+		if hp.Port > 0 {
+			address += ":" + strconv.Itoa(hp.Port)
+		}
+		cc = &cachedConn{
+			info: ConnectionInfo{
+				Host:      host,
+				Address:   address,
+				Transport: "ssh",
+				Created:   now,
+			},
+			controlPath: controlPath,
+			params:      hp,
+		}
+		connCache[host] = cc
+	}
+	cc.info.LastUsed = now
+
+	// options configured in [ssh] section go first thus have priority
+	return []string{
+		"-o", "ControlMaster=auto",
+		"-o", "ControlPath=" + controlPath,
+		"-o", "ControlPersist=" + defaultControlPersist,
+	}
+}
@@ -0,0 +1,223 @@
+package remote
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/viert/xc/term"
+)
+
+const (
+	diffContext = 3
+	// differing parts larger than this (lines of one output multiplied by lines
+	// of another) are shown as completely replaced to keep memory usage sane
+	maxDiffCells = 4 * 1024 * 1024
+)
+
+// diffOp is a line of diff, kind is one of ' ', '-' and '+'
+type diffOp struct {
+	kind byte
+	line string
+}
+
+// diffLines returns the shortest edit script turning a into b
+func diffLines(a []string, b []string) []diffOp {
+	ops := make([]diffOp, 0, len(a)+len(b))
+
+	// common prefix and suffix are cut off to keep the lcs table small
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	for _, line := range a[:prefix] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	ops = append(ops, lcsDiff(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	return ops
+}
+
+func lcsDiff(a []string, b []string) []diffOp {
+	n, m := len(a), len(b)
+	ops := make([]diffOp, 0, n+m)
+
+	if n*m > maxDiffCells {
+		for _, line := range a {
+			ops = append(ops, diffOp{'-', line})
+		}
+		for _, line := range b {
+			ops = append(ops, diffOp{'+', line})
+		}
+		return ops
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		ops = append(ops, diffOp{'-', a[i]})
+	}
+	for ; j < m; j++ {
+		ops = append(ops, diffOp{'+', b[j]})
+	}
+	return ops
+}
+
+// hunkRange formats a unified diff range, empty ranges
+// point to the line before them
+func hunkRange(start int, length int) string {
+	if length == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if length == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, length)
+}
+
+// unifiedDiff returns the hunks of unified diff between a and b,
+// an empty list means there's no difference
+func unifiedDiff(a []string, b []string, context int) []string {
+	ops := diffLines(a, b)
+
+	// line positions in a and b every op starts at
+	aPos := make([]int, len(ops)+1)
+	bPos := make([]int, len(ops)+1)
+	for k, op := range ops {
+		aPos[k+1], bPos[k+1] = aPos[k], bPos[k]
+		if op.kind != '+' {
+			aPos[k+1]++
+		}
+		if op.kind != '-' {
+			bPos[k+1]++
+		}
+	}
+
+	lines := make([]string, 0)
+	k := 0
+	for {
+		for k < len(ops) && ops[k].kind == ' ' {
+			k++
+		}
+		if k == len(ops) {
+			break
+		}
+
+		// changes separated by up to 2*context unchanged lines are joined
+		// into one hunk the same way GNU diff does
+		last := k
+		for j := k; j < len(ops) && j-last <= 2*context+1; j++ {
+			if ops[j].kind != ' ' {
+				last = j
+			}
+		}
+		start := k - context
+		if start < 0 {
+			start = 0
+		}
+		end := last + context + 1
+		if end > len(ops) {
+			end = len(ops)
+		}
+
+		lines = append(lines, fmt.Sprintf("@@ -%s +%s @@",
+			hunkRange(aPos[start], aPos[end]-aPos[start]),
+			hunkRange(bPos[start], bPos[end]-bPos[start])))
+		for _, op := range ops[start:end] {
+			lines = append(lines, string(op.kind)+op.line)
+		}
+		k = end
+	}
+	return lines
+}
+
+func splitLines(output string) []string {
+	if output == "" {
+		return []string{}
+	}
+	return strings.Split(strings.TrimSuffix(output, "\n"), "\n")
+}
+
+// PrintDiff prints the output of the largest group as the baseline
+// followed by unified diffs of every other group against it
+func (r *ExecResult) PrintDiff() {
+	if jsonOutput() {
+		// diffs are for humans, machines get the groups
+		r.emitGroups()
+		return
+	}
+
+	groups := r.Groups()
+	if len(groups) == 0 {
+		return
+	}
+
+	baseline := groups[0]
+	printGroupHeader("baseline, ", baseline)
+	fmt.Println(baseline.Output)
+
+	if len(groups) == 1 {
+		term.Successf("All hosts have the same output\n")
+		return
+	}
+
+	baseLines := splitLines(baseline.Output)
+	for _, group := range groups[1:] {
+		printGroupHeader("", group)
+		hunks := unifiedDiff(baseLines, splitLines(group.Output), diffContext)
+		if len(hunks) == 0 {
+			fmt.Println("the output is the same as the baseline one")
+			continue
+		}
+		fmt.Println(term.Red("--- baseline"))
+		fmt.Println(term.Green("+++ " + group.Hosts[0]))
+		for _, line := range hunks {
+			switch line[0] {
+			case '@':
+				fmt.Println(term.Cyan(line))
+			case '-':
+				fmt.Println(term.Red(line))
+			case '+':
+				fmt.Println(term.Green(line))
+			default:
+				fmt.Println(line)
+			}
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package remote
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func lines(s string) []string {
+	return splitLines(s)
+}
+
+func opsString(ops []diffOp) string {
+	var sb strings.Builder
+	for _, op := range ops {
+		sb.WriteByte(op.kind)
+		sb.WriteString(op.line)
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+func TestHunkRange(t *testing.T) {
+	tests := []struct {
+		start    int
+		length   int
+		expected string
+	}{
+		{0, 0, "0,0"},
+		{3, 0, "3,0"},
+		{0, 1, "1"},
+		{4, 1, "5"},
+		{0, 2, "1,2"},
+		{6, 4, "7,4"},
+	}
+	for _, tt := range tests {
+		if res := hunkRange(tt.start, tt.length); res != tt.expected {
+			t.Errorf("hunkRange(%d, %d) = %q, expected %q", tt.start, tt.length, res, tt.expected)
+		}
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		name     string
+		a        string
+		b        string
+		expected string
+	}{
+		{"both empty", "", "", ""},
+		{"empty a", "", "x\ny\n", "+x\n+y\n"},
+		{"empty b", "x\ny\n", "", "-x\n-y\n"},
+		{"same", "x\ny\n", "x\ny\n", " x\n y\n"},
+		{"prepend", "c\nd\n", "a\nb\nc\nd\n", "+a\n+b\n c\n d\n"},
+		{"append", "a\nb\n", "a\nb\nc\n", " a\n b\n+c\n"},
+		{"change", "a\nb\nc\n", "a\nx\nc\n", " a\n-b\n+x\n c\n"},
+		{"delete and insert", "a\nb\nc\nd\n", "a\nc\nd\ne\n", " a\n-b\n c\n d\n+e\n"},
+	}
+	for _, tt := range tests {
+		res := opsString(diffLines(lines(tt.a), lines(tt.b)))
+		if res != tt.expected {
+			t.Errorf("%s: diffLines is\n%s\nexpected\n%s", tt.name, res, tt.expected)
+		}
+	}
+}
+
+func TestLcsDiff(t *testing.T) {
+	tests := []struct {
+		a        string
+		b        string
+		expected string
+	}{
+		{"", "", ""},
+		{"a\n", "", "-a\n"},
+		{"", "a\n", "+a\n"},
+		{"a\nb\n", "b\na\n", "-a\n b\n+a\n"},
+		{"a\nb\nc\n", "x\nb\ny\n", "-a\n+x\n b\n-c\n+y\n"},
+	}
+	for _, tt := range tests {
+		res := opsString(lcsDiff(lines(tt.a), lines(tt.b)))
+		if res != tt.expected {
+			t.Errorf("lcsDiff(%q, %q) is\n%s\nexpected\n%s", tt.a, tt.b, res, tt.expected)
+		}
+	}
+}
+
+func TestLcsDiffTooLarge(t *testing.T) {
+	// the table would exceed maxDiffCells
+	n := 2049
+	a := make([]string, n)
+	b := make([]string, n)
+	for i := 0; i < n; i++ {
+		a[i] = fmt.Sprintf("a%d", i)
+		b[i] = fmt.Sprintf("b%d", i)
+	}
+	// a common line which would be kept if the lcs was computed
+	a[1000], b[1000] = "common", "common"
+
+	ops := lcsDiff(a, b)
+	if len(ops) != 2*n {
+		t.Fatalf("%d ops, expected %d", len(ops), 2*n)
+	}
+	for i, op := range ops {
+		kind, line := byte('-'), a[i%n]
+		if i >= n {
+			kind, line = '+', b[i%n]
+		}
+		if op.kind != kind || op.line != line {
+			t.Fatalf("op %d is %c%s, expected %c%s", i, op.kind, op.line, kind, line)
+		}
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		a        string
+		b        string
+		expected []string
+	}{
+		{"both empty", "", "", []string{}},
+		{"same", "1\n2\n", "1\n2\n", []string{}},
+		{"empty a", "", "a\nb\n", []string{"@@ -0,0 +1,2 @@", "+a", "+b"}},
+		{"empty b", "a\nb\n", "", []string{"@@ -1,2 +0,0 @@", "-a", "-b"}},
+		{
+			"prepend", "c\nd\n", "a\nb\nc\nd\n",
+			[]string{"@@ -1,2 +1,4 @@", "+a", "+b", " c", " d"},
+		},
+		{
+			"append", "1\n2\n3\n4\n5\n", "1\n2\n3\n4\n5\n6\n",
+			[]string{"@@ -3,3 +3,4 @@", " 3", " 4", " 5", "+6"},
+		},
+		{
+			"delete", "1\n2\n3\n4\n5\n", "1\n2\n4\n5\n",
+			[]string{"@@ -1,5 +1,4 @@", " 1", " 2", "-3", " 4", " 5"},
+		},
+		{
+			// 2*context unchanged lines between changes keep them in one hunk
+			"adjacent hunks joined", "1\n2\n3\n4\n5\n6\n7\n8\n9\n", "1\nX\n3\n4\n5\n6\n7\n8\nY\n",
+			[]string{"@@ -1,9 +1,9 @@", " 1", "-2", "+X", " 3", " 4", " 5", " 6", " 7", " 8", "-9", "+Y"},
+		},
+		{
+			// one more unchanged line splits them
+			"adjacent hunks split", "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n", "1\nX\n3\n4\n5\n6\n7\n8\n9\nY\n",
+			[]string{
+				"@@ -1,5 +1,5 @@", " 1", "-2", "+X", " 3", " 4", " 5",
+				"@@ -7,4 +7,4 @@", " 7", " 8", " 9", "-10", "+Y",
+			},
+		},
+	}
+	for _, tt := range tests {
+		res := unifiedDiff(lines(tt.a), lines(tt.b), diffContext)
+		if !reflect.DeepEqual(res, tt.expected) {
+			t.Errorf("%s: unifiedDiff is\n%s\nexpected\n%s", tt.name, strings.Join(res, "\n"), strings.Join(tt.expected, "\n"))
+		}
+	}
+}
@@ -26,7 +26,7 @@ func Distribute(hosts []string, localFilename string, remoteFilename string, rec
 
 	r = newExecResult()
 	running = len(hosts)
-	if currentProgressBar {
+	if currentProgressBar && !jsonOutput() {
 		bar = pb.StartNew(running)
 	}
 
@@ -52,33 +52,42 @@ func Distribute(hosts []string, localFilename string, remoteFilename string, rec
 		wg.Wait()
 	}()
 
+	lines := make(lineBuffers)
 	for running > 0 {
 		select {
 		case d := <-pool.Data:
 			switch d.Type {
-			case MTData:
+			case MTTaskStarted:
+				r.startHost(d.Hostname)
+			case MTData, MTStderr:
+				r.addOutput(d.Hostname, d.Data, d.Type == MTStderr)
+				if jsonOutput() {
+					lines.write(d.Hostname, d.Data, d.Type == MTStderr)
+				}
 				if !bytes.HasSuffix(d.Data, []byte{'\n'}) {
 					d.Data = append(d.Data, '\n')
 				}
+				writeHostOutput(d.Hostname, d.Data)
+				if jsonOutput() {
+					break
+				}
 				if currentPrependHostnames {
 					fmt.Printf("%s: ", term.Blue(d.Hostname))
 				}
 				fmt.Print(string(d.Data))
-				writeHostOutput(d.Hostname, d.Data)
 			case MTDebug:
 				if currentDebug {
 					log.Debugf("DATASTREAM @ %s\n%v\n[%v]", d.Hostname, d.Data, string(d.Data))
 				}
 			case MTCopyFinished:
 				running--
-				if currentProgressBar {
+				if bar != nil {
 					bar.Increment()
 				}
-				r.Codes[d.Hostname] = d.StatusCode
-				if d.StatusCode == 0 {
-					r.SuccessHosts = append(r.SuccessHosts, d.Hostname)
-				} else {
-					r.ErrorHosts = append(r.ErrorHosts, d.Hostname)
+				r.addResult(d.Hostname, d.StatusCode)
+				if jsonOutput() {
+					lines.flush(d.Hostname)
+					r.emitFinished(d.Hostname)
 				}
 			}
 		case <-sigs:
@@ -86,7 +95,7 @@ func Distribute(hosts []string, localFilename string, remoteFilename string, rec
 		}
 	}
 
-	if currentProgressBar {
+	if bar != nil {
 		bar.Finish()
 	}
 	return r
@@ -8,6 +8,7 @@ import (
 	"strings"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/viert/xc/log"
 	"github.com/viert/xc/term"
@@ -21,46 +22,113 @@ const (
 // ExecResult is a struct with execution results
 type ExecResult struct {
 	Codes   map[string]int
-	Outputs map[string][]string
+	Outputs map[OutputKey][]string
+	Hosts   map[string]*HostResult
 
 	SuccessHosts      []string
 	ErrorHosts        []string
+	TimeoutHosts      []string
+	SkippedHosts      []string
 	ForceStoppedHosts int
 }
 
 func newExecResult() *ExecResult {
 	return &ExecResult{
 		Codes:             make(map[string]int),
-		Outputs:           make(map[string][]string),
+		Outputs:           make(map[OutputKey][]string),
+		Hosts:             make(map[string]*HostResult),
 		SuccessHosts:      make([]string, 0),
 		ErrorHosts:        make([]string, 0),
+		TimeoutHosts:      make([]string, 0),
+		SkippedHosts:      make([]string, 0),
 		ForceStoppedHosts: 0,
 	}
 }
 
+// addResult registers the exit code of a host, timed out hosts
+// are counted as errors and listed in TimeoutHosts as well
+func (r *ExecResult) addResult(host string, code int) {
+	r.Codes[host] = code
+	hr := r.host(host)
+	hr.ExitCode = code
+	hr.End = time.Now()
+	hr.Failure = Classify(code)
+	if code == 0 {
+		r.SuccessHosts = append(r.SuccessHosts, host)
+		return
+	}
+	r.ErrorHosts = append(r.ErrorHosts, host)
+	if code == ErrTimeout {
+		r.TimeoutHosts = append(r.TimeoutHosts, host)
+	}
+}
+
 // Print prints ExecResults in a nice way
 func (r *ExecResult) Print() {
-	msg := fmt.Sprintf(" Hosts processed: %d, success: %d, error: %d    ",
+	if jsonOutput() {
+		r.emitSummary()
+		return
+	}
+
+	connFailed := 0
+	for _, host := range r.ErrorHosts {
+		if IsConnectionError(r.Codes[host]) {
+			connFailed++
+		}
+	}
+	details := make([]string, 0)
+	if len(r.TimeoutHosts) > 0 {
+		details = append(details, fmt.Sprintf("timed out: %d", len(r.TimeoutHosts)))
+	}
+	if connFailed > 0 {
+		details = append(details, fmt.Sprintf("connection failed: %d", connFailed))
+	}
+	if len(r.SkippedHosts) > 0 {
+		details = append(details, fmt.Sprintf("skipped: %d", len(r.SkippedHosts)))
+	}
+	msg := fmt.Sprintf(" Hosts processed: %d, success: %d, error: %d",
 		len(r.SuccessHosts)+len(r.ErrorHosts), len(r.SuccessHosts), len(r.ErrorHosts))
+	if len(details) > 0 {
+		msg += fmt.Sprintf(" (%s)", strings.Join(details, ", "))
+	}
+	msg += "    "
 	h := term.HR(len(msg))
 	fmt.Println(term.Green(h))
 	fmt.Println(term.Green(msg))
 	fmt.Println(term.Green(h))
 }
 
-// PrintOutputMap prints collapsed-style output
+// groupTitle describes the exit code of an output group
+func groupTitle(code int) string {
+	if code >= ErrMacOsExit {
+		// internal codes make no sense to the user
+		return Classify(code).String() + " failure"
+	}
+	return fmt.Sprintf("exit code %d", code)
+}
+
+// printGroupHeader prints the title of an output group
+func printGroupHeader(prefix string, group *OutputGroup) {
+	msg := fmt.Sprintf(" %s%d host(s), %s: %s   ", prefix, len(group.Hosts), groupTitle(group.ExitCode), strings.Join(group.Hosts, ","))
+	tableWidth := len(msg) + 2
+	termWidth := term.GetTerminalWidth()
+	if tableWidth > termWidth {
+		tableWidth = termWidth
+	}
+	fmt.Println(term.Blue(term.HR(tableWidth)))
+	fmt.Println(term.Blue(msg))
+	fmt.Println(term.Blue(term.HR(tableWidth)))
+}
+
+// PrintOutputMap prints collapsed-style output, the largest groups go first
 func (r *ExecResult) PrintOutputMap() {
-	for output, hosts := range r.Outputs {
-		msg := fmt.Sprintf(" %d host(s): %s   ", len(hosts), strings.Join(hosts, ","))
-		tableWidth := len(msg) + 2
-		termWidth := term.GetTerminalWidth()
-		if tableWidth > termWidth {
-			tableWidth = termWidth
-		}
-		fmt.Println(term.Blue(term.HR(tableWidth)))
-		fmt.Println(term.Blue(msg))
-		fmt.Println(term.Blue(term.HR(tableWidth)))
-		fmt.Println(output)
+	if jsonOutput() {
+		r.emitGroups()
+		return
+	}
+	for _, group := range r.Groups() {
+		printGroupHeader("", group)
+		fmt.Println(group.Output)
 	}
 }
 
@@ -90,6 +158,47 @@ func enqueue(local string, remote string, hosts []string) {
 	wg.Wait()
 }
 
+// processParallelMessage prints a message of a parallel execution
+// storing it into the result. Returns true if the host is finished
+func processParallelMessage(r *ExecResult, lines lineBuffers, d *Message) bool {
+	switch d.Type {
+	case MTTaskStarted:
+		r.startHost(d.Hostname)
+	case MTData, MTStderr:
+		log.Debugf("MSG@%s[DATA](%d): %s", d.Hostname, d.StatusCode, string(d.Data))
+		r.addOutput(d.Hostname, d.Data, d.Type == MTStderr)
+		if jsonOutput() {
+			lines.write(d.Hostname, d.Data, d.Type == MTStderr)
+		}
+		if !bytes.HasSuffix(d.Data, []byte{'\n'}) {
+			d.Data = append(d.Data, '\n')
+		}
+		writeHostOutput(d.Hostname, d.Data)
+		if jsonOutput() {
+			break
+		}
+		if currentPrependHostnames {
+			fmt.Printf("%s: ", term.Blue(d.Hostname))
+		}
+		fmt.Print(string(d.Data))
+	case MTDebug:
+		if currentDebug {
+			log.Debugf("DATASTREAM @ %s\n%v\n[%v]", d.Hostname, d.Data, string(d.Data))
+		}
+	case MTCopyFinished:
+		log.Debugf("MSG@%s[COPYFIN](%d): %s", d.Hostname, d.StatusCode, string(d.Data))
+	case MTExecFinished:
+		log.Debugf("MSG@%s[EXECFIN](%d): %s", d.Hostname, d.StatusCode, string(d.Data))
+		r.addResult(d.Hostname, d.StatusCode)
+		if jsonOutput() {
+			lines.flush(d.Hostname)
+			r.emitFinished(d.Hostname)
+		}
+		return true
+	}
+	return false
+}
+
 // RunParallel runs cmd on hosts in parallel mode
 func RunParallel(hosts []string, cmd string) *ExecResult {
 	r := newExecResult()
@@ -105,7 +214,6 @@ func RunParallel(hosts []string, cmd string) *ExecResult {
 	defer os.Remove(local)
 
 	running := len(hosts)
-	copied := 0
 
 	sigs := make(chan os.Signal, 1)
 	signal.Notify(sigs, syscall.SIGINT)
@@ -115,37 +223,11 @@ func RunParallel(hosts []string, cmd string) *ExecResult {
 	defer pool.Close()
 	go enqueue(local, remote, hosts)
 
+	lines := make(lineBuffers)
 	for running > 0 {
 		select {
 		case d := <-pool.Data:
-			switch d.Type {
-			case MTData:
-				log.Debugf("MSG@%s[DATA](%d): %s", d.Hostname, d.StatusCode, string(d.Data))
-				if !bytes.HasSuffix(d.Data, []byte{'\n'}) {
-					d.Data = append(d.Data, '\n')
-				}
-				if currentPrependHostnames {
-					fmt.Printf("%s: ", term.Blue(d.Hostname))
-				}
-				fmt.Print(string(d.Data))
-				writeHostOutput(d.Hostname, d.Data)
-			case MTDebug:
-				if currentDebug {
-					log.Debugf("DATASTREAM @ %s\n%v\n[%v]", d.Hostname, d.Data, string(d.Data))
-				}
-			case MTCopyFinished:
-				log.Debugf("MSG@%s[COPYFIN](%d): %s", d.Hostname, d.StatusCode, string(d.Data))
-				if d.StatusCode == 0 {
-					copied++
-				}
-			case MTExecFinished:
-				log.Debugf("MSG@%s[EXECFIN](%d): %s", d.Hostname, d.StatusCode, string(d.Data))
-				r.Codes[d.Hostname] = d.StatusCode
-				if d.StatusCode == 0 {
-					r.SuccessHosts = append(r.SuccessHosts, d.Hostname)
-				} else {
-					r.ErrorHosts = append(r.ErrorHosts, d.Hostname)
-				}
+			if processParallelMessage(r, lines, d) {
 				running--
 			}
 		case <-sigs:
@@ -174,9 +256,16 @@ func RunCollapse(hosts []string, cmd string) *ExecResult {
 
 	running := len(hosts)
 	copied := 0
-	outputs := make(map[string]string)
 
-	if currentProgressBar {
+	var live *liveView
+	var tick <-chan time.Time
+	if liveEnabled() {
+		// the live view replaces the progressbar
+		live = newLiveView(r, len(hosts))
+		ticker := time.NewTicker(liveRefreshInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	} else if currentProgressBar && !jsonOutput() {
 		bar = pb.StartNew(running)
 	}
 
@@ -188,21 +277,31 @@ func RunCollapse(hosts []string, cmd string) *ExecResult {
 	defer pool.Close()
 	go enqueue(local, remote, hosts)
 
+	lines := make(lineBuffers)
 	for running > 0 {
 		select {
 		case d := <-pool.Data:
 			switch d.Type {
-			case MTData:
+			case MTTaskStarted:
+				r.startHost(d.Hostname)
+			case MTData, MTStderr:
 				if currentDebug {
 					log.Debugf("DATASTREAM @ %s:\n%v\n[%v]\n", d.Hostname, d.Data, string(d.Data))
 				}
-				outputs[d.Hostname] += string(d.Data)
+				r.addOutput(d.Hostname, d.Data, d.Type == MTStderr)
+				if live != nil {
+					live.touch(d.Hostname)
+					live.update()
+				}
 				logData := make([]byte, len(d.Data))
 				copy(logData, d.Data)
 				if !bytes.HasSuffix(d.Data, []byte{'\n'}) {
 					logData = append(d.Data, '\n')
 				}
 				writeHostOutput(d.Hostname, logData)
+				if jsonOutput() {
+					lines.write(d.Hostname, d.Data, d.Type == MTStderr)
+				}
 			case MTDebug:
 				if currentDebug {
 					log.Debugf("DEBUGSTREAM @ %s:\n%v\n[%v]\n", d.Hostname, d.Data, string(d.Data))
@@ -212,36 +311,37 @@ func RunCollapse(hosts []string, cmd string) *ExecResult {
 					copied++
 				}
 			case MTExecFinished:
-				if currentProgressBar {
+				if bar != nil {
 					bar.Increment()
 				}
-				r.Codes[d.Hostname] = d.StatusCode
-				if d.StatusCode == 0 {
-					r.SuccessHosts = append(r.SuccessHosts, d.Hostname)
-				} else {
-					r.ErrorHosts = append(r.ErrorHosts, d.Hostname)
-				}
+				r.addResult(d.Hostname, d.StatusCode)
 				running--
+				if jsonOutput() {
+					lines.flush(d.Hostname)
+					r.emitFinished(d.Hostname)
+				}
+				if live != nil {
+					live.update()
+				}
 			}
+		case <-tick:
+			live.update()
 		case <-sigs:
 			fmt.Println()
 			r.ForceStoppedHosts = pool.ForceStopAllTasks()
 		}
 	}
 
-	if currentProgressBar {
+	if bar != nil {
 		bar.Finish()
 	}
+	if live != nil {
+		live.clear()
+	}
 
-	for host, hostOutput := range outputs {
-		_, found := r.Outputs[hostOutput]
-		if !found {
-			if currentDebug {
-				log.Debugf("Collapse mode found a new output:\n\"%s\"\n%v\n", hostOutput, []byte(hostOutput))
-			}
-			r.Outputs[hostOutput] = make([]string, 0)
-		}
-		r.Outputs[hostOutput] = append(r.Outputs[hostOutput], host)
+	r.groupOutputs()
+	if currentDebug {
+		log.Debugf("Collapse mode found %d output group(s)", len(r.Outputs))
 	}
 
 	return r
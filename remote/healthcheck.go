@@ -0,0 +1,206 @@
+package remote
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/viert/xc/log"
+	"github.com/viert/xc/stringslice"
+	"github.com/viert/xc/term"
+)
+
+// HealthCheck is a command run on every host after the main command
+// in serial and rolling modes, the execution proceeds to the next hosts
+// only when the check passes
+type HealthCheck struct {
+	Cmd string
+	// Local makes the check run on the local machine with
+	// XC_HOST environment variable set to the host being checked
+	Local bool
+	// Timeout is the time in seconds to wait for the check to pass
+	Timeout int
+	// Interval is the pause between attempts in seconds
+	Interval int
+}
+
+var (
+	currentHealthCheck *HealthCheck
+)
+
+// SetHealthCheck sets the health check, nil switches it off
+func SetHealthCheck(hc *HealthCheck) {
+	currentHealthCheck = hc
+}
+
+func (hc *HealthCheck) String() string {
+	where := "remote"
+	if hc.Local {
+		where = "local"
+	}
+	return fmt.Sprintf("%s: %s (timeout %ds, interval %ds)", where, hc.Cmd, hc.Timeout, hc.Interval)
+}
+
+// markFailed turns a successful host into a failed one,
+// i.e. when the command has succeeded but the health check hasn't
+func (r *ExecResult) markFailed(host string, code int) {
+	stringslice.Remove(&r.SuccessHosts, host)
+	end := r.host(host).End
+	r.addResult(host, code)
+	r.host(host).End = end
+}
+
+// checkLocal runs the check locally for every host in parallel
+func (hc *HealthCheck) checkLocal(hosts []string, deadline time.Time) (map[string]int, map[string]string) {
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	codes := make(map[string]int)
+	outputs := make(map[string]string)
+
+	// a hanging check can't outlive the health check timeout
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+
+	for _, host := range hosts {
+		wg.Add(1)
+		go func(host string) {
+			defer wg.Done()
+			cmd := exec.CommandContext(ctx, "bash", "-c", hc.Cmd)
+			cmd.Env = append(os.Environ(), "XC_HOST="+host)
+			out, err := cmd.CombinedOutput()
+			code := 0
+			if err != nil {
+				code = 1
+				if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() > 0 {
+					code = exitErr.ExitCode()
+				}
+			}
+			lock.Lock()
+			codes[host] = code
+			outputs[host] = string(out)
+			lock.Unlock()
+		}(host)
+	}
+	wg.Wait()
+	return codes, outputs
+}
+
+// shellQuote makes a single argument of cmd for the remote shell
+// as the interpreter arguments are joined with spaces by ssh
+func shellQuote(cmd string) string {
+	return "'" + strings.Replace(cmd, "'", `'\''`, -1) + "'"
+}
+
+// checkRemote runs the check on hosts using the current pool, checks
+// still running by the deadline are timed out. Returns false as the last
+// value if stopped by ^C
+func (hc *HealthCheck) checkRemote(hosts []string, deadline time.Time, sigs chan os.Signal) (map[string]int, map[string]string, bool) {
+	codes := make(map[string]int)
+	outputs := make(map[string]string)
+	running := len(hosts)
+	stopped := false
+	go pool.AddTaskHostlist(&Task{Cmd: shellQuote(hc.Cmd), Deadline: deadline}, hosts)
+
+	for running > 0 {
+		select {
+		case d := <-pool.Data:
+			switch d.Type {
+			case MTData, MTStderr:
+				outputs[d.Hostname] += string(d.Data)
+			case MTExecFinished:
+				codes[d.Hostname] = d.StatusCode
+				running--
+			}
+		case <-sigs:
+			fmt.Println()
+			pool.ForceStopAllTasks()
+			stopped = true
+		}
+	}
+	return codes, outputs, !stopped
+}
+
+// run checks hosts until the check passes on all of them or the timeout
+// is over. Returns the hosts the check has failed on and false
+// as the last value if stopped by ^C
+func (hc *HealthCheck) run(hosts []string, sigs chan os.Signal) ([]string, bool) {
+	var (
+		codes   map[string]int
+		outputs map[string]string
+	)
+
+	pending := hosts
+	deadline := time.Now().Add(time.Duration(hc.Timeout) * time.Second)
+	interval := time.Duration(hc.Interval) * time.Second
+	term.Warnf("Running health check on %d host(s): %s\n", len(hosts), hc.Cmd)
+
+	for attempt := 1; ; attempt++ {
+		if hc.Local {
+			codes, outputs = hc.checkLocal(pending, deadline)
+		} else {
+			var ok bool
+			codes, outputs, ok = hc.checkRemote(pending, deadline, sigs)
+			if !ok {
+				return pending, false
+			}
+		}
+
+		failed := make([]string, 0)
+		for _, host := range pending {
+			if codes[host] != 0 {
+				failed = append(failed, host)
+			}
+		}
+		log.Debugf("Health check attempt %d: %d of %d host(s) failed", attempt, len(failed), len(pending))
+		pending = failed
+		if len(pending) == 0 {
+			term.Successf("Health check passed\n")
+			return pending, true
+		}
+
+		if time.Now().Add(interval).After(deadline) {
+			for _, host := range pending {
+				term.Errorf("Health check failed on %s: %s\n", host, strings.TrimSpace(outputs[host]))
+			}
+			return pending, true
+		}
+
+		select {
+		case <-sigs:
+			log.Debugf("Health check interrupted by ^C")
+			return pending, false
+		case <-time.After(interval):
+		}
+	}
+}
+
+// gate runs the health check on hosts the command has succeeded on marking
+// the hosts it has failed on. Returns true if the execution may proceed
+func (hc *HealthCheck) gate(hosts []string, r *ExecResult, sigs chan os.Signal) bool {
+	succeeded := make([]string, 0, len(hosts))
+	for _, host := range hosts {
+		if r.Codes[host] == 0 {
+			succeeded = append(succeeded, host)
+		}
+	}
+	if len(succeeded) == 0 {
+		return true
+	}
+
+	failed, ok := hc.run(succeeded, sigs)
+	if !ok {
+		// the hosts interrupted aren't known to be unhealthy
+		return false
+	}
+	for _, host := range failed {
+		r.markFailed(host, ErrHealthCheckFailed)
+	}
+	if jsonOutput() {
+		emitHealthChecks(succeeded, failed)
+	}
+	return len(failed) == 0
+}
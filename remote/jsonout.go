@@ -0,0 +1,204 @@
+package remote
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/viert/xc/stringslice"
+)
+
+// OutputFormat is the format of execution output
+type OutputFormat int
+
+// Output formats
+const (
+	OFText OutputFormat = iota
+	OFJSON
+)
+
+var (
+	currentOutputFormat OutputFormat
+	jsonEncoder         = newJSONEncoder()
+)
+
+func newJSONEncoder() *json.Encoder {
+	enc := json.NewEncoder(os.Stdout)
+	// outputs are kept readable, i.e. <host> masks aren't escaped
+	enc.SetEscapeHTML(false)
+	return enc
+}
+
+// SetOutputFormat sets the output format. In JSON mode every line of output,
+// every host completion and the final summary is printed as a JSON object
+// on its own line, progressbars and hostname prefixes are omitted
+func SetOutputFormat(format OutputFormat) {
+	currentOutputFormat = format
+}
+
+func jsonOutput() bool {
+	return currentOutputFormat == OFJSON
+}
+
+type outputEvent struct {
+	Type   string `json:"type"`
+	Host   string `json:"host"`
+	Stream string `json:"stream"`
+	Data   string `json:"data"`
+}
+
+type finishedEvent struct {
+	Type     string  `json:"type"`
+	Host     string  `json:"host"`
+	ExitCode int     `json:"exit_code"`
+	Failure  string  `json:"failure"`
+	Duration float64 `json:"duration"`
+}
+
+type healthCheckEvent struct {
+	Type   string `json:"type"`
+	Host   string `json:"host"`
+	Passed bool   `json:"passed"`
+}
+
+type groupEvent struct {
+	Type     string   `json:"type"`
+	Hosts    []string `json:"hosts"`
+	ExitCode int      `json:"exit_code"`
+	Output   string   `json:"output"`
+}
+
+type summaryEvent struct {
+	Type         string   `json:"type"`
+	Total        int      `json:"total"`
+	Success      []string `json:"success"`
+	Error        []string `json:"error"`
+	Timeout      []string `json:"timeout"`
+	Skipped      []string `json:"skipped"`
+	ForceStopped int      `json:"force_stopped"`
+}
+
+func emitJSON(event interface{}) {
+	jsonEncoder.Encode(event)
+}
+
+// emitOutput prints an output event for every line of data
+func emitOutput(host string, data []byte, stderr bool) {
+	stream := "stdout"
+	if stderr {
+		stream = "stderr"
+	}
+	for _, line := range bytes.SplitAfter(data, []byte{'\n'}) {
+		if len(line) == 0 {
+			continue
+		}
+		line = bytes.TrimRight(line, "\r\n")
+		emitJSON(&outputEvent{"output", host, stream, string(line)})
+	}
+}
+
+// lineBuffer emits output events of complete lines only keeping
+// the partial line until the rest of it is written
+type lineBuffer struct {
+	host    string
+	stderr  bool
+	partial []byte
+}
+
+func (lb *lineBuffer) write(data []byte) {
+	lb.partial = append(lb.partial, data...)
+	idx := bytes.LastIndexByte(lb.partial, '\n')
+	if idx < 0 {
+		return
+	}
+	emitOutput(lb.host, lb.partial[:idx+1], lb.stderr)
+	lb.partial = append([]byte{}, lb.partial[idx+1:]...)
+}
+
+// flush emits the partial line left if any
+func (lb *lineBuffer) flush() {
+	if len(lb.partial) > 0 {
+		emitOutput(lb.host, lb.partial, lb.stderr)
+		lb.partial = nil
+	}
+}
+
+type lineBufferKey struct {
+	host   string
+	stderr bool
+}
+
+// lineBuffers keeps a line buffer per host and stream
+// for the executions running hosts simultaneously
+type lineBuffers map[lineBufferKey]*lineBuffer
+
+func (lbs lineBuffers) write(host string, data []byte, stderr bool) {
+	key := lineBufferKey{host, stderr}
+	lb, found := lbs[key]
+	if !found {
+		lb = &lineBuffer{host: host, stderr: stderr}
+		lbs[key] = lb
+	}
+	lb.write(data)
+}
+
+// flush emits the partial lines left of the host
+func (lbs lineBuffers) flush(host string) {
+	for _, stderr := range []bool{false, true} {
+		key := lineBufferKey{host, stderr}
+		if lb, found := lbs[key]; found {
+			lb.flush()
+			delete(lbs, key)
+		}
+	}
+}
+
+// emitFinished prints a host completion event
+func (r *ExecResult) emitFinished(host string) {
+	hr := r.host(host)
+	emitJSON(&finishedEvent{
+		Type:     "finished",
+		Host:     host,
+		ExitCode: hr.ExitCode,
+		Failure:  hr.Failure.String(),
+		Duration: hr.Duration().Round(time.Millisecond).Seconds(),
+	})
+}
+
+// emitHealthChecks prints a health check event for every host checked.
+// In rolling mode the hosts are reported finished before the check
+// so it's the health check event telling if a host has failed it
+func emitHealthChecks(checked []string, failed []string) {
+	for _, host := range checked {
+		emitJSON(&healthCheckEvent{"health_check", host, !stringslice.Contains(failed, host)})
+	}
+}
+
+// emitGroups prints an event for every output group of a collapsed result
+func (r *ExecResult) emitGroups() {
+	for _, group := range r.Groups() {
+		emitJSON(&groupEvent{"group", group.Hosts, group.ExitCode, group.Output})
+	}
+}
+
+func sortedCopy(hosts []string) []string {
+	sorted := make([]string, len(hosts))
+	copy(sorted, hosts)
+	sort.Strings(sorted)
+	return sorted
+}
+
+// emitSummary prints the summary event of the result
+func (r *ExecResult) emitSummary() {
+	emitJSON(&summaryEvent{
+		Type:         "summary",
+		Total:        len(r.Codes) + len(r.SkippedHosts),
+		Success:      sortedCopy(r.SuccessHosts),
+		Error:        sortedCopy(r.ErrorHosts),
+		Timeout:      sortedCopy(r.TimeoutHosts),
+		Skipped:      sortedCopy(r.SkippedHosts),
+		ForceStopped: r.ForceStoppedHosts,
+	})
+}
@@ -0,0 +1,158 @@
+package remote
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func captureJSON(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	saved := jsonEncoder
+	jsonEncoder = json.NewEncoder(&buf)
+	t.Cleanup(func() { jsonEncoder = saved })
+	return &buf
+}
+
+func outputEvents(t *testing.T, buf *bytes.Buffer) []string {
+	lines := make([]string, 0)
+	dec := json.NewDecoder(buf)
+	for dec.More() {
+		var ev outputEvent
+		if err := dec.Decode(&ev); err != nil {
+			t.Fatalf("error decoding event: %s", err)
+		}
+		lines = append(lines, ev.Stream+":"+ev.Data)
+	}
+	return lines
+}
+
+func TestLineBuffer(t *testing.T) {
+	tests := []struct {
+		name   string
+		chunks []string
+		lines  []string
+	}{
+		{"empty", []string{}, []string{}},
+		{"whole lines", []string{"one\ntwo\n"}, []string{"stdout:one", "stdout:two"}},
+		{"split line", []string{"on", "e\ntw", "o\r\n"}, []string{"stdout:one", "stdout:two"}},
+		{"partial line flushed", []string{"one\n", "prompt$ "}, []string{"stdout:one", "stdout:prompt$ "}},
+		{"empty lines", []string{"\n", "\n"}, []string{"stdout:", "stdout:"}},
+	}
+	for _, tt := range tests {
+		buf := captureJSON(t)
+		lb := &lineBuffer{host: "host1"}
+		for _, chunk := range tt.chunks {
+			lb.write([]byte(chunk))
+		}
+		lb.flush()
+		lines := outputEvents(t, buf)
+		if !reflect.DeepEqual(lines, tt.lines) {
+			t.Errorf("%s: events are %q, expected %q", tt.name, lines, tt.lines)
+		}
+	}
+}
+
+func TestLineBufferHoldsPartialLine(t *testing.T) {
+	buf := captureJSON(t)
+	lb := &lineBuffer{host: "host1", stderr: true}
+	lb.write([]byte("first\nsec"))
+	if lines := outputEvents(t, buf); !reflect.DeepEqual(lines, []string{"stderr:first"}) {
+		t.Errorf("events before flush are %q, expected the complete line only", lines)
+	}
+	lb.write([]byte("ond"))
+	lb.flush()
+	if lines := outputEvents(t, buf); !reflect.DeepEqual(lines, []string{"stderr:second"}) {
+		t.Errorf("events after flush are %q, expected the rest of the line", lines)
+	}
+}
+
+func TestParallelMessageLines(t *testing.T) {
+	buf := captureJSON(t)
+	SetOutputFormat(OFJSON)
+	defer SetOutputFormat(OFText)
+
+	messages := []*Message{
+		{Type: MTTaskStarted, Hostname: "h1"},
+		{Type: MTTaskStarted, Hostname: "h2"},
+		{Type: MTData, Hostname: "h1", Data: []byte("hel")},
+		{Type: MTData, Hostname: "h2", Data: []byte("second host\n")},
+		{Type: MTStderr, Hostname: "h1", Data: []byte("warn")},
+		{Type: MTData, Hostname: "h1", Data: []byte("lo\npartial")},
+		{Type: MTStderr, Hostname: "h1", Data: []byte("ing\n")},
+		{Type: MTExecFinished, Hostname: "h1", StatusCode: 0},
+		{Type: MTExecFinished, Hostname: "h2", StatusCode: 1},
+	}
+	r := newExecResult()
+	lines := make(lineBuffers)
+	for _, msg := range messages {
+		processParallelMessage(r, lines, msg)
+	}
+
+	events := make([]string, 0)
+	dec := json.NewDecoder(buf)
+	for dec.More() {
+		var ev outputEvent
+		if err := dec.Decode(&ev); err != nil {
+			t.Fatalf("error decoding event: %s", err)
+		}
+		if ev.Type == "output" {
+			events = append(events, ev.Host+" "+ev.Stream+":"+ev.Data)
+		} else {
+			events = append(events, ev.Host+" "+ev.Type)
+		}
+	}
+	expected := []string{
+		"h2 stdout:second host",
+		"h1 stdout:hello",
+		"h1 stderr:warning",
+		"h1 stdout:partial",
+		"h1 finished",
+		"h2 finished",
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("events are %q, expected %q", events, expected)
+	}
+	if out := r.Hosts["h1"].Stdout; out != "hello\npartial" {
+		t.Errorf("h1 stdout is %q, expected %q", out, "hello\npartial")
+	}
+}
+
+func TestGateHealthCheckEvents(t *testing.T) {
+	buf := captureJSON(t)
+	SetOutputFormat(OFJSON)
+	defer SetOutputFormat(OFText)
+
+	r := newExecResult()
+	for host, code := range map[string]int{"h1": 0, "h2": 0, "h3": 1} {
+		r.startHost(host)
+		r.addResult(host, code)
+	}
+	hc := &HealthCheck{Cmd: `test "$XC_HOST" != h2`, Local: true, Timeout: 1, Interval: 1}
+	if hc.gate([]string{"h1", "h2", "h3"}, r, make(chan os.Signal)) {
+		t.Errorf("health check has passed")
+	}
+
+	events := make([]healthCheckEvent, 0)
+	dec := json.NewDecoder(buf)
+	for dec.More() {
+		var ev healthCheckEvent
+		if err := dec.Decode(&ev); err != nil {
+			t.Fatalf("error decoding event: %s", err)
+		}
+		events = append(events, ev)
+	}
+	// the hosts the command has failed on aren't checked
+	expected := []healthCheckEvent{
+		{"health_check", "h1", true},
+		{"health_check", "h2", false},
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("events are %+v, expected %+v", events, expected)
+	}
+	if fc := r.Hosts["h2"].Failure; fc != FCHealthCheck {
+		t.Errorf("h2 failure is %s, expected %s", fc, FCHealthCheck)
+	}
+}
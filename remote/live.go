@@ -0,0 +1,211 @@
+package remote
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/viert/xc/term"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+const (
+	liveRefreshInterval = 200 * time.Millisecond
+	liveMaxGroups       = 10
+	liveSlowestHosts    = 3
+)
+
+var (
+	currentLiveCollapse bool
+)
+
+// SetLiveCollapse sets the live view of collapse mode on/off
+func SetLiveCollapse(live bool) {
+	currentLiveCollapse = live
+}
+
+// liveEnabled returns true if the live view may be drawn,
+// i.e. it's on, the output is text and stdout is a terminal
+func liveEnabled() bool {
+	return currentLiveCollapse && !jsonOutput() && terminal.IsTerminal(int(os.Stdout.Fd()))
+}
+
+// liveView is an incrementally updated view of a running collapse execution
+// showing output groups with the number of hosts and the slowest hosts
+type liveView struct {
+	r          *ExecResult
+	total      int
+	started    time.Time
+	normalized map[string]string
+	dirty      map[string]bool
+	lines      int
+	drawn      time.Time
+}
+
+type liveGroup struct {
+	output   string
+	running  bool
+	exitCode int
+	count    int
+}
+
+func newLiveView(r *ExecResult, total int) *liveView {
+	return &liveView{
+		r:          r,
+		total:      total,
+		started:    time.Now(),
+		normalized: make(map[string]string),
+		dirty:      make(map[string]bool),
+	}
+}
+
+// touch marks the host output changed
+func (lv *liveView) touch(host string) {
+	lv.dirty[host] = true
+}
+
+// firstLine returns the first non-empty line of output
+// along with the number of lines left
+func firstLine(output string) (string, int) {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	line := strings.Map(func(r rune) rune {
+		switch r {
+		case '\t':
+			return ' '
+		case '\r':
+			return -1
+		}
+		return r
+	}, lines[0])
+	return strings.TrimSpace(line), len(lines) - 1
+}
+
+// groups returns the current output groups of hosts, running hosts
+// are grouped separately from the finished ones
+func (lv *liveView) groups() []*liveGroup {
+	index := make(map[liveGroup]*liveGroup)
+	groups := make([]*liveGroup, 0)
+
+	for host, hr := range lv.r.Hosts {
+		if lv.dirty[host] {
+			lv.normalized[host] = currentCollapseOptions.normalize(host, hr.Output())
+			delete(lv.dirty, host)
+		}
+		code, finished := lv.r.Codes[host]
+		key := liveGroup{output: lv.normalized[host], running: !finished, exitCode: code}
+		if lg, found := index[key]; found {
+			lg.count++
+			continue
+		}
+		lg := key
+		lg.count = 1
+		index[key] = &lg
+		groups = append(groups, &lg)
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].count != groups[j].count {
+			return groups[i].count > groups[j].count
+		}
+		return groups[i].output < groups[j].output
+	})
+	return groups
+}
+
+// slowest returns the hosts running for the longest time
+func (lv *liveView) slowest() []*HostResult {
+	running := make([]*HostResult, 0)
+	for host, hr := range lv.r.Hosts {
+		if _, finished := lv.r.Codes[host]; !finished && !hr.Start.IsZero() {
+			running = append(running, hr)
+		}
+	}
+	sort.Slice(running, func(i, j int) bool { return running[i].Start.Before(running[j].Start) })
+	if len(running) > liveSlowestHosts {
+		running = running[:liveSlowestHosts]
+	}
+	return running
+}
+
+func (lv *liveView) render() []string {
+	width := term.GetTerminalWidth()
+	cut := func(line string) string {
+		// the last column is left empty to avoid wrapping
+		runes := []rune(line)
+		if width > 1 && len(runes) > width-1 {
+			return string(runes[:width-1])
+		}
+		return line
+	}
+
+	finished := len(lv.r.Codes)
+	running := 0
+	for host := range lv.r.Hosts {
+		if _, found := lv.r.Codes[host]; !found {
+			running++
+		}
+	}
+	lines := []string{
+		term.Blue(cut(fmt.Sprintf(" Running: %d, finished: %d/%d, failed: %d, elapsed: %s",
+			running, finished, lv.total, len(lv.r.ErrorHosts), time.Since(lv.started).Round(time.Second)))),
+	}
+
+	groups := lv.groups()
+	for i, lg := range groups {
+		if i == liveMaxGroups {
+			lines = append(lines, cut(fmt.Sprintf(" ... %d more group(s)", len(groups)-liveMaxGroups)))
+			break
+		}
+		status := "running"
+		if !lg.running {
+			status = groupTitle(lg.exitCode)
+		}
+		line, more := firstLine(lg.output)
+		if more > 0 {
+			line += fmt.Sprintf(" (+%d lines)", more)
+		}
+		text := cut(fmt.Sprintf(" %5d host(s), %s: %s", lg.count, status, line))
+		switch {
+		case lg.running:
+			text = term.Yellow(text)
+		case lg.exitCode != 0:
+			text = term.Red(text)
+		}
+		lines = append(lines, text)
+	}
+
+	slowest := lv.slowest()
+	if len(slowest) > 0 {
+		items := make([]string, len(slowest))
+		for i, hr := range slowest {
+			items[i] = fmt.Sprintf("%s (%s)", hr.Host, time.Since(hr.Start).Round(time.Second))
+		}
+		lines = append(lines, cut(" Slowest: "+strings.Join(items, ", ")))
+	}
+	return lines
+}
+
+// update redraws the view, the redraws are throttled
+func (lv *liveView) update() {
+	if time.Since(lv.drawn) < liveRefreshInterval {
+		return
+	}
+	lv.clear()
+	lines := lv.render()
+	for _, line := range lines {
+		fmt.Println(line)
+	}
+	lv.lines = len(lines)
+	lv.drawn = time.Now()
+}
+
+// clear erases the view drawn previously
+func (lv *liveView) clear() {
+	if lv.lines > 0 {
+		// move the cursor up and erase to the end of the screen
+		fmt.Printf("\033[%dA\033[J", lv.lines)
+		lv.lines = 0
+	}
+}
@@ -0,0 +1,176 @@
+package remote
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFirstLine(t *testing.T) {
+	tests := []struct {
+		output   string
+		expected string
+		more     int
+	}{
+		{"", "", 0},
+		{"single", "single", 0},
+		{"single\n", "single", 0},
+		{"one\ntwo\nthree\n", "one", 2},
+		// leading empty lines and whitespace are skipped
+		{"\n\n  first \nsecond", "first", 1},
+		{"tab\tseparated\r\n", "tab separated", 0},
+		{"win\r\nlines\r\n", "win", 1},
+		{"one\n\n\ntwo", "one", 3},
+	}
+	for _, tt := range tests {
+		line, more := firstLine(tt.output)
+		if line != tt.expected || more != tt.more {
+			t.Errorf("firstLine(%q) = %q, %d, expected %q, %d", tt.output, line, more, tt.expected, tt.more)
+		}
+	}
+}
+
+// liveTestResult returns a result of hosts with outputs given,
+// the hosts with negative codes are still running
+func liveTestResult(outputs map[string]string, codes map[string]int) *ExecResult {
+	r := newExecResult()
+	for host, output := range outputs {
+		r.startHost(host)
+		r.addOutput(host, []byte(output), false)
+		if code := codes[host]; code >= 0 {
+			r.addResult(host, code)
+		}
+	}
+	return r
+}
+
+func TestLiveGroups(t *testing.T) {
+	saved := currentCollapseOptions
+	defer SetCollapseOptions(saved)
+	SetCollapseOptions(CollapseOptions{TrimWhitespace: true})
+
+	r := liveTestResult(
+		map[string]string{
+			"h1": "ok\n", "h2": "ok  \n", "h3": "ok\n", "h4": "other\n",
+			"h5": "fail\n", "h6": "fail\n", "h7": "ok\n", "h8": "b\n", "h9": "a\n",
+		},
+		map[string]int{
+			"h1": 0, "h2": 0, "h3": 0, "h4": 1,
+			"h5": 1, "h6": 1, "h7": -1, "h8": 0, "h9": 0,
+		},
+	)
+	lv := newLiveView(r, 10)
+	for host := range r.Hosts {
+		lv.touch(host)
+	}
+
+	// by size, then by output
+	expected := []liveGroup{
+		{"ok", false, 0, 3},
+		{"fail", false, 1, 2},
+		{"a", false, 0, 1},
+		{"b", false, 0, 1},
+		{"ok", true, 0, 1},
+		{"other", false, 1, 1},
+	}
+	check := func(stage string) {
+		groups := make([]liveGroup, 0)
+		for _, lg := range lv.groups() {
+			groups = append(groups, *lg)
+		}
+		if !reflect.DeepEqual(groups, expected) {
+			t.Errorf("%s: groups are %+v, expected %+v", stage, groups, expected)
+		}
+	}
+	check("initial")
+	if len(lv.dirty) != 0 {
+		t.Errorf("%d host(s) are left dirty", len(lv.dirty))
+	}
+
+	// outputs are normalized again only when touched
+	r.addOutput("h7", []byte("more\n"), false)
+	check("untouched")
+
+	lv.touch("h7")
+	r.addResult("h7", 0)
+	expected = []liveGroup{
+		{"ok", false, 0, 3},
+		{"fail", false, 1, 2},
+		{"a", false, 0, 1},
+		{"b", false, 0, 1},
+		{"ok\nmore", false, 0, 1},
+		{"other", false, 1, 1},
+	}
+	check("touched")
+}
+
+func TestLiveSlowest(t *testing.T) {
+	r := newExecResult()
+	now := time.Now()
+	for i, host := range []string{"h1", "h2", "h3", "h4", "h5", "h6"} {
+		r.startHost(host)
+		r.Hosts[host].Start = now.Add(-time.Duration(i) * time.Second)
+	}
+	r.addResult("h6", 0)
+	// the host queued but not started yet
+	r.addOutput("h7", []byte("queued"), false)
+
+	lv := newLiveView(r, 7)
+	hosts := make([]string, 0)
+	for _, hr := range lv.slowest() {
+		hosts = append(hosts, hr.Host)
+	}
+	expected := []string{"h5", "h4", "h3"}
+	if !reflect.DeepEqual(hosts, expected) {
+		t.Errorf("slowest hosts are %v, expected %v", hosts, expected)
+	}
+
+	if slowest := newLiveView(newExecResult(), 0).slowest(); len(slowest) != 0 {
+		t.Errorf("empty result has %d slowest host(s)", len(slowest))
+	}
+}
+
+func TestLiveRenderGroupsLimit(t *testing.T) {
+	saved := currentCollapseOptions
+	defer SetCollapseOptions(saved)
+	SetCollapseOptions(CollapseOptions{})
+
+	tests := []struct {
+		groups int
+		lines  int
+		more   string
+	}{
+		{1, 2, ""},
+		{liveMaxGroups, liveMaxGroups + 1, ""},
+		{liveMaxGroups + 1, liveMaxGroups + 2, " ... 1 more group(s)"},
+		{liveMaxGroups + 5, liveMaxGroups + 2, " ... 5 more group(s)"},
+	}
+	for _, tt := range tests {
+		outputs := make(map[string]string)
+		codes := make(map[string]int)
+		for i := 0; i < tt.groups; i++ {
+			host := fmt.Sprintf("h%d", i)
+			outputs[host] = fmt.Sprintf("line %d\nsecond\n", i)
+			codes[host] = 0
+		}
+		lv := newLiveView(liveTestResult(outputs, codes), tt.groups)
+		for host := range outputs {
+			lv.touch(host)
+		}
+
+		lines := lv.render()
+		// the header, the groups and no slowest hosts as none is running
+		if len(lines) != tt.lines {
+			t.Errorf("%d group(s) are rendered in %d lines, expected %d", tt.groups, len(lines), tt.lines)
+			continue
+		}
+		if !strings.Contains(lines[1], "1 host(s), exit code 0: line ") || !strings.HasSuffix(lines[1], " (+1 lines)") {
+			t.Errorf("unexpected group line %q", lines[1])
+		}
+		if tt.more != "" && lines[len(lines)-1] != tt.more {
+			t.Errorf("the last line is %q, expected %q", lines[len(lines)-1], tt.more)
+		}
+	}
+}
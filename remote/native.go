@@ -0,0 +1,470 @@
+package remote
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/viert/xc/config"
+	"github.com/viert/xc/log"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// TransportType enum
+type TransportType int
+
+// Transport types
+const (
+	TTExternal TransportType = iota
+	TTNative
+)
+
+const (
+	defaultSSHPort   = 22
+	maxJumpDepth     = 5
+	keepaliveRequest = "keepalive@openssh.com"
+)
+
+var (
+	currentTransport TransportType
+
+	defaultIdentityFiles = []string{"~/.ssh/id_ed25519", "~/.ssh/id_ecdsa", "~/.ssh/id_rsa"}
+	identitySigners      []ssh.Signer
+	identityOnce         sync.Once
+
+	knownHostsLock     sync.Mutex
+	knownHostsCallback ssh.HostKeyCallback
+
+	// hostKeyTypes are the supported host key types in the order of preference
+	hostKeyTypes = []string{
+		ssh.KeyAlgoED25519,
+		ssh.KeyAlgoECDSA521, ssh.KeyAlgoECDSA384, ssh.KeyAlgoECDSA256,
+		ssh.KeyAlgoRSA, ssh.KeyAlgoDSA,
+	}
+	// probeHostKey is the key known host keys are looked up with
+	probeHostKey, _ = ssh.NewPublicKey(ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize)).Public())
+)
+
+// SetTransport sets the transport used for parallel execution and copying
+func SetTransport(transport TransportType) {
+	currentTransport = transport
+}
+
+// connError is an error of establishing a connection
+// along with the error code classifying it
+type connError struct {
+	code int
+	err  error
+}
+
+func (e *connError) Error() string {
+	return e.err.Error()
+}
+
+// IsConnectionError returns true if the code means the host
+// couldn't be reached rather than the command failed on it
+func IsConnectionError(code int) bool {
+	return code == ErrConnectionFailed || code == ErrHostKeyFailed || code == ErrSSHAuthFailed
+}
+
+// nativeConn is an established in-process ssh connection,
+// jump is the connection to the jump host if any
+type nativeConn struct {
+	client *ssh.Client
+	jump   *nativeConn
+	done   chan struct{}
+	once   sync.Once
+	cached bool
+}
+
+// Close closes the connection along with the jump host connection
+func (nc *nativeConn) Close() error {
+	var err error
+	nc.once.Do(func() {
+		close(nc.done)
+		err = nc.client.Close()
+		if nc.jump != nil {
+			nc.jump.Close()
+		}
+	})
+	return err
+}
+
+// release closes the connection unless it's kept in the connection cache
+func (nc *nativeConn) release() {
+	if !nc.cached {
+		nc.Close()
+	}
+}
+
+// keepalive sends keepalive requests every interval and closes
+// the connection if countMax requests in a row are left unanswered
+func (nc *nativeConn) keepalive(interval time.Duration, countMax int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	missed := 0
+	for {
+		select {
+		case <-nc.done:
+			return
+		case <-ticker.C:
+			res := make(chan error, 1)
+			go func() {
+				_, _, err := nc.client.SendRequest(keepaliveRequest, true, nil)
+				res <- err
+			}()
+			select {
+			case err := <-res:
+				if err != nil {
+					missed++
+				} else {
+					missed = 0
+				}
+			case <-time.After(interval):
+				missed++
+			case <-nc.done:
+				return
+			}
+			if missed >= countMax {
+				log.Debugf("no keepalive response from %s, closing connection", nc.client.RemoteAddr())
+				nc.Close()
+				return
+			}
+		}
+	}
+}
+
+func sshOptionInt(name string, dflt int) int {
+	value, err := strconv.Atoi(sshOptions[name])
+	if err != nil {
+		return dflt
+	}
+	return value
+}
+
+func sshOptionBool(name string, dflt bool) bool {
+	switch strings.ToLower(sshOptions[name]) {
+	case "yes", "true", "on":
+		return true
+	case "no", "false", "off":
+		return false
+	default:
+		return dflt
+	}
+}
+
+// identityFiles returns the configured IdentityFile or the default ones
+func identityFiles() []string {
+	if files, found := sshOptions["IdentityFile"]; found {
+		return strings.Fields(files)
+	}
+	return defaultIdentityFiles
+}
+
+// loadIdentities reads unencrypted private keys once, encrypted
+// keys are expected to be available via ssh-agent
+func loadIdentities() []ssh.Signer {
+	identityOnce.Do(func() {
+		identitySigners = make([]ssh.Signer, 0)
+		for _, filename := range identityFiles() {
+			filename = config.ExpandPath(filename)
+			data, err := ioutil.ReadFile(filename)
+			if err != nil {
+				continue
+			}
+			signer, err := ssh.ParsePrivateKey(data)
+			if err != nil {
+				log.Debugf("skipping identity %s: %s", filename, err)
+				continue
+			}
+			identitySigners = append(identitySigners, signer)
+		}
+	})
+	return identitySigners
+}
+
+// authMethods returns auth methods to use, the agent connection
+// must be kept open until the handshake is finished
+func authMethods(agentConn net.Conn) []ssh.AuthMethod {
+	methods := make([]ssh.AuthMethod, 0)
+	if !sshOptionBool("PubkeyAuthentication", true) {
+		return methods
+	}
+	if agentConn != nil {
+		methods = append(methods, ssh.PublicKeysCallback(agent.NewClient(agentConn).Signers))
+	}
+	if signers := loadIdentities(); len(signers) > 0 {
+		methods = append(methods, ssh.PublicKeys(signers...))
+	}
+	return methods
+}
+
+func knownHostsFiles() []string {
+	files, found := sshOptions["UserKnownHostsFile"]
+	if !found {
+		files = "~/.ssh/known_hosts"
+	}
+	result := make([]string, 0)
+	for _, filename := range strings.Fields(files) {
+		result = append(result, config.ExpandPath(filename))
+	}
+	return result
+}
+
+// loadKnownHosts returns the cached known_hosts callback reading
+// the files on the first call. Missing files are skipped
+func loadKnownHosts() (ssh.HostKeyCallback, error) {
+	if knownHostsCallback != nil {
+		return knownHostsCallback, nil
+	}
+	files := make([]string, 0)
+	for _, filename := range knownHostsFiles() {
+		if _, err := os.Stat(filename); err == nil {
+			files = append(files, filename)
+		}
+	}
+	cb, err := knownhosts.New(files...)
+	if err != nil {
+		return nil, err
+	}
+	knownHostsCallback = cb
+	return cb, nil
+}
+
+// addKnownHost appends a new host key to the first known_hosts file
+func addKnownHost(hostname string, remote net.Addr, key ssh.PublicKey) error {
+	files := knownHostsFiles()
+	if len(files) == 0 {
+		return fmt.Errorf("no known_hosts file configured")
+	}
+	f, err := os.OpenFile(files[0], os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	line := knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key)
+	_, err = fmt.Fprintln(f, line)
+	if err != nil {
+		return err
+	}
+	// the file is to be re-read to keep the accepted key
+	knownHostsCallback = nil
+	return nil
+}
+
+// hostKeyCallback verifies host keys according to StrictHostKeyChecking:
+// "no" accepts any key, "accept-new" adds unknown keys to known_hosts
+// and any other value requires the key to be known
+func hostKeyCallback(failed *bool) ssh.HostKeyCallback {
+	mode := strings.ToLower(sshOptions["StrictHostKeyChecking"])
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if mode == "no" || mode == "off" {
+			return nil
+		}
+
+		knownHostsLock.Lock()
+		defer knownHostsLock.Unlock()
+
+		cb, err := loadKnownHosts()
+		if err == nil {
+			err = cb(hostname, remote, key)
+			var keyErr *knownhosts.KeyError
+			if errors.As(err, &keyErr) && len(keyErr.Want) == 0 && mode == "accept-new" {
+				err = addKnownHost(hostname, remote, key)
+			}
+		}
+		if err != nil {
+			*failed = true
+		}
+		return err
+	}
+}
+
+// knownHostKeyAlgorithms returns the host key algorithms of the keys
+// known_hosts holds for the host, most preferred first. Unless the host
+// key algorithms are limited this way the server may present a key type
+// which isn't known even though the host is. Nil is returned if the host
+// is unknown or host keys aren't checked at all
+func knownHostKeyAlgorithms(hostname string, remote net.Addr) []string {
+	mode := strings.ToLower(sshOptions["StrictHostKeyChecking"])
+	if mode == "no" || mode == "off" {
+		return nil
+	}
+
+	knownHostsLock.Lock()
+	defer knownHostsLock.Unlock()
+
+	cb, err := loadKnownHosts()
+	if err != nil {
+		return nil
+	}
+	// the known keys are reported in the mismatch error for a key
+	// the host can't possibly have
+	var keyErr *knownhosts.KeyError
+	if err = cb(hostname, remote, probeHostKey); !errors.As(err, &keyErr) {
+		return nil
+	}
+
+	known := make(map[string]bool)
+	for _, k := range keyErr.Want {
+		known[k.Key.Type()] = true
+	}
+	algos := make([]string, 0)
+	for _, keyType := range hostKeyTypes {
+		if !known[keyType] {
+			continue
+		}
+		if keyType == ssh.KeyAlgoRSA {
+			algos = append(algos, ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256)
+		}
+		algos = append(algos, keyType)
+	}
+	if len(algos) == 0 {
+		return nil
+	}
+	return algos
+}
+
+// parseJumpHost parses ProxyJump-like [user@]host[:port] expression
+func parseJumpHost(jump string) *HostParams {
+	user := ""
+	if idx := strings.LastIndex(jump, "@"); idx >= 0 {
+		user = jump[:idx]
+		jump = jump[idx+1:]
+	}
+	host, port := jump, 0
+	if h, p, err := net.SplitHostPort(jump); err == nil {
+		host = h
+		port, _ = strconv.Atoi(p)
+	}
+
+	hp := resolveHost(host)
+	if user != "" {
+		hp.User = user
+	}
+	if port > 0 {
+		hp.Port = port
+	}
+	return hp
+}
+
+// dialNative establishes a connection to the host, classifying
+// failures with connError
+func dialNative(host string) (*nativeConn, error) {
+	return dialParams(resolveHost(host), 0)
+}
+
+func dialParams(hp *HostParams, depth int) (*nativeConn, error) {
+	var (
+		jump *nativeConn
+		conn net.Conn
+		err  error
+	)
+
+	port := hp.Port
+	if port == 0 {
+		port = defaultSSHPort
+	}
+	addr := net.JoinHostPort(hp.Address, strconv.Itoa(port))
+	timeout := time.Duration(sshOptionInt("ConnectTimeout", 10)) * time.Second
+
+	if hp.JumpHost != "" {
+		if depth >= maxJumpDepth {
+			return nil, &connError{ErrConnectionFailed, fmt.Errorf("too many jump hosts connecting to %s", addr)}
+		}
+		jump, err = dialParams(parseJumpHost(hp.JumpHost), depth+1)
+		if err != nil {
+			return nil, err
+		}
+		conn, err = jump.client.Dial("tcp", addr)
+	} else {
+		conn, err = net.DialTimeout("tcp", addr, timeout)
+	}
+	if err != nil {
+		if jump != nil {
+			jump.Close()
+		}
+		return nil, &connError{ErrConnectionFailed, err}
+	}
+
+	var agentConn net.Conn
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		agentConn, err = net.Dial("unix", sock)
+		if err != nil {
+			log.Debugf("error connecting to ssh-agent: %s", err)
+			agentConn = nil
+		} else {
+			defer agentConn.Close()
+		}
+	}
+
+	hostKeyFailed := false
+	cfg := &ssh.ClientConfig{
+		User:              hp.User,
+		Auth:              authMethods(agentConn),
+		HostKeyCallback:   hostKeyCallback(&hostKeyFailed),
+		HostKeyAlgorithms: knownHostKeyAlgorithms(addr, conn.RemoteAddr()),
+		Timeout:           timeout,
+	}
+
+	// the handshake is limited by the connect timeout as well,
+	// closing the connection interrupts it
+	timer := time.AfterFunc(timeout, func() { conn.Close() })
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, cfg)
+	if !timer.Stop() && err != nil {
+		err = fmt.Errorf("ssh handshake with %s timed out", addr)
+	}
+	if err != nil {
+		conn.Close()
+		if jump != nil {
+			jump.Close()
+		}
+		return nil, &connError{handshakeErrorCode(err, hostKeyFailed), err}
+	}
+
+	nc := &nativeConn{
+		client: ssh.NewClient(c, chans, reqs),
+		jump:   jump,
+		done:   make(chan struct{}),
+	}
+	// the connection is marked closed as soon as it's lost
+	go func() {
+		nc.client.Wait()
+		nc.Close()
+	}()
+	if interval := sshOptionInt("ServerAliveInterval", 0); interval > 0 {
+		go nc.keepalive(time.Duration(interval)*time.Second, sshOptionInt("ServerAliveCountMax", 3))
+	}
+	return nc, nil
+}
+
+// handshakeErrorCode classifies an ssh handshake error
+func handshakeErrorCode(err error, hostKeyFailed bool) int {
+	if hostKeyFailed {
+		return ErrHostKeyFailed
+	}
+	// x/crypto/ssh doesn't provide a typed error for auth failures
+	if strings.Contains(err.Error(), "unable to authenticate") {
+		return ErrSSHAuthFailed
+	}
+	return ErrConnectionFailed
+}
+
+// nativeCommand makes the remote command line the same way
+// ssh does joining the arguments with spaces
+func nativeCommand(argv string) string {
+	params := getInterpreter()
+	if argv != "" {
+		params = append(params, "-c", argv)
+	}
+	return strings.Join(params, " ")
+}
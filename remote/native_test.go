@@ -0,0 +1,430 @@
+package remote
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func acks(n int) *bufio.Reader {
+	return bufio.NewReader(bytes.NewReader(make([]byte, n)))
+}
+
+func TestScpAck(t *testing.T) {
+	tests := []struct {
+		input string
+		err   error
+	}{
+		{"\x00", nil},
+		{"\x01scp: /nonexistent: No such file or directory\n", scpError("scp: /nonexistent: No such file or directory")},
+		{"\x02scp: fatal error\n", scpError("scp: fatal error")},
+		{"", io.EOF},
+	}
+	for _, tt := range tests {
+		err := scpAck(bufio.NewReader(strings.NewReader(tt.input)))
+		if err != tt.err {
+			t.Errorf("scpAck(%q) = %v, expected %v", tt.input, err, tt.err)
+		}
+	}
+}
+
+func TestScpSendFile(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "file.txt")
+	if err := ioutil.WriteFile(filename, []byte("hello\n"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	st, _ := os.Stat(filename)
+
+	var sink bytes.Buffer
+	err := scpSend(&sink, acks(3), filename, st)
+	if err != nil {
+		t.Fatalf("scpSend: %s", err)
+	}
+	expected := "C0640 6 file.txt\nhello\n\x00"
+	if sink.String() != expected {
+		t.Errorf("scp stream is %q, expected %q", sink.String(), expected)
+	}
+}
+
+func TestScpSendDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "dir")
+	if err := os.MkdirAll(filepath.Join(dir, "sub"), 0750); err != nil {
+		t.Fatal(err)
+	}
+	os.Chmod(dir, 0755)
+	os.Chmod(filepath.Join(dir, "sub"), 0750)
+	ioutil.WriteFile(filepath.Join(dir, "a"), []byte("a"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "sub", "b"), []byte("bb"), 0600)
+	st, _ := os.Stat(dir)
+
+	var sink bytes.Buffer
+	err := scpSend(&sink, acks(100), dir, st)
+	if err != nil {
+		t.Fatalf("scpSend: %s", err)
+	}
+	expected := "D0755 0 dir\n" +
+		"C0644 1 a\na\x00" +
+		"D0750 0 sub\n" +
+		"C0600 2 b\nbb\x00" +
+		"E\n" +
+		"E\n"
+	if sink.String() != expected {
+		t.Errorf("scp stream is %q, expected %q", sink.String(), expected)
+	}
+}
+
+func TestScpSendError(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "file")
+	ioutil.WriteFile(filename, []byte("data"), 0644)
+	st, _ := os.Stat(filename)
+
+	// the sink refuses the file after the initial ack
+	var sink bytes.Buffer
+	r := bufio.NewReader(strings.NewReader("\x00\x01scp: /dst: Permission denied\n"))
+	err := scpSend(&sink, r, filename, st)
+	if err != scpError("scp: /dst: Permission denied") {
+		t.Errorf("scpSend returned %v, expected the scp error", err)
+	}
+	if strings.Contains(sink.String(), "data") {
+		t.Errorf("file data is sent after the sink error: %q", sink.String())
+	}
+}
+
+func TestTarAddFile(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "root")
+	os.Mkdir(root, 0755)
+	ioutil.WriteFile(filepath.Join(root, "file"), []byte("content"), 0644)
+	os.Symlink("file", filepath.Join(root, "link"))
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		return tarAddFile(tw, path, info)
+	})
+	if err != nil {
+		t.Fatalf("tarAddFile: %s", err)
+	}
+	tw.Close()
+
+	name := strings.TrimLeft(filepath.ToSlash(root), "/")
+	expected := []struct {
+		name     string
+		typeflag byte
+		link     string
+		data     string
+	}{
+		{name + "/", tar.TypeDir, "", ""},
+		{name + "/file", tar.TypeReg, "", "content"},
+		{name + "/link", tar.TypeSymlink, "file", ""},
+	}
+
+	tr := tar.NewReader(&buf)
+	for _, exp := range expected {
+		hdr, err := tr.Next()
+		if err != nil {
+			t.Fatalf("error reading %s header: %s", exp.name, err)
+		}
+		if hdr.Name != exp.name || hdr.Typeflag != exp.typeflag || hdr.Linkname != exp.link {
+			t.Errorf("header is %s (type %c, link %q), expected %s (type %c, link %q)",
+				hdr.Name, hdr.Typeflag, hdr.Linkname, exp.name, exp.typeflag, exp.link)
+		}
+		data, _ := ioutil.ReadAll(tr)
+		if string(data) != exp.data {
+			t.Errorf("%s data is %q, expected %q", exp.name, data, exp.data)
+		}
+	}
+	if _, err := tr.Next(); err != io.EOF {
+		t.Errorf("extra entries in the archive: %v", err)
+	}
+}
+
+func newHostKey(t *testing.T) ssh.PublicKey {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func setKnownHostsOptions(t *testing.T, mode string, filename string) {
+	saved := make(map[string]string)
+	for k, v := range sshOptions {
+		saved[k] = v
+	}
+	sshOptions["StrictHostKeyChecking"] = mode
+	sshOptions["UserKnownHostsFile"] = filename
+	knownHostsCallback = nil
+	t.Cleanup(func() {
+		sshOptions = saved
+		knownHostsCallback = nil
+	})
+}
+
+func TestHostKeyCallbackAcceptNew(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "known_hosts")
+	setKnownHostsOptions(t, "accept-new", filename)
+	addr := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 22}
+	key := newHostKey(t)
+
+	failed := false
+	cb := hostKeyCallback(&failed)
+	if err := cb("host1:22", addr, key); err != nil || failed {
+		t.Fatalf("unknown key is not accepted: %v", err)
+	}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("known_hosts is not created: %s", err)
+	}
+	if !strings.HasPrefix(string(data), "host1 ssh-ed25519 ") {
+		t.Errorf("unexpected known_hosts line %q", data)
+	}
+
+	// the accepted key is known from now on
+	if err := cb("host1:22", addr, key); err != nil || failed {
+		t.Errorf("accepted key is rejected: %v", err)
+	}
+	// while a changed key is not accepted
+	if err := cb("host1:22", addr, newHostKey(t)); err == nil || !failed {
+		t.Errorf("changed key is accepted")
+	}
+	data2, _ := ioutil.ReadFile(filename)
+	if !bytes.Equal(data, data2) {
+		t.Errorf("known_hosts is modified by a changed key: %q", data2)
+	}
+}
+
+func TestHostKeyCallbackStrict(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "known_hosts")
+	addr := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 22}
+
+	setKnownHostsOptions(t, "yes", filename)
+	failed := false
+	if err := hostKeyCallback(&failed)("host1:22", addr, newHostKey(t)); err == nil || !failed {
+		t.Errorf("unknown key is accepted in strict mode")
+	}
+	if _, err := os.Stat(filename); !os.IsNotExist(err) {
+		t.Errorf("known_hosts is created in strict mode")
+	}
+
+	setKnownHostsOptions(t, "no", filename)
+	failed = false
+	if err := hostKeyCallback(&failed)("host1:22", addr, newHostKey(t)); err != nil || failed {
+		t.Errorf("key is checked with StrictHostKeyChecking=no: %v", err)
+	}
+}
+
+func TestKnownHostKeyAlgorithms(t *testing.T) {
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecdsaPub, err := ssh.NewPublicKey(&ecdsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaPub, err := ssh.NewPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ed25519Pub := newHostKey(t)
+
+	filename := filepath.Join(t.TempDir(), "known_hosts")
+	lines := []string{
+		knownhosts.Line([]string{"ed"}, ed25519Pub),
+		knownhosts.Line([]string{"rsa"}, rsaPub),
+		knownhosts.Line([]string{"all"}, rsaPub),
+		knownhosts.Line([]string{"all"}, ecdsaPub),
+		knownhosts.Line([]string{"all"}, ed25519Pub),
+		knownhosts.Line([]string{"[ported]:2222"}, ecdsaPub),
+	}
+	if err := ioutil.WriteFile(filename, []byte(strings.Join(lines, "\n")+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	addr := &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 22}
+
+	tests := []struct {
+		mode     string
+		hostname string
+		expected []string
+	}{
+		{"yes", "ed:22", []string{"ssh-ed25519"}},
+		{"yes", "rsa:22", []string{"rsa-sha2-512", "rsa-sha2-256", "ssh-rsa"}},
+		{"yes", "all:22", []string{"ssh-ed25519", "ecdsa-sha2-nistp256", "rsa-sha2-512", "rsa-sha2-256", "ssh-rsa"}},
+		{"yes", "ported:2222", []string{"ecdsa-sha2-nistp256"}},
+		{"yes", "ported:22", nil},
+		{"accept-new", "ed:22", []string{"ssh-ed25519"}},
+		{"accept-new", "unknown:22", nil},
+		{"no", "ed:22", nil},
+	}
+	for _, tt := range tests {
+		setKnownHostsOptions(t, tt.mode, filename)
+		algos := knownHostKeyAlgorithms(tt.hostname, addr)
+		if !reflect.DeepEqual(algos, tt.expected) {
+			t.Errorf("%s host key algorithms with StrictHostKeyChecking=%s are %v, expected %v",
+				tt.hostname, tt.mode, algos, tt.expected)
+		}
+	}
+}
+
+// TestDialKnownED25519Host checks a host known by its ed25519 key only
+// is connected to while the server prefers other key types
+func TestDialKnownED25519Host(t *testing.T) {
+	srvCfg := &ssh.ServerConfig{NoClientAuth: true}
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []interface{}{ecdsaKey, ed25519Key} {
+		signer, err := ssh.NewSignerFromKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		srvCfg.AddHostKey(signer)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, chans, reqs, err := ssh.NewServerConn(conn, srvCfg)
+				if err != nil {
+					conn.Close()
+					return
+				}
+				go ssh.DiscardRequests(reqs)
+				for ch := range chans {
+					ch.Reject(ssh.Prohibited, "no channels")
+				}
+			}()
+		}
+	}()
+
+	filename := filepath.Join(t.TempDir(), "known_hosts")
+	pub, err := ssh.NewPublicKey(ed25519Key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := knownhosts.Line([]string{knownhosts.Normalize(ln.Addr().String())}, pub)
+	if err := ioutil.WriteFile(filename, []byte(line+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SSH_AUTH_SOCK", "")
+
+	port := ln.Addr().(*net.TCPAddr).Port
+	for _, mode := range []string{"yes", "accept-new"} {
+		setKnownHostsOptions(t, mode, filename)
+		nc, err := dialParams(&HostParams{Address: "127.0.0.1", Port: port, User: "test"}, 0)
+		if err != nil {
+			t.Errorf("StrictHostKeyChecking=%s: dial error: %s", mode, err)
+			continue
+		}
+		nc.Close()
+	}
+	data, _ := ioutil.ReadFile(filename)
+	if string(data) != line+"\n" {
+		t.Errorf("known_hosts is modified: %q", data)
+	}
+}
+
+func TestHandshakeErrorCode(t *testing.T) {
+	tests := []struct {
+		err           error
+		hostKeyFailed bool
+		code          int
+	}{
+		{errors.New("ssh: handshake failed: knownhosts: key mismatch"), true, ErrHostKeyFailed},
+		// the message x/crypto/ssh returns when all auth methods are rejected
+		{errors.New("ssh: handshake failed: ssh: unable to authenticate, attempted methods [none publickey], no supported methods remain"), false, ErrSSHAuthFailed},
+		{errors.New("ssh: handshake failed: EOF"), false, ErrConnectionFailed},
+		{errors.New("ssh handshake with 10.0.0.1:22 timed out"), false, ErrConnectionFailed},
+	}
+	for _, tt := range tests {
+		code := handshakeErrorCode(tt.err, tt.hostKeyFailed)
+		if code != tt.code {
+			t.Errorf("handshakeErrorCode(%q, %v) = %d, expected %d", tt.err, tt.hostKeyFailed, code, tt.code)
+		}
+	}
+}
+
+func TestNativeExitCode(t *testing.T) {
+	if code := nativeExitCode(nil); code != 0 {
+		t.Errorf("nativeExitCode(nil) = %d, expected 0", code)
+	}
+	if code := nativeExitCode(&ssh.ExitMissingError{}); code != ErrConnectionFailed {
+		t.Errorf("nativeExitCode(ExitMissingError) = %d, expected %d", code, ErrConnectionFailed)
+	}
+}
+
+func TestCopyExitCode(t *testing.T) {
+	tests := []struct {
+		err     error
+		code    int
+		message string
+	}{
+		{nil, 0, ""},
+		{scpError("scp: /dst: Permission denied"), 1, "scp: scp: /dst: Permission denied\n"},
+		{&os.PathError{Op: "open", Path: "/src", Err: os.ErrNotExist}, 1, "ssh: open /src: file does not exist\n"},
+		{io.EOF, ErrConnectionFailed, "ssh: EOF\n"},
+	}
+	for _, tt := range tests {
+		w := &Worker{data: make(chan *Message, 1)}
+		code := w.copyExitCode(&Task{Hostname: "host1"}, tt.err)
+		if code != tt.code {
+			t.Errorf("copyExitCode(%v) = %d, expected %d", tt.err, code, tt.code)
+		}
+		message := ""
+		select {
+		case msg := <-w.data:
+			if msg.Type != MTStderr || msg.Hostname != "host1" {
+				t.Errorf("unexpected message %+v", msg)
+			}
+			message = string(msg.Data)
+		default:
+		}
+		if message != tt.message {
+			t.Errorf("copyExitCode(%v) message is %q, expected %q", tt.err, message, tt.message)
+		}
+	}
+}
@@ -0,0 +1,442 @@
+package remote
+
+import (
+	"archive/tar"
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// scpError is an error reported by the remote scp
+type scpError string
+
+func (e scpError) Error() string {
+	return string(e)
+}
+
+// messageWriter passes everything written to it as worker stderr messages
+type messageWriter struct {
+	w    *Worker
+	host string
+}
+
+func (mw *messageWriter) Write(p []byte) (int, error) {
+	data := make([]byte, len(p))
+	copy(data, p)
+	mw.w.data <- &Message{data, MTStderr, mw.host, -1}
+	return len(p), nil
+}
+
+func (w *Worker) nativeMessage(task *Task, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	w.data <- &Message{[]byte(msg + "\n"), MTStderr, task.Hostname, -1}
+}
+
+// nativeConnect connects to the task host reporting errors to the user
+func (w *Worker) nativeConnect(task *Task) (*nativeConn, int) {
+	if currentReuseConnections {
+		if conn := cachedNativeConn(task.Hostname); conn != nil {
+			return conn, 0
+		}
+	}
+
+	conn, err := dialNative(task.Hostname)
+	if err != nil {
+		w.log("error connecting to %s: %v", task.Hostname, err)
+		code := ErrConnectionFailed
+		if ce, ok := err.(*connError); ok {
+			code = ce.code
+		}
+		switch code {
+		case ErrHostKeyFailed:
+			w.nativeMessage(task, "ssh: host key verification failed: %s", err)
+		case ErrSSHAuthFailed:
+			w.nativeMessage(task, "ssh: authentication failed: %s", err)
+		default:
+			w.nativeMessage(task, "ssh: connection failed: %s", err)
+		}
+		return nil, code
+	}
+	if currentReuseConnections {
+		conn = cacheNativeConn(task.Hostname, conn)
+	}
+	return conn, 0
+}
+
+// nativeExitCode converts a session error to an exit code
+func nativeExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	if exitErr, ok := err.(*ssh.ExitError); ok {
+		return exitErr.ExitStatus()
+	}
+	// the session is closed without exit status, i.e. the connection is lost
+	return ErrConnectionFailed
+}
+
+func (w *Worker) nativeRuncmd(task *Task) int {
+	conn, code := w.nativeConnect(task)
+	if conn == nil {
+		return code
+	}
+	defer conn.release()
+
+	session, err := conn.client.NewSession()
+	if err != nil {
+		w.nativeMessage(task, "ssh: error opening session: %s", err)
+		return ErrConnectionFailed
+	}
+	defer session.Close()
+
+	// pty is requested the same way ssh -tt does to let
+	// su/sudo ask for password
+	if needTTY() {
+		err = session.RequestPty("xterm", 40, 80, ssh.TerminalModes{})
+		if err != nil {
+			w.log("error requesting pty: %v", err)
+			return ErrTerminalError
+		}
+	}
+
+	sout, err := session.StdoutPipe()
+	if err != nil {
+		w.log("error creating stdout pipe: %v", err)
+		return ErrTerminalError
+	}
+	serr, err := session.StderrPipe()
+	if err != nil {
+		w.log("error creating stderr pipe: %v", err)
+		return ErrTerminalError
+	}
+	sin, err := session.StdinPipe()
+	if err != nil {
+		w.log("error creating stdin pipe: %v", err)
+		return ErrTerminalError
+	}
+
+	err = session.Start(nativeCommand(task.Cmd))
+	if err != nil {
+		w.log("error starting cmd: %v", err)
+		return ErrCommandStartFailed
+	}
+
+	stdoutFinished := false
+	stderrFinished := false
+	deadline := taskDeadline(task)
+	go w.processStdout(ioutil.NopCloser(sout), sin, &stdoutFinished, task)
+	go w.processStderr(ioutil.NopCloser(serr), sin, &stderrFinished, task)
+
+	for !(stdoutFinished && stderrFinished) {
+		// only the session is closed so the cached
+		// connection stays usable
+		if w.forceStopped() {
+			session.Signal(ssh.SIGKILL)
+			session.Close()
+			return ErrForceStop
+		}
+		if deadlineExceeded(deadline) {
+			w.log("task on %s timed out", task.Hostname)
+			session.Signal(ssh.SIGKILL)
+			session.Close()
+			return ErrTimeout
+		}
+		time.Sleep(pollDeadline)
+	}
+
+	exitCode := nativeExitCode(session.Wait())
+	if exitCode == ErrConnectionFailed {
+		w.nativeMessage(task, "ssh: connection lost")
+	}
+	w.log("Task on %s exit coded is %d", task.Hostname, exitCode)
+	return exitCode
+}
+
+// nativeDo runs a copying function within a new session handling
+// force stop and converting its error to an exit code
+func (w *Worker) nativeDo(task *Task, fn func(*ssh.Session) error) int {
+	conn, code := w.nativeConnect(task)
+	if conn == nil {
+		return code
+	}
+	defer conn.release()
+
+	session, err := conn.client.NewSession()
+	if err != nil {
+		w.nativeMessage(task, "ssh: error opening session: %s", err)
+		return ErrConnectionFailed
+	}
+	defer session.Close()
+
+	deadline := taskDeadline(task)
+	res := make(chan error, 1)
+	go func() {
+		res <- fn(session)
+	}()
+
+	for {
+		select {
+		case err := <-res:
+			return w.copyExitCode(task, err)
+		case <-time.After(pollDeadline):
+			// only the session is closed so the cached
+			// connection stays usable
+			if w.forceStopped() {
+				session.Signal(ssh.SIGKILL)
+				session.Close()
+				return ErrForceStop
+			}
+			if deadlineExceeded(deadline) {
+				w.log("copying to %s timed out", task.Hostname)
+				session.Signal(ssh.SIGKILL)
+				session.Close()
+				return ErrTimeout
+			}
+		}
+	}
+}
+
+// copyExitCode converts a copying error to an exit code reporting it to the user.
+// Remote and local file errors are reported as the exit code 1 the same way
+// scp does, other errors mean the connection is lost
+func (w *Worker) copyExitCode(task *Task, err error) int {
+	if err == nil {
+		return 0
+	}
+	switch e := err.(type) {
+	case *ssh.ExitError:
+		return e.ExitStatus()
+	case scpError:
+		w.nativeMessage(task, "scp: %s", e)
+		return 1
+	default:
+		w.nativeMessage(task, "ssh: %s", err)
+		if _, ok := err.(*os.PathError); ok {
+			return 1
+		}
+		return ErrConnectionFailed
+	}
+}
+
+func (w *Worker) nativeCopy(task *Task) int {
+	return w.nativeDo(task, func(session *ssh.Session) error {
+		return scpUpload(session, task.LocalFilename, task.RemoteFilename, task.RecursiveCopy, &messageWriter{w, task.Hostname})
+	})
+}
+
+func (w *Worker) nativeTarcopy(task *Task) int {
+	return w.nativeDo(task, func(session *ssh.Session) error {
+		return tarUpload(session, task.LocalFilename, task.RemoteFilename, &messageWriter{w, task.Hostname})
+	})
+}
+
+// scpUpload copies a local file or directory running remote scp in sink mode.
+// The remote path is interpreted by the remote shell the same way scp does
+func scpUpload(session *ssh.Session, local string, remote string, recursive bool, stderr io.Writer) error {
+	st, err := os.Stat(local)
+	if err != nil {
+		return err
+	}
+	if st.IsDir() && !recursive {
+		return scpError(fmt.Sprintf("%s: not a regular file", local))
+	}
+	session.Stderr = stderr
+
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	scpCmd := "scp -t "
+	if recursive {
+		scpCmd = "scp -r -t "
+	}
+	err = session.Start(scpCmd + remote)
+	if err != nil {
+		return err
+	}
+
+	err = scpSend(stdin, bufio.NewReader(stdout), local, st)
+	stdin.Close()
+
+	werr := session.Wait()
+	if err != nil {
+		return err
+	}
+	return werr
+}
+
+// scpSend speaks the source side of the scp protocol writing
+// to w and reading the sink responses from r
+func scpSend(w io.Writer, r *bufio.Reader, local string, st os.FileInfo) error {
+	if err := scpAck(r); err != nil {
+		return err
+	}
+	if st.IsDir() {
+		return scpSendDir(w, r, local, st)
+	}
+	return scpSendFile(w, r, local, st)
+}
+
+// scpAck reads the scp response which is a zero byte on success
+// or an error code followed by a message
+func scpAck(r *bufio.Reader) error {
+	b, err := r.ReadByte()
+	if err != nil {
+		return err
+	}
+	if b == 0 {
+		return nil
+	}
+	msg, _ := r.ReadString('\n')
+	return scpError(strings.TrimSpace(msg))
+}
+
+func scpSendFile(w io.Writer, r *bufio.Reader, filename string, st os.FileInfo) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintf(w, "C%04o %d %s\n", st.Mode().Perm(), st.Size(), st.Name())
+	if err != nil {
+		return err
+	}
+	if err = scpAck(r); err != nil {
+		return err
+	}
+
+	_, err = io.CopyN(w, f, st.Size())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write([]byte{0})
+	if err != nil {
+		return err
+	}
+	return scpAck(r)
+}
+
+func scpSendDir(w io.Writer, r *bufio.Reader, dirname string, st os.FileInfo) error {
+	_, err := fmt.Fprintf(w, "D%04o 0 %s\n", st.Mode().Perm(), st.Name())
+	if err != nil {
+		return err
+	}
+	if err = scpAck(r); err != nil {
+		return err
+	}
+
+	entries, err := ioutil.ReadDir(dirname)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		path := filepath.Join(dirname, entry.Name())
+		// symlinks are followed as scp does
+		est, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		switch {
+		case est.IsDir():
+			err = scpSendDir(w, r, path, est)
+		case est.Mode().IsRegular():
+			err = scpSendFile(w, r, path, est)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = fmt.Fprint(w, "E\n")
+	if err != nil {
+		return err
+	}
+	return scpAck(r)
+}
+
+// tarUpload streams a tar archive of local path to remote tar,
+// an equivalent of "tar c local | ssh host tar x -C remote"
+func tarUpload(session *ssh.Session, local string, remote string, stderr io.Writer) error {
+	if remote == "" || remote == local {
+		remote = "."
+	}
+
+	session.Stdout = stderr
+	session.Stderr = stderr
+
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return err
+	}
+	err = session.Start("tar x -C " + remote)
+	if err != nil {
+		return err
+	}
+
+	tw := tar.NewWriter(stdin)
+	err = filepath.Walk(local, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		return tarAddFile(tw, path, info)
+	})
+	if err == nil {
+		err = tw.Close()
+	}
+	stdin.Close()
+
+	werr := session.Wait()
+	if err != nil {
+		return err
+	}
+	return werr
+}
+
+func tarAddFile(tw *tar.Writer, path string, info os.FileInfo) error {
+	link := ""
+	if info.Mode()&os.ModeSymlink != 0 {
+		var err error
+		link, err = os.Readlink(path)
+		if err != nil {
+			return err
+		}
+	}
+
+	hdr, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		// sockets and such are skipped
+		return nil
+	}
+	// leading slashes are removed the same way tar does
+	hdr.Name = strings.TrimLeft(filepath.ToSlash(path), "/")
+	if info.IsDir() {
+		hdr.Name += "/"
+	}
+	if err = tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.CopyN(tw, f, info.Size())
+	return err
+}
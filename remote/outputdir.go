@@ -0,0 +1,166 @@
+package remote
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	runIDFormat   = "20060102-150405"
+	metaTimeFmt   = time.RFC3339Nano
+	runMetaName   = "run.meta"
+	hostsDirName  = "hosts"
+	maxRunIDTries = 100
+)
+
+var (
+	currentOutputDir string
+)
+
+// SetOutputDir sets the directory every run writes per-host output files to,
+// empty string switches it off
+func SetOutputDir(dir string) {
+	currentOutputDir = dir
+}
+
+// RunInfo describes the command a result belongs to
+type RunInfo struct {
+	Name    string
+	Mode    string
+	Command string
+}
+
+// createRunDir creates a directory for a new run named by its start time,
+// a numeric suffix is added if a run with the same id already exists
+func createRunDir(dir string, start time.Time) (string, string, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return "", "", err
+	}
+
+	base := start.Format(runIDFormat)
+	runID := base
+	for i := 2; i <= maxRunIDTries; i++ {
+		runDir := filepath.Join(dir, runID)
+		err = os.Mkdir(runDir, 0755)
+		if err == nil {
+			return runID, runDir, nil
+		}
+		if !os.IsExist(err) {
+			return "", "", err
+		}
+		runID = fmt.Sprintf("%s-%d", base, i)
+	}
+	return "", "", fmt.Errorf("too many runs with id %s", base)
+}
+
+// hostFilename makes a safe file name of a host name, path separators
+// are replaced and names starting with a dot or a dash are prefixed
+// so they can't point outside the directory or look like options
+func hostFilename(host string) string {
+	name := strings.Map(func(r rune) rune {
+		if r == '/' || r == filepath.Separator || r == 0 {
+			return '_'
+		}
+		return r
+	}, host)
+	if name == "" || name[0] == '.' || name[0] == '-' {
+		name = "_" + name
+	}
+	return name
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(metaTimeFmt)
+}
+
+func writeMeta(filename string, fields [][2]string) error {
+	var sb strings.Builder
+	for _, field := range fields {
+		sb.WriteString(fmt.Sprintf("%s: %s\n", field[0], field[1]))
+	}
+	return ioutil.WriteFile(filename, []byte(sb.String()), 0644)
+}
+
+// WriteOutputDir writes the output of every host into its own file in a new
+// run directory within the output dir. hosts/<host>.out and hosts/<host>.err
+// keep stdout and stderr, hosts/<host>.meta keeps the exit code and timings,
+// run.meta describes the run itself. Returns the run directory or an empty
+// string if the output dir is not set
+func (r *ExecResult) WriteOutputDir(info RunInfo) (string, error) {
+	if currentOutputDir == "" {
+		return "", nil
+	}
+
+	runID, runDir, err := createRunDir(currentOutputDir, time.Now())
+	if err != nil {
+		return "", err
+	}
+	// host files are kept apart from the run files so
+	// no host name can clash with them
+	hostsDir := filepath.Join(runDir, hostsDirName)
+	err = os.Mkdir(hostsDir, 0755)
+	if err != nil {
+		return runDir, err
+	}
+
+	hosts := make([]string, 0, len(r.Codes))
+	for host := range r.Codes {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	for _, host := range hosts {
+		hr := r.host(host)
+		prefix := filepath.Join(hostsDir, hostFilename(host))
+
+		err = ioutil.WriteFile(prefix+".out", []byte(hr.Stdout), 0644)
+		if err != nil {
+			return runDir, err
+		}
+		if hr.Stderr != "" {
+			err = ioutil.WriteFile(prefix+".err", []byte(hr.Stderr), 0644)
+			if err != nil {
+				return runDir, err
+			}
+		}
+
+		err = writeMeta(prefix+".meta", [][2]string{
+			{"run_id", runID},
+			{"host", host},
+			{"command", info.Name},
+			{"mode", info.Mode},
+			{"args", info.Command},
+			{"exit_code", fmt.Sprintf("%d", hr.ExitCode)},
+			{"failure", hr.Failure.String()},
+			{"start", formatTime(hr.Start)},
+			{"end", formatTime(hr.End)},
+			{"duration", hr.Duration().String()},
+		})
+		if err != nil {
+			return runDir, err
+		}
+	}
+
+	err = writeMeta(filepath.Join(runDir, runMetaName), [][2]string{
+		{"run_id", runID},
+		{"command", info.Name},
+		{"mode", info.Mode},
+		{"args", info.Command},
+		{"user", currentUser},
+		{"hosts", fmt.Sprintf("%d", len(hosts)+len(r.SkippedHosts))},
+		{"success", strings.Join(r.SuccessHosts, ",")},
+		{"error", strings.Join(r.ErrorHosts, ",")},
+		{"timeout", strings.Join(r.TimeoutHosts, ",")},
+		{"skipped", strings.Join(r.SkippedHosts, ",")},
+	})
+	return runDir, err
+}
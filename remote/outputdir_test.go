@@ -0,0 +1,155 @@
+package remote
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHostFilename(t *testing.T) {
+	tests := []struct {
+		host     string
+		expected string
+	}{
+		{"web1.example.com", "web1.example.com"},
+		{"a/b", "a_b"},
+		{"../etc/passwd", "_.._etc_passwd"},
+		{"..", "_.."},
+		{".", "_."},
+		{".hidden", "_.hidden"},
+		{"-rf", "_-rf"},
+		{"", "_"},
+		{"run", "run"},
+		{"a\x00b", "a_b"},
+	}
+	for _, tt := range tests {
+		if res := hostFilename(tt.host); res != tt.expected {
+			t.Errorf("hostFilename(%q) = %q, expected %q", tt.host, res, tt.expected)
+		}
+	}
+}
+
+func TestCreateRunDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "runs")
+	start := time.Date(2019, 10, 23, 15, 30, 12, 0, time.Local)
+
+	expected := []string{"20191023-153012", "20191023-153012-2", "20191023-153012-3"}
+	for _, exp := range expected {
+		runID, runDir, err := createRunDir(dir, start)
+		if err != nil {
+			t.Fatalf("createRunDir: %s", err)
+		}
+		if runID != exp || runDir != filepath.Join(dir, exp) {
+			t.Errorf("run is %s in %s, expected %s", runID, runDir, exp)
+		}
+		if st, err := os.Stat(runDir); err != nil || !st.IsDir() {
+			t.Errorf("run directory %s is not created", runDir)
+		}
+	}
+
+	// every id is taken
+	os.Mkdir(filepath.Join(dir, "20191023-153013"), 0755)
+	for i := 2; i <= maxRunIDTries; i++ {
+		os.Mkdir(filepath.Join(dir, fmt.Sprintf("20191023-153013-%d", i)), 0755)
+	}
+	if _, _, err := createRunDir(dir, start.Add(time.Second)); err == nil {
+		t.Errorf("no error creating a run with every id taken")
+	}
+}
+
+func listFiles(t *testing.T, dir string) []string {
+	files := make([]string, 0)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			rel, _ := filepath.Rel(dir, path)
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	return files
+}
+
+func TestWriteOutputDir(t *testing.T) {
+	dir := t.TempDir()
+	SetOutputDir(dir)
+	defer SetOutputDir("")
+
+	r := newExecResult()
+	for _, host := range []string{"web1", "run", "../up"} {
+		r.startHost(host)
+		r.addOutput(host, []byte(host+" out\n"), false)
+	}
+	r.addOutput("web1", []byte("warning\n"), true)
+	r.addResult("web1", 0)
+	r.addResult("run", 1)
+	r.addResult("../up", ErrConnectionFailed)
+	r.SkippedHosts = append(r.SkippedHosts, "db1")
+
+	runDir, err := r.WriteOutputDir(RunInfo{Name: "exec", Mode: "parallel", Command: "uptime"})
+	if err != nil {
+		t.Fatalf("WriteOutputDir: %s", err)
+	}
+	if filepath.Dir(runDir) != dir {
+		t.Errorf("run directory %s is created outside of %s", runDir, dir)
+	}
+
+	expected := []string{
+		"hosts/_.._up.meta",
+		"hosts/_.._up.out",
+		"hosts/run.meta",
+		"hosts/run.out",
+		"hosts/web1.err",
+		"hosts/web1.meta",
+		"hosts/web1.out",
+		"run.meta",
+	}
+	if files := listFiles(t, runDir); !reflect.DeepEqual(files, expected) {
+		t.Fatalf("run files are %q, expected %q", files, expected)
+	}
+
+	data, _ := ioutil.ReadFile(filepath.Join(runDir, "hosts", "web1.out"))
+	if string(data) != "web1 out\n" {
+		t.Errorf("web1.out is %q", data)
+	}
+	data, _ = ioutil.ReadFile(filepath.Join(runDir, "hosts", "web1.err"))
+	if string(data) != "warning\n" {
+		t.Errorf("web1.err is %q", data)
+	}
+
+	data, _ = ioutil.ReadFile(filepath.Join(runDir, "hosts", "run.meta"))
+	meta := string(data)
+	for _, field := range []string{"host: run\n", "command: exec\n", "mode: parallel\n", "args: uptime\n", "exit_code: 1\n", "failure: command\n"} {
+		if !strings.Contains(meta, field) {
+			t.Errorf("host run.meta has no %q:\n%s", field, meta)
+		}
+	}
+
+	data, _ = ioutil.ReadFile(filepath.Join(runDir, "run.meta"))
+	meta = string(data)
+	for _, field := range []string{"run_id: " + filepath.Base(runDir) + "\n", "hosts: 4\n", "success: web1\n", "error: run,../up\n", "skipped: db1\n"} {
+		if !strings.Contains(meta, field) {
+			t.Errorf("run.meta has no %q:\n%s", field, meta)
+		}
+	}
+}
+
+func TestWriteOutputDirOff(t *testing.T) {
+	SetOutputDir("")
+	runDir, err := newExecResult().WriteOutputDir(RunInfo{})
+	if runDir != "" || err != nil {
+		t.Errorf("WriteOutputDir with no output dir returned %q, %v", runDir, err)
+	}
+}
@@ -85,6 +85,7 @@ func (p *Pool) AddTaskHostlist(task *Task, hosts []string) {
 			RemoteFilename: task.RemoteFilename,
 			Cmd:            task.Cmd,
 			WG:             task.WG,
+			Deadline:       task.Deadline,
 		}
 		p.AddTask(t)
 	}
@@ -21,17 +21,29 @@ var (
 	currentPrependHostnames   bool
 	currentRemoteTmpdir       string
 	currentDebug              bool
+	currentCommandTimeout     time.Duration
+	currentSeparateStderr     bool
 	outputFile                *os.File
 	poolLock                  *sync.Mutex
 	poolSize                  int
 	remoteEnvironment         map[string]string
 	sshCommand                string
+	hostResolver              func(string) *HostParams
 
 	noneInterpreter string
 	suInterpreter   string
 	sudoInterpreter string
 )
 
+// HostParams are per-host connection parameters,
+// empty values mean the defaults are used
+type HostParams struct {
+	Address  string
+	Port     int
+	User     string
+	JumpHost string
+}
+
 // Initialize initializes new execution pool
 func Initialize(numThreads int, username string) {
 	poolLock = new(sync.Mutex)
@@ -45,6 +57,30 @@ func SetSSHCommand(command string) {
 	sshCommand = command
 }
 
+// SetHostResolver sets a function providing connection parameters for a host.
+// The function may return nil if there are no specific parameters
+func SetHostResolver(resolver func(string) *HostParams) {
+	hostResolver = resolver
+}
+
+// resolveHost returns the connection parameters for a host
+// with defaults applied, i.e. the host name itself and the current user
+func resolveHost(host string) *HostParams {
+	hp := &HostParams{}
+	if hostResolver != nil {
+		if resolved := hostResolver(host); resolved != nil {
+			*hp = *resolved
+		}
+	}
+	if hp.Address == "" {
+		hp.Address = host
+	}
+	if hp.User == "" {
+		hp.User = currentUser
+	}
+	return hp
+}
+
 // SetInterpreter sets none-raise interpreter
 func SetInterpreter(interpreter string) {
 	noneInterpreter = interpreter
@@ -110,6 +146,18 @@ func SetConnectTimeout(timeout int) {
 	sshOptions["ConnectTimeout"] = fmt.Sprintf("%d", timeout)
 }
 
+// SetCommandTimeout sets the per-host execution timeout in seconds,
+// 0 means no timeout
+func SetCommandTimeout(timeout int) {
+	currentCommandTimeout = time.Duration(timeout) * time.Second
+}
+
+// SetSeparateStderr sets whether commands are run without a terminal
+// to keep stderr separately from stdout when no raise is used
+func SetSeparateStderr(separate bool) {
+	currentSeparateStderr = separate
+}
+
 // SetOutputFile sets output file for every command.
 // if it's nil, no output will be written to files
 func SetOutputFile(f *os.File) {
@@ -0,0 +1,135 @@
+package remote
+
+import (
+	"time"
+)
+
+// FailureClass describes the reason of execution failure on a host
+type FailureClass int
+
+// Failure classes
+const (
+	FCNone FailureClass = iota
+	FCCommand
+	FCConnection
+	FCCopy
+	FCAuth
+	FCTimeout
+	FCStopped
+	FCLocal
+	FCHealthCheck
+)
+
+var failureClassNames = map[FailureClass]string{
+	FCNone:        "none",
+	FCCommand:     "command",
+	FCConnection:  "connection",
+	FCCopy:        "copy",
+	FCAuth:        "auth",
+	FCTimeout:     "timeout",
+	FCStopped:     "stopped",
+	FCLocal:       "local",
+	FCHealthCheck: "health",
+}
+
+func (fc FailureClass) String() string {
+	return failureClassNames[fc]
+}
+
+// ParseFailureClass returns the failure class by its name
+func ParseFailureClass(name string) (FailureClass, bool) {
+	for fc, fcName := range failureClassNames {
+		if fcName == name {
+			return fc, true
+		}
+	}
+	return FCNone, false
+}
+
+// Classify returns the failure class of an exit code
+func Classify(code int) FailureClass {
+	switch {
+	case code == 0:
+		return FCNone
+	case IsConnectionError(code):
+		return FCConnection
+	case code == ErrCopyFailed:
+		return FCCopy
+	case code == ErrAuthenticationError:
+		return FCAuth
+	case code == ErrTimeout:
+		return FCTimeout
+	case code == ErrForceStop:
+		return FCStopped
+	case code == ErrHealthCheckFailed:
+		return FCHealthCheck
+	case code == ErrTerminalError || code == ErrCommandStartFailed || code == ErrMacOsExit:
+		return FCLocal
+	default:
+		return FCCommand
+	}
+}
+
+// HostResult is the result of execution on a single host
+type HostResult struct {
+	Host     string
+	Stdout   string
+	Stderr   string
+	ExitCode int
+	Start    time.Time
+	End      time.Time
+	Failure  FailureClass
+}
+
+// Duration returns the time spent on the host
+func (hr *HostResult) Duration() time.Duration {
+	if hr.Start.IsZero() || hr.End.IsZero() {
+		return 0
+	}
+	return hr.End.Sub(hr.Start)
+}
+
+// Output returns stdout and stderr of the host combined
+func (hr *HostResult) Output() string {
+	return hr.Stdout + hr.Stderr
+}
+
+func (r *ExecResult) host(name string) *HostResult {
+	hr, found := r.Hosts[name]
+	if !found {
+		hr = &HostResult{Host: name}
+		r.Hosts[name] = hr
+	}
+	return hr
+}
+
+func (r *ExecResult) startHost(name string) {
+	hr := r.host(name)
+	if hr.Start.IsZero() {
+		hr.Start = time.Now()
+	}
+}
+
+func (r *ExecResult) addOutput(name string, data []byte, stderr bool) {
+	hr := r.host(name)
+	if stderr {
+		hr.Stderr += string(data)
+	} else {
+		hr.Stdout += string(data)
+	}
+}
+
+// MergeFailed adds the failed hosts of another result, i.e. the hosts
+// the script couldn't be copied to before running it
+func (r *ExecResult) MergeFailed(other *ExecResult) {
+	for _, name := range other.ErrorHosts {
+		if _, found := r.Codes[name]; found {
+			continue
+		}
+		r.addResult(name, other.Codes[name])
+		if ohr, found := other.Hosts[name]; found {
+			hr := r.host(name)
+			*hr = *ohr
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package remote
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		code int
+		fc   FailureClass
+	}{
+		{0, FCNone},
+		{1, FCCommand},
+		{127, FCCommand},
+		{255, FCCommand},
+		{ErrMacOsExit, FCLocal},
+		{ErrForceStop, FCStopped},
+		{ErrCopyFailed, FCCopy},
+		{ErrTerminalError, FCLocal},
+		{ErrAuthenticationError, FCAuth},
+		{ErrCommandStartFailed, FCLocal},
+		{ErrConnectionFailed, FCConnection},
+		{ErrHostKeyFailed, FCConnection},
+		{ErrSSHAuthFailed, FCConnection},
+		{ErrTimeout, FCTimeout},
+		{ErrHealthCheckFailed, FCHealthCheck},
+	}
+	for _, tt := range tests {
+		if fc := Classify(tt.code); fc != tt.fc {
+			t.Errorf("Classify(%d) = %s, expected %s", tt.code, fc, tt.fc)
+		}
+	}
+}
+
+func TestParseFailureClass(t *testing.T) {
+	for fc, name := range failureClassNames {
+		parsed, ok := ParseFailureClass(name)
+		if !ok || parsed != fc {
+			t.Errorf("ParseFailureClass(%q) = %s, %v, expected %s", name, parsed, ok, fc)
+		}
+		if fc.String() != name {
+			t.Errorf("%d.String() = %q, expected %q", fc, fc.String(), name)
+		}
+	}
+	if _, ok := ParseFailureClass("unknown"); ok {
+		t.Errorf("ParseFailureClass(\"unknown\") succeeded")
+	}
+}
+
+func TestHostResult(t *testing.T) {
+	start := time.Date(2019, 10, 23, 15, 30, 12, 0, time.UTC)
+	tests := []struct {
+		hr       HostResult
+		duration time.Duration
+		output   string
+	}{
+		{HostResult{}, 0, ""},
+		{HostResult{Start: start}, 0, ""},
+		{HostResult{End: start}, 0, ""},
+		{HostResult{Start: start, End: start.Add(1500 * time.Millisecond), Stdout: "out\n"}, 1500 * time.Millisecond, "out\n"},
+		{HostResult{Stdout: "out\n", Stderr: "err\n"}, 0, "out\nerr\n"},
+	}
+	for i, tt := range tests {
+		if d := tt.hr.Duration(); d != tt.duration {
+			t.Errorf("case %d: duration is %s, expected %s", i, d, tt.duration)
+		}
+		if out := tt.hr.Output(); out != tt.output {
+			t.Errorf("case %d: output is %q, expected %q", i, out, tt.output)
+		}
+	}
+}
+
+func TestStartHost(t *testing.T) {
+	r := newExecResult()
+	r.startHost("h1")
+	start := r.Hosts["h1"].Start
+	if start.IsZero() || r.Hosts["h1"].Host != "h1" {
+		t.Fatalf("host is not started: %+v", r.Hosts["h1"])
+	}
+	// the copying and the running parts of a task start the host twice
+	r.startHost("h1")
+	if !r.Hosts["h1"].Start.Equal(start) {
+		t.Errorf("start time is reset")
+	}
+}
+
+func TestAddOutput(t *testing.T) {
+	r := newExecResult()
+	r.addOutput("h1", []byte("line1\n"), false)
+	r.addOutput("h1", []byte("error\n"), true)
+	r.addOutput("h1", []byte("line2\n"), false)
+	hr := r.Hosts["h1"]
+	if hr.Stdout != "line1\nline2\n" || hr.Stderr != "error\n" {
+		t.Errorf("stdout is %q, stderr is %q", hr.Stdout, hr.Stderr)
+	}
+	if !hr.Start.IsZero() {
+		t.Errorf("adding output starts the host")
+	}
+}
+
+func TestAddResult(t *testing.T) {
+	r := newExecResult()
+	codes := []struct {
+		host string
+		code int
+	}{
+		{"ok", 0},
+		{"failed", 1},
+		{"timeout", ErrTimeout},
+		{"unreachable", ErrConnectionFailed},
+	}
+	for _, c := range codes {
+		r.startHost(c.host)
+		r.addResult(c.host, c.code)
+	}
+
+	if !reflect.DeepEqual(r.SuccessHosts, []string{"ok"}) {
+		t.Errorf("success hosts are %v", r.SuccessHosts)
+	}
+	if !reflect.DeepEqual(r.ErrorHosts, []string{"failed", "timeout", "unreachable"}) {
+		t.Errorf("error hosts are %v", r.ErrorHosts)
+	}
+	if !reflect.DeepEqual(r.TimeoutHosts, []string{"timeout"}) {
+		t.Errorf("timeout hosts are %v", r.TimeoutHosts)
+	}
+	for _, c := range codes {
+		hr := r.Hosts[c.host]
+		if r.Codes[c.host] != c.code || hr.ExitCode != c.code || hr.Failure != Classify(c.code) {
+			t.Errorf("%s result is %d (%+v), expected %d", c.host, r.Codes[c.host], hr, c.code)
+		}
+		if hr.End.Before(hr.Start) || hr.End.IsZero() {
+			t.Errorf("%s end time %s is wrong", c.host, hr.End)
+		}
+	}
+}
+
+func TestMergeFailed(t *testing.T) {
+	// the result of copying a script
+	dr := newExecResult()
+	for _, host := range []string{"h1", "h2", "h3", "h4", "h5"} {
+		dr.startHost(host)
+	}
+	dr.addOutput("h2", []byte("scp: /tmp: Permission denied\n"), true)
+	dr.addResult("h1", 0)
+	dr.addResult("h2", ErrCopyFailed)
+	dr.addResult("h3", ErrTimeout)
+	dr.addResult("h4", ErrConnectionFailed)
+	dr.addResult("h5", 0)
+
+	// the result of running it on the hosts it's been copied to
+	r := newExecResult()
+	r.startHost("h1")
+	r.addOutput("h1", []byte("done\n"), false)
+	r.addResult("h1", 0)
+	r.startHost("h5")
+	r.addResult("h5", 2)
+
+	r.MergeFailed(dr)
+
+	expected := map[string]int{"h1": 0, "h2": ErrCopyFailed, "h3": ErrTimeout, "h4": ErrConnectionFailed, "h5": 2}
+	if !reflect.DeepEqual(r.Codes, expected) {
+		t.Errorf("codes are %v, expected %v", r.Codes, expected)
+	}
+	if !reflect.DeepEqual(r.SuccessHosts, []string{"h1"}) {
+		t.Errorf("success hosts are %v", r.SuccessHosts)
+	}
+	if !reflect.DeepEqual(r.ErrorHosts, []string{"h5", "h2", "h3", "h4"}) {
+		t.Errorf("error hosts are %v", r.ErrorHosts)
+	}
+	if !reflect.DeepEqual(r.TimeoutHosts, []string{"h3"}) {
+		t.Errorf("timeout hosts are %v", r.TimeoutHosts)
+	}
+
+	// the host results of failed copies replace the empty ones
+	for host, fc := range map[string]FailureClass{"h2": FCCopy, "h3": FCTimeout, "h4": FCConnection} {
+		hr := r.Hosts[host]
+		if *hr != *dr.Hosts[host] || hr.Failure != fc {
+			t.Errorf("%s result is %+v, expected %+v", host, hr, dr.Hosts[host])
+		}
+	}
+	if r.Hosts["h2"].Stderr != "scp: /tmp: Permission denied\n" {
+		t.Errorf("copy error output is lost: %q", r.Hosts["h2"].Stderr)
+	}
+	// results of the hosts run are kept
+	if r.Hosts["h1"].Stdout != "done\n" || r.Hosts["h5"].ExitCode != 2 {
+		t.Errorf("run results are overridden: %+v %+v", r.Hosts["h1"], r.Hosts["h5"])
+	}
+}
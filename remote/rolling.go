@@ -0,0 +1,187 @@
+package remote
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/viert/xc/log"
+	"github.com/viert/xc/term"
+)
+
+// Threshold is either an absolute number of hosts or a percentage of them
+type Threshold struct {
+	Value   int
+	Percent bool
+}
+
+// ParseThreshold parses a threshold in form of "N" or "N%"
+func ParseThreshold(s string) (Threshold, error) {
+	t := Threshold{}
+	value := strings.TrimSpace(s)
+	if strings.HasSuffix(value, "%") {
+		t.Percent = true
+		value = strings.TrimSuffix(value, "%")
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return t, fmt.Errorf("invalid value %q, a number or a percentage expected", s)
+	}
+	if n < 0 {
+		return t, fmt.Errorf("invalid value %q, can't be negative", s)
+	}
+	if t.Percent && n > 100 {
+		return t, fmt.Errorf("invalid value %q, percentage can't exceed 100%%", s)
+	}
+	t.Value = n
+	return t, nil
+}
+
+func (t Threshold) String() string {
+	if t.Percent {
+		return fmt.Sprintf("%d%%", t.Value)
+	}
+	return strconv.Itoa(t.Value)
+}
+
+// Of returns the number of hosts the threshold means out of total,
+// percentages are rounded down
+func (t Threshold) Of(total int) int {
+	if !t.Percent {
+		return t.Value
+	}
+	return total * t.Value / 100
+}
+
+// RollingOptions are the parameters of rolling execution
+type RollingOptions struct {
+	// BatchSize is the number of hosts run at once, at least one host
+	BatchSize Threshold
+	// Delay is the delay between batches in seconds
+	Delay int
+	// MaxFailures is the number of failed hosts tolerated,
+	// the execution is aborted once it's exceeded
+	MaxFailures Threshold
+}
+
+// limits returns the batch size and the number of failed hosts tolerated
+// out of total hosts. The batch size is at least one host
+func (o RollingOptions) limits(total int) (int, int) {
+	batchSize := o.BatchSize.Of(total)
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	return batchSize, o.MaxFailures.Of(total)
+}
+
+// failuresExceeded returns true if more hosts have failed than tolerated
+func (r *ExecResult) failuresExceeded(maxFailures int) bool {
+	return len(r.ErrorHosts) > maxFailures
+}
+
+// runBatch runs the prepared script on hosts in parallel waiting for all
+// of them to finish. Returns false if the batch was stopped by ^C
+func runBatch(hosts []string, local string, remote string, r *ExecResult, sigs chan os.Signal) bool {
+	running := len(hosts)
+	stopped := false
+	go enqueue(local, remote, hosts)
+
+	lines := make(lineBuffers)
+	for running > 0 {
+		select {
+		case d := <-pool.Data:
+			if processParallelMessage(r, lines, d) {
+				running--
+			}
+		case <-sigs:
+			fmt.Println()
+			r.ForceStoppedHosts += pool.ForceStopAllTasks()
+			stopped = true
+		}
+	}
+	return !stopped
+}
+
+// waitDelay waits for delay seconds, returns false if interrupted by ^C
+func waitDelay(delay int, sigs chan os.Signal) bool {
+	log.Debugf("Delay %d secs", delay)
+	select {
+	case <-sigs:
+		log.Debugf("Delay interrupted by ^C")
+		return false
+	case <-time.After(time.Duration(delay) * time.Second):
+		log.Debugf("Delay finished")
+		return true
+	}
+}
+
+// RunRolling runs cmd on hosts in batches, every batch is run in parallel.
+// The execution is aborted when the number of failed hosts exceeds
+// opts.MaxFailures or the health check doesn't pass on a batch,
+// the hosts left are listed in SkippedHosts
+func RunRolling(hosts []string, cmd string, opts RollingOptions) *ExecResult {
+	r := newExecResult()
+	if len(hosts) == 0 {
+		return r
+	}
+
+	local, remote, err := prepareTempFiles(cmd)
+	if err != nil {
+		term.Errorf("Error creating temporary file: %s\n", err)
+		return r
+	}
+	defer os.Remove(local)
+
+	batchSize, maxFailures := opts.limits(len(hosts))
+	numBatches := (len(hosts) + batchSize - 1) / batchSize
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT)
+	defer signal.Reset()
+
+	pool = NewPool()
+	defer pool.Close()
+
+	for start := 0; start < len(hosts); start += batchSize {
+		end := start + batchSize
+		if end > len(hosts) {
+			end = len(hosts)
+		}
+
+		msg := fmt.Sprintf(" batch %d/%d: %d host(s) ", start/batchSize+1, numBatches, end-start)
+		if !jsonOutput() {
+			fmt.Println(term.Blue(term.HR(7) + msg + term.HR(136-len(msg))))
+		}
+
+		if !runBatch(hosts[start:end], local, remote, r, sigs) {
+			term.Errorf("Rolling execution stopped\n")
+			r.SkippedHosts = append(r.SkippedHosts, hosts[end:]...)
+			break
+		}
+
+		if currentHealthCheck != nil && !currentHealthCheck.gate(hosts[start:end], r, sigs) {
+			term.Errorf("Health check hasn't passed, rolling execution aborted\n")
+			r.SkippedHosts = append(r.SkippedHosts, hosts[end:]...)
+			break
+		}
+
+		if r.failuresExceeded(maxFailures) {
+			term.Errorf("Failure threshold exceeded: %d host(s) failed, %d allowed. Aborting\n", len(r.ErrorHosts), maxFailures)
+			r.SkippedHosts = append(r.SkippedHosts, hosts[end:]...)
+			break
+		}
+
+		// no delay after the last batch
+		if opts.Delay > 0 && end < len(hosts) && !waitDelay(opts.Delay, sigs) {
+			term.Errorf("Rolling execution stopped\n")
+			r.SkippedHosts = append(r.SkippedHosts, hosts[end:]...)
+			break
+		}
+	}
+
+	return r
+}
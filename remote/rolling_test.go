@@ -0,0 +1,116 @@
+package remote
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParseThreshold(t *testing.T) {
+	tests := []struct {
+		s        string
+		expected Threshold
+		str      string
+	}{
+		{"0", Threshold{0, false}, "0"},
+		{"5", Threshold{5, false}, "5"},
+		{" 12 ", Threshold{12, false}, "12"},
+		{"0%", Threshold{0, true}, "0%"},
+		{"25%", Threshold{25, true}, "25%"},
+		{"100%", Threshold{100, true}, "100%"},
+	}
+	for _, tt := range tests {
+		th, err := ParseThreshold(tt.s)
+		if err != nil {
+			t.Errorf("ParseThreshold(%q) error: %s", tt.s, err)
+			continue
+		}
+		if th != tt.expected {
+			t.Errorf("ParseThreshold(%q) = %+v, expected %+v", tt.s, th, tt.expected)
+		}
+		if th.String() != tt.str {
+			t.Errorf("ParseThreshold(%q).String() = %q, expected %q", tt.s, th.String(), tt.str)
+		}
+	}
+
+	for _, s := range []string{"", "%", "abc", "5x", "-1", "-5%", "101%", "1.5", "%5"} {
+		if th, err := ParseThreshold(s); err == nil {
+			t.Errorf("ParseThreshold(%q) = %+v, error expected", s, th)
+		}
+	}
+}
+
+func TestThresholdOf(t *testing.T) {
+	tests := []struct {
+		th       Threshold
+		total    int
+		expected int
+	}{
+		{Threshold{3, false}, 10, 3},
+		// absolute values aren't limited by the total
+		{Threshold{30, false}, 10, 30},
+		{Threshold{0, false}, 10, 0},
+		{Threshold{50, true}, 10, 5},
+		{Threshold{100, true}, 7, 7},
+		{Threshold{0, true}, 10, 0},
+		// percentages are rounded down
+		{Threshold{25, true}, 10, 2},
+		{Threshold{10, true}, 9, 0},
+		{Threshold{33, true}, 100, 33},
+		{Threshold{50, true}, 0, 0},
+	}
+	for _, tt := range tests {
+		if n := tt.th.Of(tt.total); n != tt.expected {
+			t.Errorf("%s of %d = %d, expected %d", tt.th, tt.total, n, tt.expected)
+		}
+	}
+}
+
+func TestRollingLimits(t *testing.T) {
+	tests := []struct {
+		name        string
+		batch       string
+		maxFailures string
+		total       int
+		batchSize   int
+		// abortAt is the number of failed hosts the execution is aborted at
+		abortAt int
+	}{
+		{"absolute", "2", "1", 10, 2, 2},
+		{"percentage", "20%", "10%", 10, 2, 2},
+		{"rounded down", "15%", "15%", 10, 1, 2},
+		{"batch 0%", "0%", "0", 10, 1, 1},
+		{"batch rounded to zero", "10%", "0", 5, 1, 1},
+		{"batch larger than total", "20", "0", 5, 20, 1},
+		{"no failures tolerated", "5", "0", 10, 5, 1},
+		{"no failures tolerated by percentage", "5", "0%", 10, 5, 1},
+		{"percentage rounded to zero", "1", "5%", 10, 1, 1},
+		{"every failure tolerated", "1", "100%", 10, 1, 11},
+	}
+	for _, tt := range tests {
+		batch, err := ParseThreshold(tt.batch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		maxFailures, err := ParseThreshold(tt.maxFailures)
+		if err != nil {
+			t.Fatal(err)
+		}
+		opts := RollingOptions{BatchSize: batch, MaxFailures: maxFailures}
+
+		batchSize, tolerated := opts.limits(tt.total)
+		if batchSize != tt.batchSize {
+			t.Errorf("%s: batch size is %d, expected %d", tt.name, batchSize, tt.batchSize)
+		}
+		r := newExecResult()
+		for i := 0; i < tt.abortAt; i++ {
+			if r.failuresExceeded(tolerated) {
+				t.Errorf("%s: aborted at %d failed host(s), expected %d", tt.name, i, tt.abortAt)
+				break
+			}
+			r.addResult(fmt.Sprintf("h%d", i), 1)
+		}
+		if !r.failuresExceeded(tolerated) {
+			t.Errorf("%s: not aborted at %d failed host(s)", tt.name, tt.abortAt)
+		}
+	}
+}
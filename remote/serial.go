@@ -110,8 +110,7 @@ func runAtHost(host string, cmd *exec.Cmd, r *ExecResult) {
 	ptmx, err = pty.Start(cmd)
 	if err != nil {
 		term.Errorf("Error creating PTY: %s\n", err)
-		r.ErrorHosts = append(r.ErrorHosts, host)
-		r.Codes[host] = ErrTerminalError
+		r.addResult(host, ErrTerminalError)
 		return
 	}
 	pty.InheritSize(os.Stdin, ptmx)
@@ -120,16 +119,14 @@ func runAtHost(host string, cmd *exec.Cmd, r *ExecResult) {
 	stdinBackup, err := syscall.Dup(int(os.Stdin.Fd()))
 	if err != nil {
 		term.Errorf("Error duplicating stdin descriptor: %s\n", err)
-		r.ErrorHosts = append(r.ErrorHosts, host)
-		r.Codes[host] = ErrTerminalError
+		r.addResult(host, ErrTerminalError)
 		return
 	}
 
 	stdinState, err := terminal.MakeRaw(int(os.Stdin.Fd()))
 	if err != nil {
 		term.Errorf("Error setting stdin to raw mode: %s\n", err)
-		r.ErrorHosts = append(r.ErrorHosts, host)
-		r.Codes[host] = ErrTerminalError
+		r.addResult(host, ErrTerminalError)
 		return
 	}
 	defer func() {
@@ -139,8 +136,7 @@ func runAtHost(host string, cmd *exec.Cmd, r *ExecResult) {
 	si, err = poller.NewFD(int(os.Stdin.Fd()))
 	if err != nil {
 		term.Errorf("Error initializing poller: %s\n", err)
-		r.ErrorHosts = append(r.ErrorHosts, host)
-		r.Codes[host] = ErrTerminalError
+		r.addResult(host, ErrTerminalError)
 		return
 	}
 
@@ -154,6 +150,10 @@ func runAtHost(host string, cmd *exec.Cmd, r *ExecResult) {
 	buf = make([]byte, bufferSize)
 	go forwardUserInput(si, ptmx, &stopped)
 
+	// pty output comes in arbitrary chunks while JSON events are per line
+	lines := &lineBuffer{host: host}
+	defer lines.flush()
+
 	if currentUsePasswordManager {
 		password = passmgr.GetPass(host)
 	}
@@ -171,23 +171,27 @@ func runAtHost(host string, cmd *exec.Cmd, r *ExecResult) {
 				}
 				log.Debugf("Wrong %s password\n", raise)
 				term.Errorf("Wrong %s password\n", raise)
-				r.ErrorHosts = append(r.ErrorHosts, host)
-				r.Codes[host] = ErrAuthenticationError
+				r.addResult(host, ErrAuthenticationError)
 				break
 			}
 
 			if len(data) > 0 {
-				// copy stdin to process ptmx
-				_, err = os.Stdout.Write(data)
-				if err != nil {
-					count := stdoutWriteRetry
-					for os.IsTimeout(err) && count > 0 {
-						time.Sleep(time.Millisecond)
-						_, err = os.Stdout.Write(data)
-						count--
-					}
+				r.addOutput(host, data, false)
+				if jsonOutput() {
+					lines.write(data)
+				} else {
+					// copy stdin to process ptmx
+					_, err = os.Stdout.Write(data)
 					if err != nil {
-						log.Debugf("error writing to stdout not resolved in %d steps", stdoutWriteRetry)
+						count := stdoutWriteRetry
+						for os.IsTimeout(err) && count > 0 {
+							time.Sleep(time.Millisecond)
+							_, err = os.Stdout.Write(data)
+							count--
+						}
+						if err != nil {
+							log.Debugf("error writing to stdout not resolved in %d steps", stdoutWriteRetry)
+						}
 					}
 				}
 			}
@@ -230,10 +234,23 @@ func RunSerial(hosts []string, argv string, delay int) *ExecResult {
 		defer os.Remove(local)
 	}
 
+	hc := currentHealthCheck
+	if argv == "" {
+		// interactive sessions aren't checked
+		hc = nil
+	}
+	if hc != nil && !hc.Local {
+		pool = NewPool()
+		defer pool.Close()
+	}
+
 execLoop:
 	for i, host := range hosts {
-		msg := term.HR(7) + " " + host + " " + term.HR(136-len(host))
-		fmt.Println(term.Blue(msg))
+		if !jsonOutput() {
+			msg := term.HR(7) + " " + host + " " + term.HR(136-len(host))
+			fmt.Println(term.Blue(msg))
+		}
+		r.startHost(host)
 
 		if argv != "" {
 			remoteCmd = fmt.Sprintf("%s.%s.sh", remotePrefix, host)
@@ -243,8 +260,10 @@ execLoop:
 			signal.Reset()
 			if err != nil {
 				term.Errorf("Error copying generated script file to remote host: %s\n", err)
-				r.ErrorHosts = append(r.ErrorHosts, host)
-				r.Codes[host] = ErrCopyFailed
+				r.addResult(host, ErrCopyFailed)
+				if jsonOutput() {
+					r.emitFinished(host)
+				}
 				continue
 			}
 		} else {
@@ -256,7 +275,7 @@ execLoop:
 			remoteCmd = "'" + remoteCmd + "'"
 		}
 
-		cmd = createSSHCmd(host, remoteCmd)
+		cmd = createSSHCmd(host, remoteCmd, true)
 		log.Debugf("Created SSH command: %v", cmd)
 
 		runAtHost(host, cmd, r)
@@ -273,11 +292,26 @@ execLoop:
 			}
 		}
 
-		r.Codes[host] = exitCode
-		if exitCode != 0 {
-			r.ErrorHosts = append(r.ErrorHosts, host)
-		} else {
-			r.SuccessHosts = append(r.SuccessHosts, host)
+		if _, found := r.Codes[host]; !found {
+			// the code may be already set by runAtHost on auth error
+			r.addResult(host, exitCode)
+		}
+
+		passed := true
+		if hc != nil {
+			signal.Notify(sigs, syscall.SIGINT)
+			passed = hc.gate([]string{host}, r, sigs)
+			signal.Reset()
+		}
+		// the host is finished once it's checked,
+		// failing the check fails the host
+		if jsonOutput() {
+			r.emitFinished(host)
+		}
+		if !passed {
+			term.Errorf("Health check hasn't passed, serial execution aborted\n")
+			r.SkippedHosts = append(r.SkippedHosts, hosts[i+1:]...)
+			break execLoop
 		}
 
 		// no delay after the last host
@@ -43,6 +43,9 @@ type Task struct {
 	Cmd            string
 	Copy           CopyType
 	WG             *sync.WaitGroup
+	// Deadline is the time the task must be finished by
+	// regardless of the command timeout
+	Deadline time.Time
 }
 
 // MessageType describes a type of worker message
@@ -62,6 +65,8 @@ const (
 	MTDebug
 	MTCopyFinished
 	MTExecFinished
+	MTStderr
+	MTTaskStarted
 )
 
 // Custom error codes
@@ -72,6 +77,11 @@ const (
 	ErrTerminalError
 	ErrAuthenticationError
 	ErrCommandStartFailed
+	ErrConnectionFailed
+	ErrHostKeyFailed
+	ErrSSHAuthFailed
+	ErrTimeout
+	ErrHealthCheckFailed
 )
 
 const (
@@ -134,6 +144,7 @@ func (w *Worker) run() {
 
 		w.busy = true
 		log.Debugf("WRK[%d] Got a task for host %s by worker", w.id, task.Hostname)
+		w.data <- &Message{nil, MTTaskStarted, task.Hostname, -1}
 
 		// does the task have anything to copy?
 		if task.RemoteFilename != "" && task.LocalFilename != "" {
@@ -149,7 +160,12 @@ func (w *Worker) run() {
 				// if copying failed we can't proceed further with the task if there's anything to run
 				if task.Cmd != "" {
 					log.Debugf("WRK[%d] Copy on %s, result != 0, task.Cmd == \"%s\", sending ExecFinished", w.id, task.Hostname, task.Cmd)
-					w.data <- &Message{nil, MTExecFinished, task.Hostname, ErrCopyFailed}
+					code := ErrCopyFailed
+					if IsConnectionError(result) || result == ErrTimeout {
+						// connection failures and timeouts are reported as is
+						code = result
+					}
+					w.data <- &Message{nil, MTExecFinished, task.Hostname, code}
 				}
 				w.busy = false
 				if task.WG != nil {
@@ -244,7 +260,7 @@ func (w *Worker) processStderr(rd io.ReadCloser, wr io.WriteCloser, finished *bo
 				if currentDebug {
 					w.log("STDERR CHUNK OUT @ %s: %v %s", task.Hostname, data, string(data))
 				}
-				w.data <- &Message{data, MTData, task.Hostname, -1}
+				w.data <- &Message{data, MTStderr, task.Hostname, -1}
 
 			}
 		}
@@ -314,7 +330,7 @@ execLoop:
 					continue
 				}
 				if passwordSent && exWrongPassword.Match(chunk) {
-					w.data <- &Message{[]byte("sudo: Authentication failure\n"), MTData, task.Hostname, -1}
+					w.data <- &Message{[]byte("sudo: Authentication failure\n"), MTStderr, task.Hostname, -1}
 					*finished = true
 					break execLoop
 				}
@@ -336,6 +352,24 @@ execLoop:
 	w.log("exiting stdout processor for host %s", task.Hostname)
 }
 
+// taskDeadline returns the time a task must be finished by according
+// to the command timeout and the task deadline whichever is earlier,
+// zero time means no deadline
+func taskDeadline(task *Task) time.Time {
+	deadline := task.Deadline
+	if currentCommandTimeout > 0 {
+		timeout := time.Now().Add(currentCommandTimeout)
+		if deadline.IsZero() || timeout.Before(deadline) {
+			deadline = timeout
+		}
+	}
+	return deadline
+}
+
+func deadlineExceeded(deadline time.Time) bool {
+	return !deadline.IsZero() && time.Now().After(deadline)
+}
+
 func (w *Worker) _run(task *Task, cmd *exec.Cmd) int {
 	cmd.Env = append(os.Environ(), environment...)
 
@@ -372,12 +406,19 @@ func (w *Worker) _run(task *Task, cmd *exec.Cmd) int {
 	stdoutFinished := false
 	stderrFinished := false
 	taskForceStopped := false
+	taskTimedOut := false
+	deadline := taskDeadline(task)
 	go w.processStdout(sout, sin, &stdoutFinished, task)
 	go w.processStderr(serr, sin, &stderrFinished, task)
 
 	for !(stdoutFinished && stderrFinished) {
 		if w.forceStopped() {
 			taskForceStopped = true
+		} else if deadlineExceeded(deadline) {
+			w.log("task on %s timed out", task.Hostname)
+			taskTimedOut = true
+		}
+		if taskForceStopped || taskTimedOut {
 			err = cmd.Process.Kill()
 			if err != nil {
 				w.log("error killing process: %v", err)
@@ -394,6 +435,9 @@ func (w *Worker) _run(task *Task, cmd *exec.Cmd) int {
 	if taskForceStopped {
 		return ErrForceStop
 	}
+	if taskTimedOut {
+		return ErrTimeout
+	}
 
 	if err != nil {
 		if exitErr, ok := err.(*exec.ExitError); ok {
@@ -0,0 +1,31 @@
+package remote
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTaskDeadline(t *testing.T) {
+	defer SetCommandTimeout(0)
+	soon := time.Now().Add(time.Second)
+	later := time.Now().Add(time.Hour)
+
+	SetCommandTimeout(0)
+	if d := taskDeadline(&Task{}); !d.IsZero() {
+		t.Errorf("deadline without timeouts is %s, expected none", d)
+	}
+	if d := taskDeadline(&Task{Deadline: soon}); !d.Equal(soon) {
+		t.Errorf("deadline is %s, expected the task deadline %s", d, soon)
+	}
+
+	SetCommandTimeout(60)
+	if d := taskDeadline(&Task{Deadline: soon}); !d.Equal(soon) {
+		t.Errorf("deadline is %s, expected the earlier task deadline %s", d, soon)
+	}
+	if d := taskDeadline(&Task{Deadline: later}); !d.Before(later) {
+		t.Errorf("deadline is %s, expected the earlier command timeout", d)
+	}
+	if d := taskDeadline(&Task{}); d.IsZero() || d.After(time.Now().Add(time.Minute)) {
+		t.Errorf("deadline is %s, expected the command timeout", d)
+	}
+}
@@ -1,5 +1,7 @@
 package store
 
+import "time"
+
 // Backend represents a store backend interface
 type Backend interface {
 	Load() error
@@ -10,3 +12,40 @@ type Backend interface {
 	WorkGroups() []*WorkGroup
 	Hosts() []*Host
 }
+
+// UpdateNotifier is an optional interface for backends which may update
+// their data asynchronously, i.e. refreshing an expired cache in background
+type UpdateNotifier interface {
+	// OnUpdate sets a handler called every time the data is updated
+	OnUpdate(handler func())
+}
+
+// CacheInfo describes the local cache of a backend
+type CacheInfo struct {
+	Filename string
+	Exists   bool
+	ModTime  time.Time
+	TTL      time.Duration
+}
+
+// CachedBackend is an optional interface for backends
+// keeping a local cache of the remote data
+type CachedBackend interface {
+	CacheInfo() *CacheInfo
+	PurgeCache() error
+	// Offline mode makes the backend use the cache only
+	SetOffline(offline bool)
+	Offline() bool
+}
+
+// Writer is an optional interface for backends able to modify
+// and persist the inventory data. Backends implementing Writer
+// are expected to implement UpdateNotifier as well so the store
+// is refreshed after every modification
+type Writer interface {
+	AddHost(host *Host) error
+	RemoveHosts(fqdns []string) error
+	MoveHosts(fqdns []string, group string) error
+	AddTags(fqdns []string, tags []string) error
+	RemoveTags(fqdns []string, tags []string) error
+}
@@ -15,6 +15,7 @@ const (
 	tTypeWorkGroup
 	tTypeHostRegexp
 	tTypeHostListFile
+	tTypeVariable
 )
 
 const (
@@ -27,6 +28,7 @@ const (
 	stateReadHostBracePattern
 	stateReadRegexp
 	stateReadHostListFile
+	stateReadVariable
 )
 
 type token struct {
@@ -39,7 +41,8 @@ type token struct {
 }
 
 var (
-	hostSymbols = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789.-{}"
+	hostSymbols     = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789.-{}"
+	variableSymbols = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_"
 )
 
 func newToken() *token {
@@ -91,6 +94,12 @@ func parseExpression(expr []rune) ([]*token, error) {
 				continue
 			}
 
+			if sym == '$' {
+				ct.Type = tTypeVariable
+				state = stateReadVariable
+				continue
+			}
+
 			if sym == '/' || sym == '~' {
 				state = stateReadHost
 				ct.Type = tTypeHostRegexp
@@ -104,7 +113,7 @@ func parseExpression(expr []rune) ([]*token, error) {
 				continue
 			}
 
-			return nil, fmt.Errorf("Invalid symbol %s, expected -, *, %% or a hostname at position %d", string(sym), i)
+			return nil, fmt.Errorf("Invalid symbol %s, expected -, *, %%, $ or a hostname at position %d", string(sym), i)
 
 		case stateReadGroup:
 
@@ -235,6 +244,24 @@ func parseExpression(expr []rune) ([]*token, error) {
 			}
 			ct.Value += string(sym)
 
+		case stateReadVariable:
+			if sym == ',' || last {
+				if last && sym != ',' {
+					ct.Value += string(sym)
+				}
+				if ct.Value == "" {
+					return nil, fmt.Errorf("Empty variable name at position %d", i)
+				}
+				res = append(res, ct)
+				ct = newToken()
+				state = stateWait
+				continue
+			}
+			if !strings.ContainsRune(variableSymbols, sym) {
+				return nil, fmt.Errorf("Invalid symbol %s in variable name at position %d", string(sym), i)
+			}
+			ct.Value += string(sym)
+
 		case stateReadHostBracePattern:
 			if sym == '{' {
 				return nil, fmt.Errorf("nested patterns are not allowed (at %d)", i)
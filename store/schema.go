@@ -22,6 +22,12 @@ type Host struct {
 	DatacenterID string
 	Description  string
 
+	// connection parameters, empty values mean defaults
+	Address  string
+	Port     int
+	User     string
+	JumpHost string
+
 	AllTags    []string
 	Datacenter *Datacenter
 	Group      *Group
@@ -2,10 +2,12 @@ package store
 
 import (
 	"bufio"
+	"fmt"
 	"os"
 	"regexp"
 	"sort"
 	"strings"
+	"sync"
 
 	"github.com/facette/natsort"
 	"github.com/viert/sekwence"
@@ -20,6 +22,12 @@ type Store struct {
 	workgroups  *wgstore
 	tags        []string
 	backend     Backend
+	lock        sync.RWMutex
+	// copyLock keeps concurrent copies of backend data in order
+	copyLock sync.Mutex
+
+	// named hostlists referred to as $name in expressions
+	variables map[string][]string
 
 	naturalSort bool
 }
@@ -68,6 +76,9 @@ func (s *Store) addWorkGroup(wg *WorkGroup) {
 
 // CompleteTag returns all postfixes of tags starting with a given prefix
 func (s *Store) CompleteTag(prefix string) []string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
 	res := make([]string, 0)
 	for _, tag := range s.tags {
 		if prefix == "" || strings.HasPrefix(tag, prefix) {
@@ -80,6 +91,9 @@ func (s *Store) CompleteTag(prefix string) []string {
 
 // CompleteHost returns all postfixes of host fqdns starting with a given prefix
 func (s *Store) CompleteHost(prefix string) []string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
 	res := make([]string, 0)
 	for hostname := range s.hosts.fqdn {
 		if prefix == "" || strings.HasPrefix(hostname, prefix) {
@@ -92,6 +106,9 @@ func (s *Store) CompleteHost(prefix string) []string {
 
 // CompleteGroup returns all postfixes of group names starting with a given prefix
 func (s *Store) CompleteGroup(prefix string) []string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
 	res := make([]string, 0)
 	for name := range s.groups.name {
 		if prefix == "" || strings.HasPrefix(name, prefix) {
@@ -104,6 +121,9 @@ func (s *Store) CompleteGroup(prefix string) []string {
 
 // CompleteDatacenter returns all postfixes of dc names starting with a given prefix
 func (s *Store) CompleteDatacenter(prefix string) []string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
 	res := make([]string, 0)
 	for name := range s.datacenters.name {
 		if prefix == "" || strings.HasPrefix(name, prefix) {
@@ -116,6 +136,9 @@ func (s *Store) CompleteDatacenter(prefix string) []string {
 
 // CompleteWorkGroup returns all postfixes of workgroup names starting with a given prefix
 func (s *Store) CompleteWorkGroup(prefix string) []string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
 	res := make([]string, 0)
 	for name := range s.workgroups.name {
 		if prefix == "" || strings.HasPrefix(name, prefix) {
@@ -157,12 +180,27 @@ func (s *Store) groupAllHosts(g *Group) []*Host {
 	return hosts
 }
 
+// Host returns a host by its fqdn or nil if it's not found
+func (s *Store) Host(fqdn string) *Host {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.hosts.fqdn[fqdn]
+}
+
 // SetNaturalSort enables/disables using of natural sorting
 // within one expression token (i.e. group)
 func (s *Store) SetNaturalSort(value bool) {
 	s.naturalSort = value
 }
 
+// SetVariable sets a named hostlist which may be used
+// in expressions as $name
+func (s *Store) SetVariable(name string, hosts []string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.variables[name] = append([]string{}, hosts...)
+}
+
 // HostList returns a list of host FQDNs according to a given
 // expression
 func (s *Store) HostList(expr []rune) ([]string, error) {
@@ -171,6 +209,9 @@ func (s *Store) HostList(expr []rune) ([]string, error) {
 		return nil, err
 	}
 
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
 	expanded := make([]expandedToken, 0)
 
 	for _, token := range tokens {
@@ -181,6 +222,13 @@ func (s *Store) HostList(expr []rune) ([]string, error) {
 		}
 
 		switch token.Type {
+		case tTypeVariable:
+			hosts, found := s.variables[token.Value]
+			if !found {
+				return nil, fmt.Errorf("variable $%s is not defined", token.Value)
+			}
+			etoken.hosts = append(etoken.hosts, hosts...)
+
 		case tTypeHostListFile:
 			filename := token.Value
 			f, err := os.Open(filename)
@@ -362,6 +410,16 @@ func (s *Store) apply() {
 
 	tagmap := make(map[string]bool)
 
+	// the objects are copies of the backend ones which may carry
+	// relations already, so the relations are built from scratch
+	for _, workgroup = range s.workgroups._id {
+		workgroup.Groups = make([]*Group, 0)
+	}
+	for _, group = range s.groups._id {
+		group.Children = make([]*Group, 0)
+		group.Hosts = make([]*Host, 0)
+	}
+
 	for _, dc := range s.datacenters._id {
 		if dc.ParentID != "" {
 			dc.Parent = s.datacenters._id[dc.ParentID]
@@ -454,25 +512,58 @@ func CreateStore(backend Backend) (*Store, error) {
 	s := new(Store)
 	s.backend = backend
 	s.naturalSort = true
+	s.variables = make(map[string][]string)
+	s.reinitStore()
+	// the handler is set before loading as the backend may start
+	// refreshing its data in background while being loaded
+	if notifier, ok := backend.(UpdateNotifier); ok {
+		notifier.OnUpdate(s.copyBackendData)
+	}
 	err := s.BackendLoad()
 	return s, err
 }
 
+// copyBackendData builds a new set of indexes out of the backend data
+// and then atomically replaces the current ones, so the store remains
+// usable while the backend is being updated in background. The relations
+// are built on copies of the backend objects as the objects currently
+// indexed may be provided by the backend again and are still being read
 func (s *Store) copyBackendData() {
-	s.reinitStore()
+	s.copyLock.Lock()
+	defer s.copyLock.Unlock()
+
+	ns := new(Store)
+	ns.reinitStore()
 	for _, host := range s.backend.Hosts() {
-		s.addHost(host)
+		h := *host
+		ns.addHost(&h)
 	}
 	for _, group := range s.backend.Groups() {
-		s.addGroup(group)
+		g := *group
+		ns.addGroup(&g)
 	}
 	for _, datacenter := range s.backend.Datacenters() {
-		s.addDatacenter(datacenter)
+		dc := *datacenter
+		ns.addDatacenter(&dc)
 	}
 	for _, workgroup := range s.backend.WorkGroups() {
-		s.addWorkGroup(workgroup)
+		wg := *workgroup
+		ns.addWorkGroup(&wg)
 	}
-	s.apply()
+	ns.apply()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.datacenters = ns.datacenters
+	s.groups = ns.groups
+	s.hosts = ns.hosts
+	s.workgroups = ns.workgroups
+	s.tags = ns.tags
+}
+
+// Backend returns the backend the store is loaded from
+func (s *Store) Backend() Backend {
+	return s.backend
 }
 
 // BackendLoad is a proxy to backend.Load handler
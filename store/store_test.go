@@ -2,6 +2,7 @@ package store
 
 import (
 	"sort"
+	"sync"
 	"testing"
 )
 
@@ -300,3 +301,186 @@ func TestExclude(t *testing.T) {
 	}
 
 }
+
+type notifyingBackend struct {
+	FakeBackend
+	handler func()
+}
+
+func (nb *notifyingBackend) OnUpdate(handler func()) {
+	nb.handler = handler
+}
+
+func TestBackendUpdate(t *testing.T) {
+	nb := &notifyingBackend{FakeBackend: *newFB()}
+
+	s, err := CreateStore(nb)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if nb.handler == nil {
+		t.Error("store is expected to subscribe to backend updates")
+		return
+	}
+
+	nb.hosts = append(nb.hosts, &Host{ID: "h5", FQDN: "host5.example.com", GroupID: "g4"})
+	nb.handler()
+
+	hostlist, err := s.HostList([]rune("%group4"))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if len(hostlist) != 3 {
+		t.Errorf("hostlist is expected to contain the updated host, %v", hostlist)
+	}
+}
+
+// refreshingBackend starts refreshing its data in Load like a backend with
+// an expired cache does. The refresh is finished as soon as the store has
+// read the data loaded, i.e. before Load and CreateStore have returned
+type refreshingBackend struct {
+	notifyingBackend
+	lock     sync.Mutex
+	served   bool
+	refresh  chan bool
+	read     chan bool
+	notified chan bool
+}
+
+func (rb *refreshingBackend) Hosts() []*Host {
+	rb.lock.Lock()
+	hosts := rb.hosts
+	first := !rb.served
+	rb.served = true
+	rb.lock.Unlock()
+	if first {
+		rb.refresh <- true
+		<-rb.read
+	}
+	return hosts
+}
+
+func (rb *refreshingBackend) OnUpdate(handler func()) {
+	rb.lock.Lock()
+	defer rb.lock.Unlock()
+	rb.handler = handler
+}
+
+func (rb *refreshingBackend) Load() error {
+	rb.FakeBackend.Load()
+	go func() {
+		<-rb.refresh
+		rb.lock.Lock()
+		rb.hosts = append(rb.hosts, &Host{ID: "h5", FQDN: "host5.example.com", GroupID: "g4"})
+		handler := rb.handler
+		rb.lock.Unlock()
+		rb.read <- true
+		if handler != nil {
+			handler()
+		}
+		close(rb.notified)
+	}()
+	return nil
+}
+
+func TestBackendRefreshOnLoad(t *testing.T) {
+	rb := &refreshingBackend{
+		notifyingBackend: notifyingBackend{FakeBackend: *newFB()},
+		refresh:          make(chan bool),
+		read:             make(chan bool),
+		notified:         make(chan bool),
+	}
+
+	s, err := CreateStore(rb)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	<-rb.notified
+
+	hostlist, err := s.HostList([]rune("%group4"))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(hostlist) != 3 {
+		t.Errorf("hostlist is expected to contain the host refreshed while loading, %v", hostlist)
+	}
+}
+
+// TestReadWhileReloading is meant to be run with -race, the objects
+// being read mustn't be modified by reloads
+func TestReadWhileReloading(t *testing.T) {
+	nb := &notifyingBackend{FakeBackend: *newFB()}
+	s, err := CreateStore(nb)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			nb.handler()
+		}
+	}()
+
+	for reloading := true; reloading; {
+		select {
+		case <-done:
+			reloading = false
+		default:
+		}
+		hostlist, err := s.HostList([]rune("%group1"))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if len(hostlist) != 2 {
+			t.Errorf("hostlist is expected to contain 2 hosts while reloading, %v", hostlist)
+			return
+		}
+		h := s.Host("host1.example.com")
+		if h == nil || h.Group == nil || len(h.Group.Hosts) != 1 || len(h.Group.Parent.Children) != 2 {
+			t.Errorf("host1 relations are broken while reloading")
+			return
+		}
+	}
+}
+
+func TestVariables(t *testing.T) {
+	fb := newFB()
+	fb.Load()
+
+	s, err := CreateStore(fb)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	_, err = s.HostList([]rune("$failed"))
+	if err == nil {
+		t.Error("undefined variable is expected to cause an error")
+	}
+
+	s.SetVariable("failed", []string{"host3.example.com", "host1.example.com"})
+	hostlist, err := s.HostList([]rune("$failed,-host3.example.com"))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if len(hostlist) != 1 || hostlist[0] != "host1.example.com" {
+		t.Errorf("hostlist is expected to contain host1.example.com only, %v", hostlist)
+	}
+
+	_, err = s.HostList([]rune("$fa-iled"))
+	if err == nil {
+		t.Error("invalid variable name is expected to cause an error")
+	}
+}
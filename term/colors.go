@@ -2,6 +2,8 @@ package term
 
 import (
 	"fmt"
+	"io"
+	"os"
 )
 
 type colorValue int
@@ -26,8 +28,26 @@ const (
 	CWhite        colorValue = 97
 )
 
+var (
+	colorsEnabled           = true
+	output        io.Writer = os.Stdout
+)
+
+// SetColors turns colors on/off, when off messages are left as is
+func SetColors(enabled bool) {
+	colorsEnabled = enabled
+}
+
+// SetOutput sets the writer Errorf, Successf and Warnf messages go to
+func SetOutput(w io.Writer) {
+	output = w
+}
+
 // Colored wraps message into esc sequences to make it colored
 func Colored(message string, c colorValue, bold bool) string {
+	if !colorsEnabled {
+		return message
+	}
 	bstr := ""
 	if bold {
 		bstr = ";1"
@@ -63,17 +83,17 @@ func Cyan(message string) string {
 // Errorf prints a red-colored formatted error message
 func Errorf(format string, args ...interface{}) {
 	message := fmt.Sprintf(format, args...)
-	fmt.Print(Red(message))
+	fmt.Fprint(output, Red(message))
 }
 
 // Successf prints a green-colored formatted message
 func Successf(format string, args ...interface{}) {
 	message := fmt.Sprintf(format, args...)
-	fmt.Print(Green(message))
+	fmt.Fprint(output, Green(message))
 }
 
 // Warnf prints a yellow-colored formatted warning message
 func Warnf(format string, args ...interface{}) {
 	message := fmt.Sprintf(format, args...)
-	fmt.Print(Yellow(message))
+	fmt.Fprint(output, Yellow(message))
 }
@@ -19,16 +19,21 @@ func HR(len int) string {
 	return string(h)
 }
 
-// GetTerminalWidth returns the current terminal width in symbols
+const (
+	defaultTerminalWidth = 80
+)
+
+// GetTerminalWidth returns the current terminal width in symbols,
+// the default width is returned if stdin is not a terminal
 func GetTerminalWidth() int {
 	ws := &winsize{}
-	retCode, _, errno := syscall.Syscall(syscall.SYS_IOCTL,
+	retCode, _, _ := syscall.Syscall(syscall.SYS_IOCTL,
 		uintptr(syscall.Stdin),
 		uintptr(syscall.TIOCGWINSZ),
 		uintptr(unsafe.Pointer(ws)))
 
-	if int(retCode) == -1 {
-		panic(errno)
+	if int(retCode) == -1 || ws.Col == 0 {
+		return defaultTerminalWidth
 	}
 	return int(ws.Col)
 }